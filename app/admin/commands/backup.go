@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"photo-contest/business/data/backup"
+	"photo-contest/foundation/database"
+
+	"github.com/pkg/errors"
+)
+
+// backupTimeout bounds a backup or restore, which copy the whole database.
+const backupTimeout = 10 * time.Minute
+
+// Backup writes a backup archive of the SQLite database.
+func Backup(log *log.Logger, dbConfig database.Config, cfg backup.Config) error {
+	if err := sqliteOnly(dbConfig); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+
+	archive, err := backup.NewArchiver(log, cfg).Create(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("backup written to", archive)
+	return nil
+}
+
+// Restore replaces the SQLite database with the one in a backup archive,
+// once it passed an integrity check.
+func Restore(log *log.Logger, dbConfig database.Config, cfg backup.Config, archive string) error {
+	if archive == "" {
+		fmt.Println("help: restore <archive>")
+		return ErrHelp
+	}
+	if err := sqliteOnly(dbConfig); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+
+	if err := backup.NewArchiver(log, cfg).Restore(ctx, archive, time.Now()); err != nil {
+		return err
+	}
+
+	fmt.Println("database restored from", archive)
+	return nil
+}
+
+// sqliteOnly refuses to work on a Postgres database, which is backed up
+// with its own tools.
+func sqliteOnly(cfg database.Config) error {
+	if cfg.Driver != "" && cfg.Driver != database.DriverSQLite {
+		return errors.Errorf("backups are only made of SQLite databases, not %s", cfg.Driver)
+	}
+	return nil
+}
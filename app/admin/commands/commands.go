@@ -0,0 +1,87 @@
+// Package commands contains the functionality for the set of commands
+// currently supported by the admin program.
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"photo-contest/foundation/database"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ErrHelp provides context that help was given.
+var ErrHelp = errors.New("provided help")
+
+// Usage describes the commands, printed after the configuration options.
+const Usage = `
+Commands:
+  migrate                                      bring the database schema up to date
+  seed                                         load sample data: the site admin admin@example.com,
+                                               password gophers1, and an open contest
+  useradd <name> <email> [password]            add a user
+  passwd <email> [password]                    set the password of a user
+  grant-role <email> <role> [contest id]       grant a role, site wide without a contest
+  genkey [key id]                              make a token signing key, named after the month by default
+  contest create <email> <title> <start> <end> create a draft contest owned by the user
+  contest close <contest id>                   close an open contest to submissions
+  backup                                       write a backup archive of the database
+  restore <archive>                            restore the database from a backup archive,
+                                               with the webserver stopped
+
+Passwords left out are read from stdin. Dates are given as 2006-01-02 or
+RFC 3339 times.
+`
+
+// timeout bounds the database work of a command.
+const timeout = 10 * time.Second
+
+// open connects to the database and checks it can be used.
+func open(cfg database.Config) (*sqlx.DB, error) {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to db")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := database.StatusCheck(ctx, db); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "status check database")
+	}
+	return db, nil
+}
+
+// password returns pass, or reads it from stdin when it was not given, so
+// it stays out of the shell history.
+func password(pass string) (string, error) {
+	if pass != "" {
+		return pass, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.Wrap(err, "reading password")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// parseTime reads a date or an RFC 3339 time; dates are taken in UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%q is not a date", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/user"
+	"photo-contest/foundation/database"
+
+	"github.com/pkg/errors"
+)
+
+// ContestCreate creates a draft contest taking submissions between start
+// and end. The user owning it is made its admin.
+func ContestCreate(log *log.Logger, cfg database.Config, email, title, start, end string) error {
+	if email == "" || title == "" || start == "" || end == "" {
+		fmt.Println("help: contest create <email> <title> <start> <end>")
+		return ErrHelp
+	}
+	submitStart, err := parseTime(start)
+	if err != nil {
+		return err
+	}
+	submitEnd, err := parseTime(end)
+	if err != nil {
+		return err
+	}
+
+	db, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	usr, err := user.NewStore(log, db).QueryByEmail(ctx, email)
+	if err != nil {
+		return errors.Wrapf(err, "looking up %s", email)
+	}
+
+	nc := contest.NewContest{
+		UserID:      usr.ID,
+		Title:       title,
+		SubmitStart: submitStart,
+		SubmitEnd:   submitEnd,
+	}
+	c, err := contest.NewStore(log, db).Create(ctx, nc, time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("contest id:", c.ID)
+	return nil
+}
+
+// ContestClose stops an open contest from taking submissions and moves it
+// on to judging.
+func ContestClose(log *log.Logger, cfg database.Config, contestID string) error {
+	if contestID == "" {
+		fmt.Println("help: contest close <contest id>")
+		return ErrHelp
+	}
+	id, err := strconv.Atoi(contestID)
+	if err != nil {
+		return errors.Errorf("%q is not a contest ID", contestID)
+	}
+
+	db, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	c, err := contest.NewStore(log, db).SetPhase(ctx, id, contest.PhaseJudging, time.Now())
+	if err != nil {
+		if errors.Cause(err) == contest.ErrInvalidPhase {
+			return errors.Errorf("contest %d is not open", id)
+		}
+		return err
+	}
+
+	fmt.Printf("contest %d is now %s\n", c.ID, c.Phase)
+	return nil
+}
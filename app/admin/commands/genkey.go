@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GenKey makes an RSA key for signing tokens and writes it to dir as
+// <key ID>.pem, where the key store finds it. The key ID is the current
+// month unless given. An existing key file is never overwritten.
+func GenKey(dir, kid string) error {
+	if kid == "" {
+		kid = time.Now().UTC().Format("2006-01")
+	}
+	if kid != filepath.Base(kid) || kid == "." {
+		return errors.Errorf("%q is not a key ID", kid)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return errors.Wrap(err, "generating key")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "creating %s", dir)
+	}
+	file := filepath.Join(dir, kid+".pem")
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrap(err, "creating key file")
+	}
+	defer f.Close()
+
+	block := pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}
+	if err := pem.Encode(f, &block); err != nil {
+		return errors.Wrap(err, "writing key")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "writing key")
+	}
+
+	fmt.Println("key written to", file)
+	fmt.Printf("sign tokens with it by setting PHOTOC_AUTH_ACTIVE_KID=%s\n", kid)
+	return nil
+}
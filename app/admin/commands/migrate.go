@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"photo-contest/business/data/schema"
+	"photo-contest/foundation/database"
+
+	"github.com/pkg/errors"
+)
+
+// Migrate creates the schema in the database, or brings it up to date.
+func Migrate(cfg database.Config) error {
+	db, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := schema.Migrate(ctx, db); err != nil {
+		return errors.Wrap(err, "migrate database")
+	}
+
+	fmt.Println("migrations complete")
+	return nil
+}
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"photo-contest/business/data/schema"
+	"photo-contest/foundation/database"
+
+	"github.com/pkg/errors"
+)
+
+// Seed loads the seed data into a migrated database.
+func Seed(cfg database.Config) error {
+	db, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := schema.Seed(ctx, db); err != nil {
+		return errors.Wrap(err, "seed database")
+	}
+
+	fmt.Println("seed data complete")
+	return nil
+}
@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/session"
+	"photo-contest/business/data/user"
+	"photo-contest/foundation/database"
+
+	"github.com/pkg/errors"
+)
+
+// UserAdd adds a user who can sign in with the given email and password.
+func UserAdd(log *log.Logger, cfg database.Config, name, email, pass string) error {
+	if name == "" || email == "" {
+		fmt.Println("help: useradd <name> <email> [password]")
+		return ErrHelp
+	}
+	pass, err := password(pass)
+	if err != nil {
+		return err
+	}
+
+	db, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	nu := user.NewAuthUser{
+		Name:        name,
+		Email:       email,
+		Pass:        pass,
+		PassConfirm: pass,
+	}
+	usr, err := user.NewStore(log, db).Create(ctx, nu)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("user id:", usr.ID)
+	return nil
+}
+
+// Passwd sets the password of a user. It goes through a reset token like a
+// forgotten password does, so reset links already sent stop working, and
+// signs the user out everywhere.
+func Passwd(log *log.Logger, cfg database.Config, email, pass string) error {
+	if email == "" {
+		fmt.Println("help: passwd <email> [password]")
+		return ErrHelp
+	}
+	pass, err := password(pass)
+	if err != nil {
+		return err
+	}
+
+	db, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	store := user.NewStore(log, db)
+	usr, err := store.QueryByEmail(ctx, email)
+	if err != nil {
+		return errors.Wrapf(err, "looking up %s", email)
+	}
+
+	now := time.Now()
+	token, err := store.CreateResetToken(ctx, usr.ID, now)
+	if err != nil {
+		return err
+	}
+	np := user.NewPassword{
+		Pass:        pass,
+		PassConfirm: pass,
+	}
+	if _, err := store.ResetPassword(ctx, token, np, now); err != nil {
+		return err
+	}
+	if _, err := session.NewStore(log, db).DeleteByUser(ctx, usr.ID, ""); err != nil {
+		return err
+	}
+
+	fmt.Println("password set for user id:", usr.ID)
+	return nil
+}
+
+// GrantRole gives a role to a user, for a contest or site wide when no
+// contest is given.
+func GrantRole(log *log.Logger, cfg database.Config, email, role, contestID string) error {
+	if email == "" || role == "" {
+		fmt.Println("help: grant-role <email> <role> [contest id]")
+		return ErrHelp
+	}
+	r := user.Role(role)
+	if !r.Valid() {
+		return errors.Errorf("%q is not a role, expected one of %v", role, user.Roles)
+	}
+	var id int
+	if contestID != "" {
+		var err error
+		if id, err = strconv.Atoi(contestID); err != nil {
+			return errors.Errorf("%q is not a contest ID", contestID)
+		}
+	}
+
+	db, err := open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	store := user.NewStore(log, db)
+	usr, err := store.QueryByEmail(ctx, email)
+	if err != nil {
+		return errors.Wrapf(err, "looking up %s", email)
+	}
+	if id != 0 {
+		if _, err := contest.NewStore(log, db).QueryByID(ctx, id); err != nil {
+			return errors.Wrapf(err, "looking up contest %d", id)
+		}
+	}
+	if err := store.Grant(ctx, usr.ID, r, id, time.Now()); err != nil {
+		return err
+	}
+
+	fmt.Printf("granted %s to user id: %d\n", r, usr.ID)
+	return nil
+}
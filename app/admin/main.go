@@ -0,0 +1,184 @@
+// This program performs administrative tasks for the photo contest: it
+// migrates, seeds, backs up and restores the database, manages users and
+// contests, and makes the keys signing tokens. It reads the same PHOTOC_
+// configuration as the webserver.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"photo-contest/app/admin/commands"
+	"photo-contest/business/data/backup"
+	"photo-contest/business/data/photo"
+	"photo-contest/foundation/database"
+
+	"github.com/ardanlabs/conf"
+	"github.com/pkg/errors"
+)
+
+// build is the git version of this program. It is set using build flags in the makefile.
+var build = "develop"
+
+func main() {
+	log := log.New(os.Stdout, "ADMIN : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+
+	if err := run(log); err != nil {
+		if errors.Cause(err) != commands.ErrHelp {
+			log.Println("main: error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(log *log.Logger) error {
+
+	var cfg struct {
+		conf.Version
+		Args conf.Args
+		DB   struct {
+			// Driver is sqlite3 or postgres. SQLite uses the file at
+			// Path, Postgres the database Name on Host.
+			Driver      string `conf:"default:sqlite3"`
+			Path        string `conf:"default:var/db.db"`
+			Mode        string `conf:"default:rw"`
+			JournalMode string `conf:"default:WAL"`
+			Cache       string `conf:"default:shared"`
+			Host        string `conf:"default:localhost:5432"`
+			User        string `conf:"default:postgres"`
+			Password    string `conf:"default:postgres,mask"`
+			Name        string `conf:"default:photoc"`
+			DisableTLS  bool   `conf:"default:false"`
+		}
+		Photos struct {
+			Path string `conf:"default:var/photos"`
+		}
+		Auth struct {
+			KeysDir string `conf:"default:var/keys"`
+		}
+		Backup struct {
+			Dir      string `conf:"default:var/backups"`
+			Keep     int    `conf:"default:7"`
+			Manifest bool   `conf:"default:true"`
+		}
+	}
+	cfg.Version.SVN = build
+	cfg.Version.Desc = "CSHL/DNALC"
+
+	if err := conf.Parse(os.Args[1:], "PHOTOC", &cfg); err != nil {
+		switch err {
+		case conf.ErrHelpWanted:
+			usage, err := conf.Usage("PHOTOC", &cfg)
+			if err != nil {
+				return errors.Wrap(err, "generating config usage")
+			}
+			fmt.Println(usage)
+			fmt.Print(commands.Usage)
+			return nil
+		case conf.ErrVersionWanted:
+			version, err := conf.VersionString("PHOTOC", &cfg)
+			if err != nil {
+				return errors.Wrap(err, "generating config version")
+			}
+			fmt.Println(version)
+			return nil
+		}
+		return errors.Wrap(err, "parsing config")
+	}
+
+	dbConfig := database.Config{
+		Driver:      cfg.DB.Driver,
+		Path:        cfg.DB.Path,
+		Mode:        cfg.DB.Mode,
+		Cache:       cfg.DB.Cache,
+		JournalMode: cfg.DB.JournalMode,
+		Host:        cfg.DB.Host,
+		User:        cfg.DB.User,
+		Password:    cfg.DB.Password,
+		Name:        cfg.DB.Name,
+		DisableTLS:  cfg.DB.DisableTLS,
+	}
+
+	backupConfig := backup.Config{
+		DBPath: cfg.DB.Path,
+		Dir:    cfg.Backup.Dir,
+		Keep:   cfg.Backup.Keep,
+	}
+	if cfg.Backup.Manifest {
+		photos := photo.NewStorage(cfg.Photos.Path)
+		backupConfig.Photos = &photos
+	}
+
+	return processCommands(cfg.Args, log, dbConfig, backupConfig, cfg.Auth.KeysDir)
+}
+
+// processCommands handles the execution of the commands specified on
+// the command line.
+func processCommands(args conf.Args, log *log.Logger, dbConfig database.Config, backupConfig backup.Config, keysDir string) error {
+	switch args.Num(0) {
+	case "migrate":
+		if err := commands.Migrate(dbConfig); err != nil {
+			return errors.Wrap(err, "migrating database")
+		}
+
+	case "seed":
+		if err := commands.Seed(dbConfig); err != nil {
+			return errors.Wrap(err, "seeding database")
+		}
+
+	case "useradd":
+		name, email, pass := args.Num(1), args.Num(2), args.Num(3)
+		if err := commands.UserAdd(log, dbConfig, name, email, pass); err != nil {
+			return errors.Wrap(err, "adding user")
+		}
+
+	case "passwd":
+		email, pass := args.Num(1), args.Num(2)
+		if err := commands.Passwd(log, dbConfig, email, pass); err != nil {
+			return errors.Wrap(err, "setting password")
+		}
+
+	case "grant-role":
+		email, role, contestID := args.Num(1), args.Num(2), args.Num(3)
+		if err := commands.GrantRole(log, dbConfig, email, role, contestID); err != nil {
+			return errors.Wrap(err, "granting role")
+		}
+
+	case "genkey":
+		if err := commands.GenKey(keysDir, args.Num(1)); err != nil {
+			return errors.Wrap(err, "generating key")
+		}
+
+	case "contest":
+		switch args.Num(1) {
+		case "create":
+			email, title, start, end := args.Num(2), args.Num(3), args.Num(4), args.Num(5)
+			if err := commands.ContestCreate(log, dbConfig, email, title, start, end); err != nil {
+				return errors.Wrap(err, "creating contest")
+			}
+		case "close":
+			if err := commands.ContestClose(log, dbConfig, args.Num(2)); err != nil {
+				return errors.Wrap(err, "closing contest")
+			}
+		default:
+			fmt.Print(commands.Usage)
+			return commands.ErrHelp
+		}
+
+	case "backup":
+		if err := commands.Backup(log, dbConfig, backupConfig); err != nil {
+			return errors.Wrap(err, "backing up database")
+		}
+
+	case "restore":
+		if err := commands.Restore(log, dbConfig, backupConfig, args.Num(1)); err != nil {
+			return errors.Wrap(err, "restoring database")
+		}
+
+	default:
+		fmt.Print(commands.Usage)
+		return commands.ErrHelp
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"photo-contest/business/data/lockout"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/pkg/errors"
+)
+
+// AdminRoles - lets site admins grant and revoke user roles. The route must
+// be guarded with RequireRole(user.RoleSiteAdmin).
+func (s *Service) AdminRoles(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr, _ := ctx.Value("user").(*user.AuthUser)
+
+	store := user.NewStore(s.log, s.db)
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Roles":          user.Roles,
+	}
+
+	render := func(status int) error {
+		grants, err := store.ListGrants(ctx)
+		if err != nil {
+			return err
+		}
+		data["Grants"] = grants
+
+		rw.WriteHeader(status)
+		return s.t.ExecuteTemplate(rw, "roles.gohtml", data)
+	}
+
+	if r.Method == "GET" {
+		return render(http.StatusOK)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	role := user.Role(r.Form.Get("role"))
+	contestID, err := strconv.Atoi(r.Form.Get("contest_id"))
+	if err != nil {
+		return validate.NewRequestError(validate.ErrInvalidID, http.StatusBadRequest)
+	}
+
+	switch r.Form.Get("action") {
+	case "grant":
+		email := strings.TrimSpace(r.Form.Get("email"))
+		grantee, err := store.QueryByEmail(ctx, email)
+		if err != nil {
+			if err == database.ErrNotFound {
+				data["Message"] = fmt.Sprintf("There is no user with the email %q.", email)
+				return render(http.StatusBadRequest)
+			}
+			return err
+		}
+		if err := store.Grant(ctx, grantee.ID, role, contestID, time.Now()); err != nil {
+			if err == user.ErrInvalidRole || err == user.ErrNeedsContest {
+				data["Message"] = err.Error()
+				return render(http.StatusBadRequest)
+			}
+			return err
+		}
+		s.log.Printf("user %d granted %s (contest %d) to user %d", usr.ID, role, contestID, grantee.ID)
+
+	case "revoke":
+		userID, err := strconv.Atoi(r.Form.Get("user_id"))
+		if err != nil {
+			return validate.NewRequestError(validate.ErrInvalidID, http.StatusBadRequest)
+		}
+		if userID == usr.ID && role == user.RoleSiteAdmin {
+			data["Message"] = "You can't revoke your own site admin role."
+			return render(http.StatusBadRequest)
+		}
+		if err := store.Revoke(ctx, userID, role, contestID); err != nil {
+			return err
+		}
+		s.log.Printf("user %d revoked %s (contest %d) from user %d", usr.ID, role, contestID, userID)
+
+	default:
+		return validate.NewRequestError(errors.New("unknown action"), http.StatusBadRequest)
+	}
+
+	http.Redirect(rw, r, "/admin/roles", http.StatusFound)
+	return nil
+}
+
+// AdminLockouts - shows the accounts and addresses locked after failed logins
+// and lets site admins unlock them. The route must be guarded with
+// RequireRole(user.RoleSiteAdmin).
+func (s *Service) AdminLockouts(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr := ctx.Value("user").(*user.AuthUser)
+
+	store := lockout.NewStore(s.log, s.db)
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		}
+		kind, key := lockout.Kind(r.Form.Get("kind")), r.Form.Get("key")
+		if err := store.Reset(ctx, kind, key); err != nil {
+			return err
+		}
+		s.log.Printf("user %d unlocked %s %q", usr.ID, kind, key)
+		http.Redirect(rw, r, "/admin/lockouts", http.StatusFound)
+		return nil
+	}
+
+	locked, err := store.QueryLocked(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	events, err := store.QueryEvents(ctx, 100)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Locked":         locked,
+		"Events":         events,
+	}
+	return s.t.ExecuteTemplate(rw, "lockouts.gohtml", data)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/user"
+	"photo-contest/business/data/vote"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"photo-contest/foundation/database"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The JSON API lives under /api/v1. Every response is JSON; failures use
+// the validate.ErrorResponse envelope with the status code telling them
+// apart.
+
+// maxAPIBody limits the size of JSON request bodies.
+const maxAPIBody = 1 << 20
+
+// decodeJSON reads the JSON request body into v. Unknown fields are refused
+// so typos don't go unnoticed.
+func decodeJSON(rw http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if err == io.EOF {
+			err = errors.New("request body is empty")
+		}
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// apiContest loads the contest named by the "id" route variable. Drafts
+// only exist for their admins.
+func (s *Service) apiContest(r *http.Request) (contest.Contest, error) {
+	c, err := s.requestContest(r)
+	if err != nil {
+		return contest.Contest{}, err
+	}
+	usr, _ := r.Context().Value("user").(*user.AuthUser)
+	if c.Phase == contest.PhaseDraft && !isContestAdmin(usr, c) {
+		return contest.Contest{}, database.ErrNotFound
+	}
+	return c, nil
+}
+
+// APIGuard refuses unsafe API requests a browser could have been tricked
+// into sending with the session cookie of its user. Sending JSON, or any
+// custom header, takes a CORS preflight we never grant, so only forms
+// posted from other sites are affected. Requests carrying an Authorization
+// header don't rely on the cookie and are let through.
+func APIGuard(next http.Handler) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "":
+		case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		default:
+			json := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+			if !json && r.Header.Get("X-Requested-With") == "" {
+				msg := "requests must be JSON or carry an X-Requested-With header"
+				web.Respond(rw, validate.ErrorResponse{Error: msg}, http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(rw, r)
+	}
+}
+
+// APINotFound - answers API requests for unknown routes
+func (s *Service) APINotFound(rw http.ResponseWriter, r *http.Request) error {
+	return database.ErrNotFound
+}
+
+// =============================================================================
+
+// APISignUp - creates an account and sends the email verification link
+func (s *Service) APISignUp(rw http.ResponseWriter, r *http.Request) error {
+	var nu user.NewAuthUser
+	if err := decodeJSON(rw, r, &nu); err != nil {
+		return err
+	}
+	nu.Email = strings.TrimSpace(nu.Email)
+
+	store := user.NewStore(s.log, s.db)
+	if _, err := store.QueryByEmail(r.Context(), nu.Email); err == nil {
+		return validate.NewRequestError(errors.New("This email is already in use."), http.StatusConflict)
+	} else if err != database.ErrNotFound {
+		return err
+	}
+
+	usr, err := store.Create(r.Context(), nu)
+	if err != nil {
+		return err
+	}
+	if err := s.sendVerification(r.Context(), usr); err != nil {
+		s.log.Printf("sending verification to user %d: %s", usr.ID, err)
+	}
+
+	web.Respond(rw, usr, http.StatusCreated)
+	return nil
+}
+
+// APIMe - returns the signed in user along with their roles. The record is
+// read again since a JSON Web Token only carries part of it.
+func (s *Service) APIMe(rw http.ResponseWriter, r *http.Request) error {
+	usr := r.Context().Value("user").(*user.AuthUser)
+
+	fresh, err := user.NewStore(s.log, s.db).QueryByID(r.Context(), usr.ID)
+	if err != nil {
+		return err
+	}
+	fresh.Grants = usr.Grants
+	web.Respond(rw, fresh, http.StatusOK)
+	return nil
+}
+
+// APIMyVotes - lists the votes of the signed in user in the contest given by
+// the contest query parameter
+func (s *Service) APIMyVotes(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr := ctx.Value("user").(*user.AuthUser)
+
+	contestID, err := strconv.Atoi(r.URL.Query().Get("contest"))
+	if err != nil {
+		return validate.NewRequestError(errors.New("the contest parameter must be a contest ID"), http.StatusBadRequest)
+	}
+
+	votes, err := vote.NewStore(s.log, s.db).QueryByUserContest(ctx, usr.ID, contestID)
+	if err != nil {
+		return err
+	}
+	if votes == nil {
+		votes = []vote.Vote{}
+	}
+	web.Respond(rw, votes, http.StatusOK)
+	return nil
+}
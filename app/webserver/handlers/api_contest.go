@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/result"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// APIContests - lists the contests, optionally only those in the phase given
+// by the phase query parameter. Drafts are only listed for their admins.
+func (s *Service) APIContests(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr, _ := ctx.Value("user").(*user.AuthUser)
+
+	store := contest.NewStore(s.log, s.db)
+	var (
+		cs  []contest.Contest
+		err error
+	)
+	if phase := contest.Phase(r.URL.Query().Get("phase")); phase != "" {
+		if !phase.Valid() {
+			return validate.NewRequestError(errors.Errorf("unknown phase %q", phase), http.StatusBadRequest)
+		}
+		cs, err = store.QueryByPhase(ctx, phase)
+	} else {
+		cs, err = store.List(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	visible := []contest.Contest{}
+	for _, c := range cs {
+		if c.Phase != contest.PhaseDraft || isContestAdmin(usr, c) {
+			visible = append(visible, c)
+		}
+	}
+	web.Respond(rw, visible, http.StatusOK)
+	return nil
+}
+
+// APIContest - returns a single contest
+func (s *Service) APIContest(rw http.ResponseWriter, r *http.Request) error {
+	c, err := s.apiContest(r)
+	if err != nil {
+		return err
+	}
+	web.Respond(rw, c, http.StatusOK)
+	return nil
+}
+
+// APICreateContest - creates a draft contest run by the signed in user. The
+// route must be guarded with RequireRole(user.RoleContestAdmin).
+func (s *Service) APICreateContest(rw http.ResponseWriter, r *http.Request) error {
+	usr := r.Context().Value("user").(*user.AuthUser)
+
+	var nc contest.NewContest
+	if err := decodeJSON(rw, r, &nc); err != nil {
+		return err
+	}
+	nc.UserID = usr.ID
+
+	c, err := contest.NewStore(s.log, s.db).Create(r.Context(), nc, time.Now())
+	if err != nil {
+		return err
+	}
+	s.log.Printf("contest %d created by user %d", c.ID, usr.ID)
+
+	web.Respond(rw, c, http.StatusCreated)
+	return nil
+}
+
+// APIUpdateContest - changes the fields given in the request body. The
+// route must be guarded with RequireContestRole(user.RoleContestAdmin).
+func (s *Service) APIUpdateContest(rw http.ResponseWriter, r *http.Request) error {
+	c, err := s.apiContest(r)
+	if err != nil {
+		return err
+	}
+
+	var uc contest.UpdateContest
+	if err := decodeJSON(rw, r, &uc); err != nil {
+		return err
+	}
+
+	c, err = contest.NewStore(s.log, s.db).Update(r.Context(), c.ID, uc, time.Now())
+	switch errors.Cause(err) {
+	case nil:
+	case contest.ErrLocked:
+		err = validate.NewRequestError(err, http.StatusConflict)
+	case contest.ErrNoWeight:
+		err = validate.NewRequestError(err, http.StatusBadRequest)
+	}
+	if err != nil {
+		return err
+	}
+
+	web.Respond(rw, c, http.StatusOK)
+	return nil
+}
+
+// APISetPhase - moves a contest to the phase given in the request body.
+// Publishing freezes the results. The route must be guarded with
+// RequireContestRole(user.RoleContestAdmin).
+func (s *Service) APISetPhase(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr := ctx.Value("user").(*user.AuthUser)
+
+	c, err := s.apiContest(r)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Phase contest.Phase `json:"phase"`
+	}
+	if err := decodeJSON(rw, r, &req); err != nil {
+		return err
+	}
+	if !req.Phase.Valid() {
+		return validate.NewRequestError(errors.Errorf("unknown phase %q", req.Phase), http.StatusBadRequest)
+	}
+
+	now := time.Now()
+	if req.Phase == contest.PhasePublished {
+		_, err = result.NewStore(s.log, s.db).Publish(ctx, c, now)
+	} else {
+		_, err = contest.NewStore(s.log, s.db).SetPhase(ctx, c.ID, req.Phase, now)
+	}
+	if errors.Cause(err) == contest.ErrInvalidPhase {
+		err = validate.NewRequestError(err, http.StatusConflict)
+	}
+	if err != nil {
+		return err
+	}
+	s.log.Printf("contest %d moved to %s by user %d", c.ID, req.Phase, usr.ID)
+
+	c, err = contest.NewStore(s.log, s.db).QueryByID(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	web.Respond(rw, c, http.StatusOK)
+	return nil
+}
+
+// APIResults - returns the ranked entries of a published contest. While the
+// contest is judged its admins get a preview.
+func (s *Service) APIResults(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr, _ := ctx.Value("user").(*user.AuthUser)
+
+	c, err := s.apiContest(r)
+	if err != nil {
+		return err
+	}
+
+	store := result.NewStore(s.log, s.db)
+	var rs []result.Result
+	switch {
+	case c.ResultsVisible():
+		rs, err = store.QueryByContest(ctx, c.ID)
+	case c.Phase == contest.PhaseJudging && isContestAdmin(usr, c):
+		rs, err = store.Compute(ctx, c, time.Now())
+	default:
+		err = validate.NewRequestError(errors.New("results are not published yet"), http.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	cats := result.ByCategory(rs)
+	if cats == nil {
+		cats = []result.Category{}
+	}
+	resp := struct {
+		Preview    bool              `json:"preview"`
+		Categories []result.Category `json:"categories"`
+	}{
+		Preview:    !c.ResultsVisible(),
+		Categories: cats,
+	}
+	web.Respond(rw, resp, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/user"
+	"photo-contest/business/data/vote"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"photo-contest/foundation/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// apiPhoto is a photo as shown by the API. Authors are left out so the jury
+// judges blind.
+type apiPhoto struct {
+	ID        int                   `json:"id"`
+	ContestID int                   `json:"contest_id"`
+	Title     string                `json:"title"`
+	Caption   string                `json:"caption"`
+	Category  string                `json:"category"`
+	Width     int                   `json:"width"`
+	Height    int                   `json:"height"`
+	Votes     int                   `json:"votes"`
+	URLs      map[photo.Size]string `json:"urls"`
+	CreatedOn time.Time             `json:"date_created"`
+}
+
+// newAPIPhoto returns the API form of a photo.
+func newAPIPhoto(p photo.Photo, votes int) apiPhoto {
+	urls := make(map[photo.Size]string, len(photo.Sizes))
+	for size := range photo.Sizes {
+		urls[size] = fmt.Sprintf("/photos/%d/%s", p.ID, size)
+	}
+	return apiPhoto{
+		ID:        p.ID,
+		ContestID: p.ContestID,
+		Title:     p.Title,
+		Caption:   p.Caption,
+		Category:  p.Category,
+		Width:     p.Width,
+		Height:    p.Height,
+		Votes:     votes,
+		URLs:      urls,
+		CreatedOn: p.CreatedOn,
+	}
+}
+
+// apiPhotoContest loads the photo named by the "id" route variable and the
+// contest it was submitted to.
+func (s *Service) apiPhotoContest(r *http.Request) (photo.Photo, contest.Contest, error) {
+	photoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return photo.Photo{}, contest.Contest{}, validate.NewRequestError(validate.ErrInvalidID, http.StatusBadRequest)
+	}
+	p, err := photo.NewStore(s.log, s.db).QueryByID(r.Context(), photoID)
+	if err != nil {
+		return photo.Photo{}, contest.Contest{}, err
+	}
+	c, err := contest.NewStore(s.log, s.db).QueryByID(r.Context(), p.ContestID)
+	if err != nil {
+		return photo.Photo{}, contest.Contest{}, err
+	}
+	return p, c, nil
+}
+
+// APIContestPhotos - lists the entries of a contest with their vote counts
+func (s *Service) APIContestPhotos(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	c, err := s.apiContest(r)
+	if err != nil {
+		return err
+	}
+
+	photos, err := photo.NewStore(s.log, s.db).QueryByContest(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	tallies, err := vote.NewStore(s.log, s.db).Tallies(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	counts := make(map[int]int)
+	for _, t := range tallies {
+		counts[t.PhotoID] = t.Votes
+	}
+
+	entries := make([]apiPhoto, len(photos))
+	for i, p := range photos {
+		entries[i] = newAPIPhoto(p, counts[p.ID])
+	}
+	web.Respond(rw, entries, http.StatusOK)
+	return nil
+}
+
+// APISubmitPhoto - submits a photo to a contest. The request is a multipart
+// form with the image in the photo field, like the submission page sends.
+func (s *Service) APISubmitPhoto(rw http.ResponseWriter, r *http.Request) error {
+	usr := r.Context().Value("user").(*user.AuthUser)
+
+	c, err := s.apiContest(r)
+	if err != nil {
+		return err
+	}
+
+	// Leave some room on top of the file for the other form fields.
+	r.Body = http.MaxBytesReader(rw, r.Body, s.limits.MaxBytes+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return validate.NewRequestError(errors.New("the upload could not be read or is too large"), http.StatusBadRequest)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		return validate.NewRequestError(errors.New("the photo field is missing"), http.StatusBadRequest)
+	}
+	defer file.Close()
+
+	np := photo.NewPhoto{
+		ContestID: c.ID,
+		UserID:    usr.ID,
+		Title:     strings.TrimSpace(r.Form.Get("title")),
+		Caption:   strings.TrimSpace(r.Form.Get("caption")),
+		Category:  strings.TrimSpace(r.Form.Get("category")),
+	}
+	p, err := s.submit(r.Context(), usr, c, file, np)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(rw, newAPIPhoto(p, 0), http.StatusCreated)
+	return nil
+}
+
+// APIPhoto - returns a single photo with its vote count
+func (s *Service) APIPhoto(rw http.ResponseWriter, r *http.Request) error {
+	usr, _ := r.Context().Value("user").(*user.AuthUser)
+
+	p, c, err := s.apiPhotoContest(r)
+	if err == nil && c.Phase == contest.PhaseDraft && !isContestAdmin(usr, c) {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	count, err := vote.NewStore(s.log, s.db).Count(r.Context(), p.ID)
+	if err != nil {
+		return err
+	}
+	web.Respond(rw, newAPIPhoto(p, count), http.StatusOK)
+	return nil
+}
+
+// APIVote - casts the vote of the signed in user for a photo on POST and
+// takes it back on DELETE, returning the live count
+func (s *Service) APIVote(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr := ctx.Value("user").(*user.AuthUser)
+
+	p, c, err := s.apiPhotoContest(r)
+	if err != nil {
+		return err
+	}
+	if err := s.vote(ctx, usr, c, p, r.Method == http.MethodPost); err != nil {
+		return err
+	}
+
+	status, err := s.voteStatus(ctx, usr, c, p)
+	if err != nil {
+		return err
+	}
+	web.Respond(rw, status, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/user"
+	"photo-contest/business/data/vote"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+)
+
+// requestContest loads the contest named by the "id" route variable.
+func (s *Service) requestContest(r *http.Request) (contest.Contest, error) {
+	contestID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return contest.Contest{}, validate.NewRequestError(validate.ErrInvalidID, http.StatusBadRequest)
+	}
+	return contest.NewStore(s.log, s.db).QueryByID(r.Context(), contestID)
+}
+
+// entry is a photo as shown in the contest gallery.
+type entry struct {
+	photo.Photo
+	Votes int
+	Voted bool
+}
+
+// ContestView - displays a contest with its gallery and the vote counts
+func (s *Service) ContestView(rw http.ResponseWriter, r *http.Request) error {
+	usr, _ := r.Context().Value("user").(*user.AuthUser)
+
+	c, err := s.requestContest(r)
+	if err != nil {
+		return err
+	}
+	if c.Phase == contest.PhaseDraft && !isContestAdmin(usr, c) {
+		return database.ErrNotFound
+	}
+
+	return s.renderContest(rw, r, c, usr, "", http.StatusOK)
+}
+
+// renderContest renders the contest page with the gallery of entries.
+func (s *Service) renderContest(rw http.ResponseWriter, r *http.Request, c contest.Contest, usr *user.AuthUser, message string, status int) error {
+	ctx := r.Context()
+
+	photos, err := photo.NewStore(s.log, s.db).QueryByContest(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+
+	votes := vote.NewStore(s.log, s.db)
+	tallies, err := votes.Tallies(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	counts := make(map[int]int)
+	for _, t := range tallies {
+		counts[t.PhotoID] = t.Votes
+	}
+
+	voted := make(map[int]bool)
+	remaining := 0
+	if usr != nil {
+		vs, err := votes.QueryByUserContest(ctx, usr.ID, c.ID)
+		if err != nil {
+			return err
+		}
+		for _, v := range vs {
+			voted[v.PhotoID] = true
+		}
+		remaining = c.VoteBudget - len(vs)
+	}
+
+	entries := make([]entry, len(photos))
+	for i, p := range photos {
+		entries[i] = entry{Photo: p, Votes: counts[p.ID], Voted: voted[p.ID]}
+	}
+
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Contest":        c,
+		"Entries":        entries,
+		"CanSubmit":      c.AcceptsSubmissions(time.Now()),
+		"CanVote":        c.AcceptsVotes() && usr != nil && !usr.HasRole(user.RoleJuror, c.ID),
+		"IsAdmin":        isContestAdmin(usr, c),
+		"VotesLeft":      remaining,
+		"Message":        message,
+	}
+
+	rw.WriteHeader(status)
+	return s.t.ExecuteTemplate(rw, "contest.gohtml", data)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/web"
+	"photo-contest/foundation/database"
+	"photo-contest/foundation/metrics"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DebugMux returns the handler of the debug listener: the probes the
+// orchestrator checks on us with, profiling, expvars and metrics. None of
+// it is meant to be reachable from the public network.
+func DebugMux(build string, log *log.Logger, db *sqlx.DB, photos photo.Storage) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+
+	cg := checkGroup{
+		build:  build,
+		log:    log,
+		db:     db,
+		photos: photos,
+	}
+	mux.HandleFunc("/debug/liveness", cg.liveness)
+	mux.HandleFunc("/debug/readiness", cg.readiness)
+
+	return mux
+}
+
+// checkGroup answers the liveness and readiness probes.
+type checkGroup struct {
+	build  string
+	log    *log.Logger
+	db     *sqlx.DB
+	photos photo.Storage
+}
+
+// liveness reports that the process is up and serving. It checks nothing
+// else: a failing liveness probe gets the process restarted.
+func (cg checkGroup) liveness(w http.ResponseWriter, r *http.Request) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unavailable"
+	}
+
+	data := struct {
+		Status string `json:"status"`
+		Build  string `json:"build"`
+		Host   string `json:"host"`
+	}{
+		Status: "up",
+		Build:  cg.build,
+		Host:   host,
+	}
+	web.Respond(w, data, http.StatusOK)
+}
+
+// readiness reports whether requests can be served: the database answers
+// and uploads can be written. A failing readiness probe takes the process
+// out of rotation until it passes again.
+func (cg checkGroup) readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	status, code := "ok", http.StatusOK
+	if err := database.StatusCheck(ctx, cg.db); err != nil {
+		cg.log.Printf("readiness: database: %s", err)
+		status, code = "database not ready", http.StatusServiceUnavailable
+	} else if err := cg.photos.StatusCheck(); err != nil {
+		cg.log.Printf("readiness: photo storage: %s", err)
+		status, code = "photo storage not writable", http.StatusServiceUnavailable
+	}
+
+	data := struct {
+		Status string `json:"status"`
+	}{
+		Status: status,
+	}
+	web.Respond(w, data, code)
+}
@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"photo-contest/app/webserver/handlers"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/tests"
+	"testing"
+)
+
+func TestDebugProbes(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	// probe asks the debug mux for path and returns the status and the
+	// status message of the answer.
+	probe := func(h http.Handler, path string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+		var resp struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding %s: %s", path, err)
+		}
+		return w.Code, resp.Status
+	}
+
+	t.Log("Given the need to tell the orchestrator how we are doing.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the database and photo storage are fine.", testID)
+		{
+			h := handlers.DebugMux("test", log, db, photo.NewStorage(t.TempDir()))
+
+			if code, status := probe(h, "/debug/liveness"); code != http.StatusOK || status != "up" {
+				t.Fatalf("\t%s\tTest %d:\tShould be alive : %d %q.", tests.Failed, testID, code, status)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be alive.", tests.Success, testID)
+
+			if code, status := probe(h, "/debug/readiness"); code != http.StatusOK || status != "ok" {
+				t.Fatalf("\t%s\tTest %d:\tShould be ready : %d %q.", tests.Failed, testID, code, status)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be ready.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the photo directory is missing.", testID)
+		{
+			missing := filepath.Join(t.TempDir(), "unmounted")
+			h := handlers.DebugMux("test", log, db, photo.NewStorage(missing))
+
+			if code, status := probe(h, "/debug/readiness"); code != http.StatusServiceUnavailable || status != "photo storage not writable" {
+				t.Fatalf("\t%s\tTest %d:\tShould not be ready : %d %q.", tests.Failed, testID, code, status)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be ready.", tests.Success, testID)
+
+			if code, _ := probe(h, "/debug/liveness"); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould still be alive : %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still be alive.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the database is closed.", testID)
+		{
+			log, closed, teardown := tests.NewUnit(t)
+			teardown()
+			h := handlers.DebugMux("test", log, closed, photo.NewStorage(t.TempDir()))
+
+			if code, status := probe(h, "/debug/readiness"); code != http.StatusServiceUnavailable || status != "database not ready" {
+				t.Fatalf("\t%s\tTest %d:\tShould not be ready : %d %q.", tests.Failed, testID, code, status)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be ready.", tests.Success, testID)
+
+			if code, _ := probe(h, "/debug/liveness"); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould still be alive : %d.", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still be alive.", tests.Success, testID)
+		}
+	}
+}
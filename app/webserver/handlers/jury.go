@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/jury"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// isContestAdmin reports whether the user manages the contest.
+func isContestAdmin(usr *user.AuthUser, c contest.Contest) bool {
+	return usr != nil && usr.HasRole(user.RoleContestAdmin, c.ID)
+}
+
+// JuryAdmin - lets the contest admin manage the jurors and the scoring
+// criteria. The route must be guarded with RequireContestRole.
+func (s *Service) JuryAdmin(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr, _ := ctx.Value("user").(*user.AuthUser)
+
+	c, err := s.requestContest(r)
+	if err != nil {
+		return err
+	}
+	// Criteria are locked once judging started so all entries are scored
+	// against the same ones.
+	criteriaLocked := c.Phase != contest.PhaseDraft && c.Phase != contest.PhaseOpen
+
+	store := jury.NewStore(s.log, s.db)
+	data := map[string]interface{}{
+		csrf.TemplateTag:  csrf.TemplateField(r),
+		"User":            usr,
+		"Contest":         c,
+		"DefaultCriteria": jury.DefaultCriteria,
+		"CriteriaLocked":  criteriaLocked,
+	}
+
+	render := func(status int) error {
+		jurors, err := store.Jurors(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		criteria, err := store.Criteria(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		data["Jurors"] = jurors
+		data["Criteria"] = criteria
+
+		rw.WriteHeader(status)
+		return s.t.ExecuteTemplate(rw, "jury.gohtml", data)
+	}
+
+	if r.Method == "GET" {
+		return render(http.StatusOK)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	now := time.Now()
+	action := r.Form.Get("action")
+	if criteriaLocked && (strings.HasSuffix(action, "_criterion") || action == "default_criteria") {
+		data["Message"] = "Criteria can't be changed once judging started."
+		return render(http.StatusConflict)
+	}
+
+	switch action {
+	case "add_juror":
+		email := strings.TrimSpace(r.Form.Get("email"))
+		juror, err := user.NewStore(s.log, s.db).QueryByEmail(ctx, email)
+		if err != nil {
+			if err == database.ErrNotFound {
+				data["Message"] = fmt.Sprintf("There is no user with the email %q.", email)
+				return render(http.StatusBadRequest)
+			}
+			return err
+		}
+		if err := store.AddJuror(ctx, c.ID, juror.ID, now); err != nil {
+			return err
+		}
+
+	case "remove_juror":
+		userID, _ := strconv.Atoi(r.Form.Get("user_id"))
+		if err := store.RemoveJuror(ctx, c.ID, userID); err != nil {
+			return err
+		}
+
+	case "add_criterion":
+		weight, err := strconv.ParseFloat(r.Form.Get("weight"), 64)
+		if err != nil {
+			data["Message"] = "The weight must be a number."
+			return render(http.StatusBadRequest)
+		}
+		nc := jury.NewCriterion{
+			ContestID: c.ID,
+			Name:      strings.TrimSpace(r.Form.Get("name")),
+			Weight:    weight,
+		}
+		if _, err := store.AddCriterion(ctx, nc, now); err != nil {
+			data["Message"] = err.Error()
+			return render(http.StatusBadRequest)
+		}
+
+	case "remove_criterion":
+		criterionID, _ := strconv.Atoi(r.Form.Get("criterion_id"))
+		if err := store.RemoveCriterion(ctx, c.ID, criterionID); err != nil {
+			return err
+		}
+
+	case "default_criteria":
+		for _, nc := range jury.DefaultCriteria {
+			nc.ContestID = c.ID
+			if _, err := store.AddCriterion(ctx, nc, now); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return validate.NewRequestError(errors.New("unknown action"), http.StatusBadRequest)
+	}
+
+	http.Redirect(rw, r, fmt.Sprintf("/contests/%d/jury", c.ID), http.StatusFound)
+	return nil
+}
+
+// requestJuror loads the contest named in the route for the juror judging
+// it. The route must be guarded with RequireContestRole(user.RoleJuror).
+func (s *Service) requestJuror(r *http.Request) (*user.AuthUser, contest.Contest, error) {
+	usr, ok := r.Context().Value("user").(*user.AuthUser)
+	if !ok {
+		return nil, contest.Contest{}, database.ErrForbidden
+	}
+
+	c, err := s.requestContest(r)
+	if err != nil {
+		return nil, contest.Contest{}, err
+	}
+
+	return usr, c, nil
+}
+
+// judgedEntry is a photo as shown to jurors. It carries no author details
+// so the jury judges blind.
+type judgedEntry struct {
+	ID      int
+	Title   string
+	Caption string
+	Scored  bool
+}
+
+// Judge - lists the entries of a contest for a juror
+func (s *Service) Judge(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	usr, c, err := s.requestJuror(r)
+	if err != nil {
+		return err
+	}
+
+	photos, err := photo.NewStore(s.log, s.db).QueryByContest(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	scores, err := jury.NewStore(s.log, s.db).ScoresByJuror(ctx, c.ID, usr.ID)
+	if err != nil {
+		return err
+	}
+	scored := make(map[int]bool)
+	for _, sc := range scores {
+		scored[sc.PhotoID] = true
+	}
+
+	entries := make([]judgedEntry, len(photos))
+	for i, p := range photos {
+		entries[i] = judgedEntry{ID: p.ID, Title: p.Title, Caption: p.Caption, Scored: scored[p.ID]}
+	}
+
+	data := map[string]interface{}{
+		"User":    usr,
+		"Contest": c,
+		"Entries": entries,
+		"Open":    c.AcceptsJudging(),
+	}
+	return s.t.ExecuteTemplate(rw, "judge.gohtml", data)
+}
+
+// JudgePhoto - lets a juror score a single entry on every criterion
+func (s *Service) JudgePhoto(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	usr, c, err := s.requestJuror(r)
+	if err != nil {
+		return err
+	}
+
+	photoID, err := strconv.Atoi(mux.Vars(r)["photo_id"])
+	if err != nil {
+		return validate.NewRequestError(validate.ErrInvalidID, http.StatusBadRequest)
+	}
+	p, err := photo.NewStore(s.log, s.db).QueryByID(ctx, photoID)
+	if err != nil {
+		return err
+	}
+	if p.ContestID != c.ID {
+		return database.ErrNotFound
+	}
+
+	store := jury.NewStore(s.log, s.db)
+	criteria, err := store.Criteria(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Contest":        c,
+		"Entry":          judgedEntry{ID: p.ID, Title: p.Title, Caption: p.Caption},
+		"Criteria":       criteria,
+	}
+
+	render := func(status int) error {
+		scores, err := store.ScoresByJuror(ctx, c.ID, usr.ID)
+		if err != nil {
+			return err
+		}
+		current := make(map[int]int)
+		for _, sc := range scores {
+			if sc.PhotoID == p.ID {
+				current[sc.CriterionID] = sc.Value
+			}
+		}
+		marks := make([]int, jury.MaxScore-jury.MinScore+1)
+		for i := range marks {
+			marks[i] = jury.MinScore + i
+		}
+		data["Current"] = current
+		data["Marks"] = marks
+
+		rw.WriteHeader(status)
+		return s.t.ExecuteTemplate(rw, "judge_photo.gohtml", data)
+	}
+
+	if r.Method == "GET" {
+		return render(http.StatusOK)
+	}
+
+	if !c.AcceptsJudging() {
+		data["Message"] = "This contest is not being judged."
+		return render(http.StatusForbidden)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	marks := make(map[int]int)
+	for _, cr := range criteria {
+		v, err := strconv.Atoi(r.Form.Get(fmt.Sprintf("criterion_%d", cr.ID)))
+		if err != nil {
+			data["Message"] = fmt.Sprintf("Please score %s.", cr.Name)
+			return render(http.StatusBadRequest)
+		}
+		marks[cr.ID] = v
+	}
+
+	switch err := store.Score(ctx, c.ID, usr.ID, p.ID, marks, time.Now()); err {
+	case nil:
+	case jury.ErrBadScore, jury.ErrBadCriterion:
+		data["Message"] = err.Error()
+		return render(http.StatusBadRequest)
+	default:
+		return err
+	}
+
+	http.Redirect(rw, r, fmt.Sprintf("/judge/%d", c.ID), http.StatusFound)
+	return nil
+}
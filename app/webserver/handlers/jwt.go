@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-contest/business/data/lockout"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/auth"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"photo-contest/foundation/database"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// APIIssueToken - exchanges the email and password of a user, and their
+// two-factor code when they turned it on, for a JSON Web Token. Failures
+// count towards the same lockouts as the sign in page.
+func (s *Service) APIIssueToken(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	now := time.Now()
+
+	var req struct {
+		Email string `json:"email"`
+		Pass  string `json:"pass"`
+		Code  string `json:"code"`
+	}
+	if err := decodeJSON(rw, r, &req); err != nil {
+		return err
+	}
+
+	keys := loginKeys(r, req.Email)
+	wait, err := s.lockedOut(ctx, keys, now)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		setRetryAfter(rw, wait)
+		return validate.NewRequestError(errors.New("too many failed attempts"), http.StatusTooManyRequests)
+	}
+
+	// Refuses the attempt and counts it as failed.
+	fail := func(msg string) error {
+		if err := s.failLogin(ctx, keys, now); err != nil {
+			return err
+		}
+		return validate.NewRequestError(errors.New(msg), http.StatusUnauthorized)
+	}
+
+	store := user.NewStore(s.log, s.db)
+	usr, err := store.Authenticate(ctx, strings.TrimSpace(req.Email), req.Pass)
+	switch err {
+	case nil:
+	case database.ErrAuthenticationFailure, database.ErrNotFound:
+		return fail("invalid email or password")
+	default:
+		return err
+	}
+
+	if usr.TOTPEnabled() {
+		switch err := store.CheckTOTP(ctx, usr.ID, req.Code, now); err {
+		case nil:
+		case user.ErrInvalidCode:
+			return fail("a valid two-factor code is required")
+		default:
+			return err
+		}
+	}
+
+	if err := lockout.NewStore(s.log, s.db).Reset(ctx, lockout.KindAccount, keys[lockout.KindAccount]); err != nil {
+		return err
+	}
+	usr.Grants, err = store.QueryGrants(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+
+	claims := auth.NewClaims(usr.ID, now, s.jwtTTL)
+	claims.Name = usr.Name
+	claims.Email = usr.Email
+	claims.EmailVerifiedOn = usr.EmailVerifiedOn
+	for _, g := range usr.Grants {
+		claims.Grants = append(claims.Grants, auth.Grant{Role: string(g.Role), ContestID: g.ContestID})
+	}
+	token, err := s.jwt.GenerateToken(claims)
+	if err != nil {
+		return err
+	}
+	s.log.Printf("issued JWT to user %d", usr.ID)
+
+	resp := struct {
+		Token     string    `json:"token"`
+		TokenType string    `json:"token_type"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	rw.Header().Set("Cache-Control", "no-store")
+	web.Respond(rw, resp, http.StatusOK)
+	return nil
+}
+
+// isJWT reports whether a bearer token looks like a JSON Web Token rather
+// than an API token: three dot separated parts.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// jwtUser returns the user described by the claims of a valid token. The
+// user is not looked up: roles granted or taken away show once the token
+// is renewed.
+func (s *Service) jwtUser(token string) (*user.AuthUser, error) {
+	if s.jwt == nil {
+		return nil, auth.ErrInvalidToken
+	}
+	claims, err := s.jwt.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, auth.ErrInvalidToken
+	}
+
+	usr := user.AuthUser{
+		ID:              userID,
+		Name:            claims.Name,
+		Email:           claims.Email,
+		EmailVerifiedOn: claims.EmailVerifiedOn,
+	}
+	for _, g := range claims.Grants {
+		usr.Grants = append(usr.Grants, user.Grant{UserID: userID, Role: user.Role(g.Role), ContestID: g.ContestID})
+	}
+	return &usr, nil
+}
@@ -0,0 +1,10 @@
+package handlers
+
+import "photo-contest/foundation/metrics"
+
+// Counters of what users do, served with the other metrics on the debug
+// listener.
+var (
+	photosUploaded = metrics.NewCounter("photos_uploaded_total", "Photos uploaded and accepted into a contest.")
+	votesCast      = metrics.NewCounter("votes_cast_total", "Votes cast, and taken back with action=\"remove\".", "action")
+)
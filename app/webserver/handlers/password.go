@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"photo-contest/business/data/session"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"photo-contest/foundation/mail"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// ForgotPassword - emails a password reset link. The response is the same
+// whether the email is known or not so it can't be used to find accounts.
+func (s *Service) ForgotPassword(rw http.ResponseWriter, r *http.Request) error {
+	formData := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+	}
+
+	render := func(status int) error {
+		rw.WriteHeader(status)
+		return s.t.ExecuteTemplate(rw, "forgot_password.gohtml", formData)
+	}
+
+	if r.Method == "GET" {
+		return render(http.StatusOK)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+	email := strings.TrimSpace(r.Form.Get("email"))
+
+	store := user.NewStore(s.log, s.db)
+	usr, err := store.QueryByEmail(r.Context(), email)
+	switch {
+	case err == database.ErrNotFound:
+	case err != nil:
+		return err
+	default:
+		token, err := store.CreateResetToken(r.Context(), usr.ID, time.Now())
+		if err != nil {
+			return err
+		}
+
+		msg := mail.Message{
+			To:      usr.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hello %s,\n\nTo choose a new password open the link below. It expires in %s and can be used once.\n\n%s/reset-password/%s\n\nIf you didn't ask for this you can ignore this message.\n",
+				usr.Name, user.ResetTokenTTL, s.baseURL, token),
+		}
+		if err := s.mailer.Send(r.Context(), msg); err != nil {
+			return err
+		}
+	}
+
+	formData["Message"] = "If an account uses this email, a link to reset the password is on its way."
+	return render(http.StatusOK)
+}
+
+// ResetPassword - sets a new password using the token from a reset link
+func (s *Service) ResetPassword(rw http.ResponseWriter, r *http.Request) error {
+	token := mux.Vars(r)["token"]
+	formData := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"Token":          token,
+	}
+
+	render := func(status int) error {
+		// Keep the token out of referrers sent by the page.
+		rw.Header().Set("Referrer-Policy", "no-referrer")
+		rw.WriteHeader(status)
+		return s.t.ExecuteTemplate(rw, "reset_password.gohtml", formData)
+	}
+
+	store := user.NewStore(s.log, s.db)
+
+	if r.Method == "GET" {
+		if _, err := store.CheckResetToken(r.Context(), token, time.Now()); err != nil {
+			if err != user.ErrInvalidToken {
+				return err
+			}
+			formData["Message"] = err.Error()
+			formData["Invalid"] = true
+			return render(http.StatusNotFound)
+		}
+		return render(http.StatusOK)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+	np := user.NewPassword{
+		Pass:        r.Form.Get("password"),
+		PassConfirm: r.Form.Get("password_confirm"),
+	}
+
+	userID, err := store.ResetPassword(r.Context(), token, np, time.Now())
+	if err != nil {
+		var fe validate.FieldErrors
+		switch {
+		case errors.As(err, &fe):
+			formData["Message"] = err.Error()
+			return render(http.StatusBadRequest)
+		case err == user.ErrInvalidToken:
+			formData["Message"] = err.Error()
+			formData["Invalid"] = true
+			return render(http.StatusNotFound)
+		}
+		return err
+	}
+
+	// Whoever knew the old password is signed out everywhere.
+	if _, err := session.NewStore(s.log, s.db).DeleteByUser(r.Context(), userID, ""); err != nil {
+		return err
+	}
+
+	http.Redirect(rw, r, "/login", http.StatusFound)
+	return nil
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// SubmitPhoto - handles photo submissions to a contest
+func (s *Service) SubmitPhoto(rw http.ResponseWriter, r *http.Request) error {
+	usr, ok := r.Context().Value("user").(*user.AuthUser)
+	if !ok {
+		http.Redirect(rw, r, "/login", http.StatusFound)
+		return nil
+	}
+
+	c, err := s.requestContest(r)
+	if err != nil {
+		return err
+	}
+
+	formData := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Contest":        c,
+	}
+
+	render := func(status int) error {
+		rw.WriteHeader(status)
+		return s.t.ExecuteTemplate(rw, "submit.gohtml", formData)
+	}
+
+	if r.Method == "GET" {
+		return render(http.StatusOK)
+	}
+
+	// The body was capped before csrf.Protect read it; see the routes.
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		formData["Message"] = "The upload could not be read or is too large."
+		return render(http.StatusBadRequest)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		formData["Message"] = "Please choose a photo to upload."
+		return render(http.StatusBadRequest)
+	}
+	defer file.Close()
+
+	np := photo.NewPhoto{
+		ContestID: c.ID,
+		UserID:    usr.ID,
+		Title:     strings.TrimSpace(r.Form.Get("title")),
+		Caption:   strings.TrimSpace(r.Form.Get("caption")),
+		Category:  strings.TrimSpace(r.Form.Get("category")),
+	}
+	if _, err := s.submit(r.Context(), usr, c, file, np); err != nil {
+		var re *validate.RequestError
+		if errors.As(err, &re) {
+			formData["Message"] = re.Error()
+			return render(re.Status)
+		}
+		return err
+	}
+
+	formData["Message"] = "Your photo was submitted."
+	return render(http.StatusCreated)
+}
+
+// submit stores a photo submitted by a user to contest c along with its
+// renditions and metadata. Errors the user can do something about are
+// returned as *validate.RequestError.
+func (s *Service) submit(ctx context.Context, usr *user.AuthUser, c contest.Contest, file io.Reader, np photo.NewPhoto) (photo.Photo, error) {
+	if usr.HasRole(user.RoleJuror, c.ID) {
+		return photo.Photo{}, validate.NewRequestError(errors.New("Jurors can't enter the contest they judge."), http.StatusForbidden)
+	}
+	if !c.AcceptsSubmissions(time.Now()) {
+		return photo.Photo{}, validate.NewRequestError(errors.New("This contest is not accepting submissions."), http.StatusForbidden)
+	}
+
+	// Everything that can be checked without the file is, before it is
+	// written to the storage.
+	if err := validate.Check(np); err != nil {
+		var fe validate.FieldErrors
+		if errors.As(err, &fe) {
+			return photo.Photo{}, &validate.RequestError{Err: err, Status: http.StatusBadRequest, Fields: fe}
+		}
+		return photo.Photo{}, err
+	}
+	if err := c.CheckCategory(np.Category); err != nil {
+		return photo.Photo{}, validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	orig, err := s.photos.Save(file, s.limits)
+	if err != nil {
+		switch errors.Cause(err) {
+		case photo.ErrUnsupportedType, photo.ErrTooLarge, photo.ErrDimensions:
+			return photo.Photo{}, validate.NewRequestError(err, http.StatusBadRequest)
+		}
+		return photo.Photo{}, err
+	}
+
+	store := photo.NewStore(s.log, s.db)
+	p, err := s.record(ctx, store, c, np, orig)
+	if err != nil {
+		s.discard(ctx, store, orig)
+		return photo.Photo{}, err
+	}
+	s.log.Printf("photo %d (%s) submitted to contest %d by user %d", p.ID, p.SHA256, c.ID, usr.ID)
+	photosUploaded.Inc()
+
+	return p, nil
+}
+
+// record checks the saved original against the contest, makes its renditions
+// and records the photo.
+func (s *Service) record(ctx context.Context, store photo.Store, c contest.Contest, np photo.NewPhoto, orig photo.Original) (photo.Photo, error) {
+	meta, err := s.photos.EXIF(orig)
+	if err != nil {
+		if errors.Cause(err) == photo.ErrBadEXIF {
+			return photo.Photo{}, validate.NewRequestError(err, http.StatusBadRequest)
+		}
+		return photo.Photo{}, err
+	}
+	if err := c.CheckTakenOn(meta.TakenOn); err != nil {
+		return photo.Photo{}, validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	if err := s.photos.Derive(orig); err != nil {
+		return photo.Photo{}, err
+	}
+
+	p, err := store.Submit(ctx, np, orig, meta, time.Now())
+	if err != nil {
+		var fe validate.FieldErrors
+		switch {
+		case errors.As(err, &fe):
+			return photo.Photo{}, &validate.RequestError{Err: err, Status: http.StatusBadRequest, Fields: fe}
+		case err == photo.ErrDuplicate:
+			return photo.Photo{}, validate.NewRequestError(err, http.StatusConflict)
+		}
+		return photo.Photo{}, err
+	}
+	return p, nil
+}
+
+// discard removes the files of an original that was saved for a submission
+// that failed, unless a photo already stored uses the same bytes.
+func (s *Service) discard(ctx context.Context, store photo.Store, orig photo.Original) {
+	n, err := store.CountBySHA256(ctx, orig.SHA256)
+	if err != nil {
+		s.log.Printf("discarding %s: %s", orig.SHA256, err)
+		return
+	}
+	if n > 0 {
+		return
+	}
+	if err := s.photos.Remove(orig); err != nil {
+		s.log.Printf("discarding %s: %s", orig.SHA256, err)
+	}
+}
+
+// PhotoFile - serves a gallery rendition of a photo. Renditions never change
+// for a given photo, so they are served with long lived caching headers and an
+// ETag derived from the content hash. Originals are never served.
+func (s *Service) PhotoFile(rw http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+
+	size := photo.Size(vars["size"])
+	if _, ok := photo.Sizes[size]; !ok {
+		return database.ErrNotFound
+	}
+
+	photoID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return database.ErrNotFound
+	}
+
+	p, err := photo.NewStore(s.log, s.db).QueryByID(r.Context(), photoID)
+	if err != nil {
+		return err
+	}
+
+	// Renditions missing on disk are generated on the fly.
+	path := s.photos.DerivativePath(p.SHA256, size)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		if err := s.photos.Derive(p.Original()); err != nil {
+			return err
+		}
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", "image/jpeg")
+	rw.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	rw.Header().Set("ETag", `"`+p.SHA256+"-"+string(size)+`"`)
+	http.ServeContent(rw, r, "", fi.ModTime(), f)
+	return nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/result"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/pkg/errors"
+)
+
+// Results - displays the ranked entries of a contest. Once published the
+// frozen results are shown; before that the contest admin gets a preview
+// computed from the current scores and votes.
+func (s *Service) Results(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr, _ := ctx.Value("user").(*user.AuthUser)
+
+	c, err := s.requestContest(r)
+	if err != nil {
+		return err
+	}
+
+	store := result.NewStore(s.log, s.db)
+	var rs []result.Result
+	switch {
+	case c.ResultsVisible():
+		rs, err = store.QueryByContest(ctx, c.ID)
+	case c.Phase == contest.PhaseJudging && isContestAdmin(usr, c):
+		rs, err = store.Compute(ctx, c, time.Now())
+	default:
+		return database.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Contest":        c,
+		"Categories":     result.ByCategory(rs),
+		"Preview":        !c.ResultsVisible(),
+	}
+	return s.t.ExecuteTemplate(rw, "results.gohtml", data)
+}
+
+// PublishResults - freezes the results of a contest and publishes it. The
+// route must be guarded with RequireContestRole.
+func (s *Service) PublishResults(rw http.ResponseWriter, r *http.Request) error {
+	usr, _ := r.Context().Value("user").(*user.AuthUser)
+
+	c, err := s.requestContest(r)
+	if err != nil {
+		return err
+	}
+	switch _, err := result.NewStore(s.log, s.db).Publish(r.Context(), c, time.Now()); err {
+	case nil:
+	case contest.ErrInvalidPhase:
+		return validate.NewRequestError(errors.New("Only contests being judged can be published."), http.StatusConflict)
+	default:
+		return err
+	}
+	s.log.Printf("contest %d published by user %d", c.ID, usr.ID)
+
+	http.Redirect(rw, r, fmt.Sprintf("/contests/%d/results", c.ID), http.StatusFound)
+	return nil
+}
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"html/template"
 	"log"
 	"net/http"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/session"
 	"photo-contest/business/data/user"
-	"text/template"
+	"photo-contest/business/sys/auth"
+	"photo-contest/business/web"
+	"photo-contest/foundation/mail"
+	"strings"
 	"time"
 
 	"github.com/gorilla/sessions"
@@ -15,13 +21,26 @@ import (
 type Service struct {
 	log     *log.Logger
 	db      *sqlx.DB
-	session *sessions.CookieStore
+	session *session.CookieStore
 	t       *template.Template
-	//session *sqlitestore.SqliteStore
+	photos  photo.Storage
+	limits  photo.Limits
+	mailer  mail.Mailer
+	baseURL string
+
+	// verifyKey signs the email verification links.
+	verifyKey []byte
+
+	// jwt issues and validates the JSON Web Tokens of the API, valid for
+	// jwtTTL. It is nil when no signing key is configured.
+	jwt    *auth.Auth
+	jwtTTL time.Duration
 }
 
 // NewService initializes a new Serivice
-func NewService(l *log.Logger, db *sqlx.DB, sessionKey string) *Service {
+// baseURL is the public address of the site, used for links sent by email.
+// jwtAuth may be nil to turn JSON Web Tokens off.
+func NewService(l *log.Logger, db *sqlx.DB, sessionKey string, photos photo.Storage, limits photo.Limits, mailer mail.Mailer, baseURL string, verifyKey string, jwtAuth *auth.Auth, jwtTTL time.Duration) *Service {
 	// init template
 	funcMap := template.FuncMap{
 		"dayToDate": func(s string) string {
@@ -36,11 +55,7 @@ func NewService(l *log.Logger, db *sqlx.DB, sessionKey string) *Service {
 	templates := template.Must(template.New("tmpls").Funcs(funcMap).ParseGlob("var/templates/*.gohtml"))
 	//templates = templates.Funcs(funcMap)
 
-	sessStore := sessions.NewCookieStore([]byte(sessionKey))
-	/*sessStore, err := sqlitestore.NewSqliteStoreFromConnection(store.DB, "sessions", "/", 86400, []byte(*sessionKey))
-	if err != nil {
-		panic(err)
-	}*/
+	sessStore := session.NewCookieStore(session.NewStore(l, db), []byte(sessionKey))
 
 	sessStore.Options = &sessions.Options{
 		HttpOnly: true,
@@ -48,11 +63,11 @@ func NewService(l *log.Logger, db *sqlx.DB, sessionKey string) *Service {
 		MaxAge:   7 * 86400,
 	}
 
-	return &Service{log: l, db: db, t: templates, session: sessStore}
+	return &Service{log: l, db: db, t: templates, session: sessStore, photos: photos, limits: limits, mailer: mailer, baseURL: strings.TrimSuffix(baseURL, "/"), verifyKey: []byte(verifyKey), jwt: jwtAuth, jwtTTL: jwtTTL}
 }
 
 // Index - about this site
-func (s *Service) Index(rw http.ResponseWriter, r *http.Request) {
+func (s *Service) Index(rw http.ResponseWriter, r *http.Request) error {
 	var usr *user.AuthUser
 	userV := r.Context().Value("user")
 	if userV != nil {
@@ -65,13 +80,11 @@ func (s *Service) Index(rw http.ResponseWriter, r *http.Request) {
 		User:    usr,
 		Message: "",
 	}
-	if err := s.t.ExecuteTemplate(rw, "index.gohtml", data); err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
-	}
+	return s.t.ExecuteTemplate(rw, "index.gohtml", data)
 }
 
 // About - about this site
-func (s *Service) About(rw http.ResponseWriter, r *http.Request) {
+func (s *Service) About(rw http.ResponseWriter, r *http.Request) error {
 	var usr *user.AuthUser
 	userV := r.Context().Value("user")
 	if userV != nil {
@@ -82,24 +95,28 @@ func (s *Service) About(rw http.ResponseWriter, r *http.Request) {
 	}{
 		User: usr,
 	}
-	if err := s.t.ExecuteTemplate(rw, "about.gohtml", data); err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
-	}
+	return s.t.ExecuteTemplate(rw, "about.gohtml", data)
 }
 
-// Settings - display settings page
-func (s *Service) Settings(rw http.ResponseWriter, r *http.Request) {
-	usr := r.Context().Value("user").(*user.AuthUser)
+// respondError answers with err the way web.Errors does, for middleware
+// that has no handler to return it from.
+func (s *Service) respondError(rw http.ResponseWriter, r *http.Request, err error) {
+	web.Errors(s.log, s.ErrorPage)(func(http.ResponseWriter, *http.Request) error { return err })(rw, r)
+}
 
-	data := struct {
-		User *user.AuthUser
-	}{
-		User: usr,
+// ErrorPage - renders the page shown when a request failed. It is given to
+// web.Errors.
+func (s *Service) ErrorPage(rw http.ResponseWriter, r *http.Request, status int, msg string) {
+	usr, _ := r.Context().Value("user").(*user.AuthUser)
+	data := map[string]interface{}{
+		"User":    usr,
+		"Title":   http.StatusText(status),
+		"Message": msg,
 	}
 
-	log.Printf("data:%v+\n", data)
-
-	if err := s.t.ExecuteTemplate(rw, "settings.gohtml", data); err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(status)
+	if err := s.t.ExecuteTemplate(rw, "error.gohtml", data); err != nil {
+		s.log.Printf("rendering error.gohtml: %s", err)
 	}
 }
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"photo-contest/business/data/session"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/pkg/errors"
+)
+
+// Settings - display settings page with the active sessions of the user, who
+// can sign out any of them, the two-factor authentication setup and the API
+// tokens
+func (s *Service) Settings(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr, ok := ctx.Value("user").(*user.AuthUser)
+	if !ok {
+		http.Redirect(rw, r, "/login", http.StatusFound)
+		return nil
+	}
+
+	current, err := s.session.Get(r, "session")
+	if err != nil {
+		return err
+	}
+	currentID := session.StoredID(current.ID)
+
+	store := session.NewStore(s.log, s.db)
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"CurrentID":      currentID,
+		"Privileged":     len(usr.Grants) > 0,
+	}
+
+	render := func(status int) error {
+		sessions, err := store.QueryByUser(ctx, usr.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		data["Sessions"] = sessions
+		if err := s.twoFactorStatus(r, usr, data); err != nil {
+			return err
+		}
+		if err := s.tokenStatus(r, usr, data); err != nil {
+			return err
+		}
+
+		// Recovery codes and new API tokens are only ever shown on this
+		// response.
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.WriteHeader(status)
+		return s.t.ExecuteTemplate(rw, "settings.gohtml", data)
+	}
+
+	if r.Method == "GET" {
+		return render(http.StatusOK)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	handled, err := s.twoFactorSettings(r, usr, data)
+	if !handled && err == nil {
+		handled, err = s.tokenSettings(r, usr, data)
+	}
+	if err != nil {
+		return err
+	}
+	if handled {
+		switch {
+		case data["Message"] != nil:
+			return render(http.StatusBadRequest)
+		case data["RecoveryCodes"] != nil, data["NewToken"] != nil:
+			return render(http.StatusOK)
+		}
+		http.Redirect(rw, r, "/settings", http.StatusFound)
+		return nil
+	}
+
+	switch r.Form.Get("action") {
+	case "revoke":
+		err = store.Delete(ctx, r.Form.Get("session_id"), usr.ID)
+	case "revoke_others":
+		_, err = store.DeleteByUser(ctx, usr.ID, currentID)
+	default:
+		return validate.NewRequestError(errors.New("unknown action"), http.StatusBadRequest)
+	}
+	if err != nil {
+		return err
+	}
+	http.Redirect(rw, r, "/settings", http.StatusFound)
+	return nil
+}
+
+// AdminSessions - lets site admins see who is signed in and sign users out
+// everywhere. The route must be guarded with RequireRole(user.RoleSiteAdmin).
+func (s *Service) AdminSessions(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	usr, ok := ctx.Value("user").(*user.AuthUser)
+	if !ok {
+		return database.ErrForbidden
+	}
+
+	store := session.NewStore(s.log, s.db)
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			return validate.NewRequestError(err, http.StatusBadRequest)
+		}
+		userID, err := strconv.Atoi(r.Form.Get("user_id"))
+		if err != nil {
+			return validate.NewRequestError(validate.ErrInvalidID, http.StatusBadRequest)
+		}
+		n, err := store.DeleteByUser(ctx, userID, "")
+		if err != nil {
+			return err
+		}
+		s.log.Printf("user %d signed out user %d from %d sessions", usr.ID, userID, n)
+		http.Redirect(rw, r, "/admin/sessions", http.StatusFound)
+		return nil
+	}
+
+	active, err := store.QueryActive(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Sessions":       active,
+	}
+	return s.t.ExecuteTemplate(rw, "admin_sessions.gohtml", data)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"photo-contest/business/data/apitoken"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"photo-contest/foundation/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UserViaToken will retrieve the user owning the API token sent in the
+// Authorization header and set it in the request context, along with the
+// token under the "token" key. JSON Web Tokens are accepted too; their
+// user comes from the claims. Requests without a token are left for
+// UserViaSession; requests with a bad one are refused.
+func (a *Auth) UserViaToken(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		const bearer = "bearer "
+		if len(header) <= len(bearer) || !strings.EqualFold(header[:len(bearer)], bearer) {
+			web.Respond(w, validate.ErrorResponse{Error: "expected authorization header format: Bearer <token>"}, http.StatusUnauthorized)
+			return
+		}
+
+		secret := header[len(bearer):]
+		ctx := r.Context()
+
+		if isJWT(secret) {
+			usr, err := a.service.jwtUser(secret)
+			if err != nil {
+				web.Respond(w, validate.ErrorResponse{Error: err.Error()}, http.StatusUnauthorized)
+				return
+			}
+			web.SetUserID(ctx, usr.ID)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, "user", usr)))
+			return
+		}
+
+		tok, err := apitoken.NewStore(a.service.log, a.service.db).Authenticate(ctx, secret, time.Now())
+		if err != nil {
+			if err == apitoken.ErrInvalidToken {
+				web.Respond(w, validate.ErrorResponse{Error: err.Error()}, http.StatusUnauthorized)
+				return
+			}
+			a.service.respondError(w, r, err)
+			return
+		}
+
+		userGroup := user.NewStore(a.service.log, a.service.db)
+		usr, err := userGroup.QueryByID(ctx, tok.UserID)
+		if err != nil {
+			a.service.respondError(w, r, err)
+			return
+		}
+		usr.Grants, err = userGroup.QueryGrants(ctx, usr.ID)
+		if err != nil {
+			a.service.respondError(w, r, err)
+			return
+		}
+
+		web.SetUserID(ctx, usr.ID)
+		ctx = context.WithValue(ctx, "user", &usr)
+		ctx = context.WithValue(ctx, "token", tok)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// RequireScope will verify that a request authenticated with an API token
+// was given the scope. Requests authenticated by the session cookie are let
+// through: the user is acting in person.
+func (a *Auth) RequireScope(scope apitoken.Scope) func(http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if tok, ok := r.Context().Value("token").(apitoken.Token); ok && !tok.Allows(scope) {
+				msg := "the API token lacks the " + string(scope) + " scope"
+				web.Respond(w, validate.ErrorResponse{Error: msg}, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// tokenSettings handles the API token actions of the settings page. It
+// reports whether the action was one of them; data gets what the page shows
+// about the outcome.
+func (s *Service) tokenSettings(r *http.Request, usr *user.AuthUser, data map[string]interface{}) (handled bool, err error) {
+	ctx := r.Context()
+	store := apitoken.NewStore(s.log, s.db)
+	now := time.Now()
+
+	switch r.Form.Get("action") {
+	case "token_create":
+		nt := apitoken.NewToken{
+			UserID: usr.ID,
+			Name:   strings.TrimSpace(r.Form.Get("name")),
+		}
+		for _, scope := range r.Form["scope"] {
+			nt.Scopes = append(nt.Scopes, apitoken.Scope(scope))
+		}
+		if days, err := strconv.Atoi(r.Form.Get("expires_days")); err == nil && days > 0 {
+			expires := now.AddDate(0, 0, days)
+			nt.Expires = &expires
+		}
+
+		tok, secret, err := store.Create(ctx, nt, now)
+		if err != nil {
+			var fe validate.FieldErrors
+			if errors.As(err, &fe) {
+				data["Message"] = "Please name the token and pick at least one scope."
+				return true, nil
+			}
+			return true, err
+		}
+		s.log.Printf("user %d created API token %d", usr.ID, tok.ID)
+		data["NewToken"] = secret
+
+	case "token_revoke":
+		tokenID, _ := strconv.Atoi(r.Form.Get("token_id"))
+		if err := store.Revoke(ctx, tokenID, usr.ID); err != nil && err != database.ErrNotFound {
+			return true, err
+		}
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// tokenStatus adds the API tokens of the user to data for the settings page.
+func (s *Service) tokenStatus(r *http.Request, usr *user.AuthUser, data map[string]interface{}) error {
+	tokens, err := apitoken.NewStore(s.log, s.db).QueryByUser(r.Context(), usr.ID)
+	if err != nil {
+		return err
+	}
+	data["Tokens"] = tokens
+	data["Scopes"] = apitoken.Scopes
+	return nil
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"photo-contest/business/data/lockout"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/totp"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/skip2/go-qrcode"
+)
+
+// totpIssuer is the name authenticator apps list the account under.
+const totpIssuer = "Photo contest"
+
+// pendingLoginTTL is how long the user has to type the code once the
+// password was accepted.
+const pendingLoginTTL = 5 * time.Minute
+
+// LoginTwoFactor - second step of signing in for users with two-factor
+// authentication, who type a code from their app or a recovery code
+func (s *Service) LoginTwoFactor(rw http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	session, err := s.session.Get(r, "session")
+	if err != nil {
+		return err
+	}
+	userID, _ := session.Values["pending_user_id"].(int)
+	since, _ := session.Values["pending_since"].(int64)
+	now := time.Now()
+	if userID == 0 || now.Sub(time.Unix(since, 0)) > pendingLoginTTL {
+		http.Redirect(rw, r, "/login", http.StatusFound)
+		return nil
+	}
+
+	formData := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+	}
+
+	if r.Method == "GET" {
+		rw.Header().Add("Cache-Control", "no-cache")
+		return s.t.ExecuteTemplate(rw, "login_2fa.gohtml", formData)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	store := user.NewStore(s.log, s.db)
+	usr, err := store.QueryByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Codes are throttled like passwords, or six digits would not take
+	// long to guess.
+	keys := loginKeys(r, usr.Email)
+	wait, err := s.lockedOut(ctx, keys, now)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return s.renderLocked(rw, "login_2fa.gohtml", formData, wait)
+	}
+
+	switch err := store.CheckTOTP(ctx, usr.ID, r.Form.Get("code"), now); err {
+	case nil:
+	case user.ErrInvalidCode:
+		if err := s.failLogin(ctx, keys, now); err != nil {
+			return err
+		}
+		formData["Message"] = "Invalid code!"
+		return s.t.ExecuteTemplate(rw, "login_2fa.gohtml", formData)
+	default:
+		return err
+	}
+
+	if err := lockout.NewStore(s.log, s.db).Reset(ctx, lockout.KindAccount, keys[lockout.KindAccount]); err != nil {
+		return err
+	}
+
+	if err := s.session.Renew(r, session); err != nil {
+		return err
+	}
+	delete(session.Values, "pending_user_id")
+	delete(session.Values, "pending_since")
+	session.Values["logged_in"] = true
+	session.Values["user_id"] = usr.ID
+	session.Values["name"] = usr.Name
+	if err := session.Save(r, rw); err != nil {
+		return err
+	}
+
+	http.Redirect(rw, r, "/", http.StatusFound)
+	return nil
+}
+
+// twoFactorSettings handles the two-factor authentication actions of the
+// settings page. It reports whether the action was one of them; data gets
+// what the page shows about the outcome.
+func (s *Service) twoFactorSettings(r *http.Request, usr *user.AuthUser, data map[string]interface{}) (handled bool, err error) {
+	ctx := r.Context()
+	store := user.NewStore(s.log, s.db)
+	now := time.Now()
+
+	// Checks the code typed to confirm turning the protection down.
+	confirm := func() bool {
+		switch err := store.CheckTOTP(ctx, usr.ID, r.Form.Get("code"), now); err {
+		case nil:
+			return true
+		case user.ErrInvalidCode:
+			data["Message"] = "Invalid code!"
+		default:
+			data["Message"] = err.Error()
+		}
+		return false
+	}
+
+	switch r.Form.Get("action") {
+	case "totp_begin":
+		if _, err := store.BeginTOTP(ctx, usr.ID); err != nil && err != user.ErrTOTPEnabled {
+			return true, err
+		}
+
+	case "totp_enable":
+		codes, err := store.EnableTOTP(ctx, usr.ID, r.Form.Get("code"), now)
+		switch err {
+		case nil:
+			data["RecoveryCodes"] = codes
+		case user.ErrInvalidCode, user.ErrTOTPEnabled, user.ErrTOTPNotEnabled:
+			data["Message"] = err.Error()
+		default:
+			return true, err
+		}
+
+	case "totp_disable":
+		if confirm() {
+			if err := store.DisableTOTP(ctx, usr.ID); err != nil {
+				return true, err
+			}
+		}
+
+	case "recovery_codes":
+		if confirm() {
+			codes, err := store.RegenerateRecoveryCodes(ctx, usr.ID, now)
+			if err != nil {
+				return true, err
+			}
+			data["RecoveryCodes"] = codes
+		}
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// twoFactorStatus adds what the settings page shows about two-factor
+// authentication to data: whether it is on, how many recovery codes are
+// left, or the secret to enroll while it is being set up.
+func (s *Service) twoFactorStatus(r *http.Request, usr *user.AuthUser, data map[string]interface{}) error {
+	ctx := r.Context()
+	store := user.NewStore(s.log, s.db)
+
+	// The user in the context may predate an action of this request.
+	fresh, err := store.QueryByID(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	data["TOTPEnabled"] = fresh.TOTPEnabled()
+
+	if fresh.TOTPEnabled() {
+		left, err := store.RecoveryCodesLeft(ctx, usr.ID)
+		if err != nil {
+			return err
+		}
+		data["RecoveryCodesLeft"] = left
+		return nil
+	}
+
+	secret, err := store.PendingTOTP(ctx, usr.ID)
+	if err != nil || secret == "" {
+		return err
+	}
+	uri := totp.URI(totpIssuer, usr.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return err
+	}
+	data["TOTPSecret"] = secret
+	data["TOTPURI"] = uri
+	// A data URI is not a URL html/template trusts on its own.
+	data["TOTPQR"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	return nil
+}
@@ -3,25 +3,30 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"photo-contest/business/data/lockout"
 	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
 	"photo-contest/foundation/database"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
 // UserSignUp - handles user signup
-func (s *Service) UserSignUp(rw http.ResponseWriter, r *http.Request) {
+func (s *Service) UserSignUp(rw http.ResponseWriter, r *http.Request) error {
 
 	formData := map[string]interface{}{
 		csrf.TemplateTag: csrf.TemplateField(r),
 	}
 	if r.Method == "GET" {
-		if err := s.t.ExecuteTemplate(rw, "register.gohtml", formData); err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
-		}
+		return s.t.ExecuteTemplate(rw, "register.gohtml", formData)
 	} else if r.Method == "POST" {
 		r.ParseForm()
 
@@ -30,18 +35,15 @@ func (s *Service) UserSignUp(rw http.ResponseWriter, r *http.Request) {
 		password := strings.Trim(r.Form.Get("password"), " ")
 		password_confirm := strings.Trim(r.Form.Get("password_confirm"), " ")
 
-		log.Println("trying to find user w:", email, password)
-
 		userGroup := user.NewStore(s.log, s.db)
 
-		_, err := userGroup.QueryByEmail(email)
-		s.log.Println("from GetUser:", err)
-		if err != nil && err != database.ErrNotFound {
+		_, err := userGroup.QueryByEmail(r.Context(), email)
+		switch {
+		case err == nil:
 			formData["Message"] = "This email is already in use."
-			if err := s.t.ExecuteTemplate(rw, "register.gohtml", formData); err != nil {
-				http.Error(rw, err.Error(), http.StatusInternalServerError)
-			}
-			return
+			return s.t.ExecuteTemplate(rw, "register.gohtml", formData)
+		case err != database.ErrNotFound:
+			return err
 		}
 
 		newUser := user.NewAuthUser{
@@ -51,25 +53,26 @@ func (s *Service) UserSignUp(rw http.ResponseWriter, r *http.Request) {
 			PassConfirm: password_confirm,
 		}
 
-		usr, err := userGroup.Create(newUser)
-		fmt.Printf("usr = %+v\n", usr)
-		fmt.Printf("err = %+v\t%T\n", err, err)
+		usr, err := userGroup.Create(r.Context(), newUser)
 		if err != nil {
-			log.Println(err)
-			formData["Message"] = err.Error()
-			if err := s.t.ExecuteTemplate(rw, "register.gohtml", formData); err != nil {
-				//http.Error(rw, err.Error(), http.StatusInternalServerError)
+			var fe validate.FieldErrors
+			if !errors.As(err, &fe) {
+				return err
 			}
-			//http.Error(rw, "Unable to sign user up", http.StatusInternalServerError)
-			return
+			formData["Message"] = fe.Error()
+			return s.t.ExecuteTemplate(rw, "register.gohtml", formData)
 		} else {
-			//s.log.Printf("user: %#v", usr)
-			http.Redirect(rw, r, "/login", http.StatusFound)
+			if err := s.sendVerification(r.Context(), usr); err != nil {
+				s.log.Printf("sending verification to user %d: %s", usr.ID, err)
+			}
+			formData["Message"] = "Welcome! Check your email for a link to verify your address, then log in."
+			return s.t.ExecuteTemplate(rw, "login.gohtml", formData)
 		}
 	}
+	return nil
 }
 
-func (s *Service) UserLogIn(rw http.ResponseWriter, r *http.Request) {
+func (s *Service) UserLogIn(rw http.ResponseWriter, r *http.Request) error {
 
 	formData := map[string]interface{}{
 		csrf.TemplateTag: csrf.TemplateField(r),
@@ -78,63 +81,86 @@ func (s *Service) UserLogIn(rw http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
 
 		rw.Header().Add("Cache-Control", "no-cache")
-		if err := s.t.ExecuteTemplate(rw, "login.gohtml", formData); err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
-		}
+		return s.t.ExecuteTemplate(rw, "login.gohtml", formData)
 	} else if r.Method == "POST" {
 
 		if err := r.ParseForm(); err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
-			return
+			return validate.NewRequestError(err, http.StatusBadRequest)
 		}
 
 		email := strings.Trim(r.Form.Get("email"), " ")
 		password := strings.Trim(r.Form.Get("password"), " ")
 
+		keys := loginKeys(r, email)
+		now := time.Now()
+		wait, err := s.lockedOut(r.Context(), keys, now)
+		if err != nil {
+			return err
+		}
+		if wait > 0 {
+			return s.renderLocked(rw, "login.gohtml", formData, wait)
+		}
+
 		userGroup := user.NewStore(s.log, s.db)
-		//if err != nil {
-		//	//http.Error(rw, err.Error(), http.StatusInternalServerError)
-		//} else
-		usr, err := userGroup.Authenticate(email, password)
-		//log.Printf("usr = %+v\n", usr)
-		//log.Printf("err = %+v\n", err)
+		usr, err := userGroup.Authenticate(r.Context(), email, password)
+		if err != nil && err != database.ErrAuthenticationFailure && err != database.ErrNotFound {
+			return err
+		}
 		if err == nil && usr != nil {
 			session, err := s.session.Get(r, "session")
 			if err != nil {
-				http.Error(rw, err.Error(), http.StatusInternalServerError)
-				return
+				return err
+			}
+
+			// Sign in under a new token so one planted before can't be used.
+			if err := s.session.Renew(r, session); err != nil {
+				return err
 			}
 
+			// With two-factor authentication the password only gets the
+			// user to the second step; logged_in is set once the code is
+			// checked.
+			if usr.TOTPEnabled() {
+				session.Values["pending_user_id"] = usr.ID
+				session.Values["pending_since"] = now.Unix()
+				if err := session.Save(r, rw); err != nil {
+					return err
+				}
+				http.Redirect(rw, r, "/login/2fa", http.StatusFound)
+				return nil
+			}
+
+			if err := lockout.NewStore(s.log, s.db).Reset(r.Context(), lockout.KindAccount, keys[lockout.KindAccount]); err != nil {
+				return err
+			}
 			session.Values["logged_in"] = true
 			session.Values["user_id"] = usr.ID
 			session.Values["name"] = usr.Name
 
-			err = session.Save(r, rw)
-			if err != nil {
-				log.Printf("err = %+v\n", err)
-				http.Error(rw, err.Error(), http.StatusInternalServerError)
-				return
+			if err := session.Save(r, rw); err != nil {
+				return err
 			}
 
-			log.Println("all's good. will be redirecting to / now..")
+			web.SetUserID(r.Context(), usr.ID)
 			http.Redirect(rw, r, "/", http.StatusFound)
-			return
+			return nil
 		}
 
-		formData["Message"] = "Invalid email or password!"
-		if err := s.t.ExecuteTemplate(rw, "login.gohtml", formData); err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		if err := s.failLogin(r.Context(), keys, now); err != nil {
+			return err
 		}
+		formData["Message"] = "Invalid email or password!"
+		return s.t.ExecuteTemplate(rw, "login.gohtml", formData)
 	}
+	return nil
 }
 
 // UserLogOut - clears the session
-func (s *Service) UserLogOut(rw http.ResponseWriter, r *http.Request) {
+func (s *Service) UserLogOut(rw http.ResponseWriter, r *http.Request) error {
 
 	session, err := s.session.Get(r, "session")
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	session.Values["logged_in"] = false
@@ -142,10 +168,10 @@ func (s *Service) UserLogOut(rw http.ResponseWriter, r *http.Request) {
 
 	err = session.Save(r, rw)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 	http.Redirect(rw, r, "/", http.StatusFound)
+	return nil
 }
 
 // UserAuth provides middleware functions for authorizing users and setting the user
@@ -169,12 +195,17 @@ func NewAuth(s *Service) Auth {
 func (a *Auth) UserViaSession(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		// A user authenticated by an API token takes precedence.
+		if _, ok := r.Context().Value("user").(*user.AuthUser); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		session, err := a.service.session.Get(r, "session")
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
-		//a.Service.log.Printf("logged_in: %v\t%T", session.Values["logged_in"], session.Values["logged_in"])
 		if session.Values["logged_in"] != true {
 			next.ServeHTTP(w, r)
 			return
@@ -183,7 +214,7 @@ func (a *Auth) UserViaSession(next http.Handler) http.HandlerFunc {
 		user_id, _ := session.Values["user_id"].(int)
 
 		userGroup := user.NewStore(a.service.log, a.service.db)
-		usr, err := userGroup.QueryByID(user_id)
+		usr, err := userGroup.QueryByID(r.Context(), user_id)
 		if err != nil {
 			// If you want you can retain the original functionality to call
 			// http.Error if any error aside from app.ErrNotFound is returned,
@@ -193,6 +224,13 @@ func (a *Auth) UserViaSession(next http.Handler) http.HandlerFunc {
 			next.ServeHTTP(w, r)
 			return
 		}
+		usr.Grants, err = userGroup.QueryGrants(r.Context(), usr.ID)
+		if err != nil {
+			// Without the grants the user would silently lose their roles.
+			a.service.respondError(w, r, err)
+			return
+		}
+		web.SetUserID(r.Context(), usr.ID)
 		r = r.WithContext(context.WithValue(r.Context(), "user", &usr))
 		next.ServeHTTP(w, r)
 	}
@@ -205,15 +243,153 @@ func (a *Auth) RequireUser(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tmp := r.Context().Value("user")
 		if tmp == nil {
-			http.Redirect(w, r, "/login", http.StatusFound)
+			requireSignIn(w, r)
 			return
 		}
 		if _, ok := tmp.(*user.AuthUser); !ok {
 			// Whatever was set in the user key isn't a user, so we probably need to
 			// sign in.
-			http.Redirect(w, r, "/login", http.StatusFound)
+			requireSignIn(w, r)
 			return
 		}
 		next.ServeHTTP(w, r)
 	}
 }
+
+// requireSignIn sends visitors to the sign in page, or tells API clients
+// they need to authenticate.
+func requireSignIn(w http.ResponseWriter, r *http.Request) {
+	if web.IsAPI(r) {
+		web.Respond(w, validate.ErrorResponse{Error: "authentication required"}, http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// RequireRole will verify that the user set in the request context holds
+// one of the given roles site wide. Users that are not signed in are
+// redirected to the sign in page, others get a 403.
+func (a *Auth) RequireRole(roles ...user.Role) func(http.Handler) http.HandlerFunc {
+	return a.requireRole(func(r *http.Request) int { return 0 }, roles)
+}
+
+// RequireContestRole works like RequireRole but also accepts roles granted
+// for the contest named by the "id" route variable.
+func (a *Auth) RequireContestRole(roles ...user.Role) func(http.Handler) http.HandlerFunc {
+	return a.requireRole(func(r *http.Request) int {
+		contestID, _ := strconv.Atoi(mux.Vars(r)["id"])
+		return contestID
+	}, roles)
+}
+
+// requireRole builds the middleware checking roles for the contest returned
+// by contestID.
+func (a *Auth) requireRole(contestID func(r *http.Request) int, roles []user.Role) func(http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			usr, ok := r.Context().Value("user").(*user.AuthUser)
+			if !ok {
+				requireSignIn(w, r)
+				return
+			}
+			id := contestID(r)
+			for _, role := range roles {
+				if usr.HasRole(role, id) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			a.service.respondError(w, r, database.ErrForbidden)
+		}
+	}
+}
+
+// RequireVerifiedEmail will verify that the user set in the request context
+// verified their email address. Others are shown how to verify it instead of
+// calling the next handler. It must run after RequireUser.
+func (a *Auth) RequireVerifiedEmail(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usr, ok := r.Context().Value("user").(*user.AuthUser)
+		if !ok {
+			requireSignIn(w, r)
+			return
+		}
+		if usr.EmailVerified() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		const msg = "Please verify your email address first."
+		if web.IsAPI(r) {
+			web.Respond(w, validate.ErrorResponse{Error: msg}, http.StatusForbidden)
+			return
+		}
+		a.service.renderVerifyEmail(w, r, usr, msg, http.StatusForbidden)
+	}
+}
+
+// loginKeys returns what failed sign in attempts are counted against: the
+// account, whether it exists or not, and the address the attempts come from.
+func loginKeys(r *http.Request, email string) map[lockout.Kind]string {
+	return map[lockout.Kind]string{
+		lockout.KindAccount: strings.ToLower(strings.TrimSpace(email)),
+		lockout.KindIP:      clientIP(r),
+	}
+}
+
+// lockedOut returns how long sign in attempts are refused for, or 0 when
+// neither the account nor the address is locked.
+func (s *Service) lockedOut(ctx context.Context, keys map[lockout.Kind]string, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	store := lockout.NewStore(s.log, s.db)
+	for kind, key := range keys {
+		th, err := store.Query(ctx, kind, key)
+		if err != nil {
+			return 0, err
+		}
+		if th.Locked(now) && th.LockedUntil.Sub(now) > wait {
+			wait = th.LockedUntil.Sub(now)
+		}
+	}
+	return wait, nil
+}
+
+// failLogin records a failed sign in attempt.
+func (s *Service) failLogin(ctx context.Context, keys map[lockout.Kind]string, now time.Time) error {
+	store := lockout.NewStore(s.log, s.db)
+	for kind, key := range keys {
+		if _, err := store.Fail(ctx, kind, key, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderLocked tells the user to come back once the lockout is over.
+func (s *Service) renderLocked(rw http.ResponseWriter, tmpl string, data map[string]interface{}, wait time.Duration) error {
+	wait = setRetryAfter(rw, wait)
+	data["Message"] = fmt.Sprintf("Too many failed attempts. Try again in %s.", wait)
+	rw.WriteHeader(http.StatusTooManyRequests)
+	return s.t.ExecuteTemplate(rw, tmpl, data)
+}
+
+// setRetryAfter tells the client how long to wait, in whole seconds, and
+// returns the rounded duration.
+func setRetryAfter(rw http.ResponseWriter, wait time.Duration) time.Duration {
+	wait = wait.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	rw.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())))
+	return wait
+}
+
+// clientIP returns the address the request came from, which web.Proxies
+// already took from X-Forwarded-For for requests relayed by a trusted proxy.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
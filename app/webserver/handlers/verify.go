@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"photo-contest/business/data/user"
+	"photo-contest/foundation/mail"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+)
+
+// sendVerification emails the user a signed link to verify their address.
+func (s *Service) sendVerification(ctx context.Context, usr user.AuthUser) error {
+	token := user.NewVerifyToken(s.verifyKey, usr, time.Now())
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nTo verify your email address open the link below. It expires in %s.\n\n%s/verify-email/%s\n",
+			usr.Name, user.VerifyTokenTTL, s.baseURL, token),
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// VerifyEmail - marks the email address as verified using the emailed link
+func (s *Service) VerifyEmail(rw http.ResponseWriter, r *http.Request) error {
+	usr, _ := r.Context().Value("user").(*user.AuthUser)
+
+	verified, err := user.NewStore(s.log, s.db).VerifyEmail(r.Context(), s.verifyKey, mux.Vars(r)["token"], time.Now())
+	switch err {
+	case nil:
+		return s.renderVerifyEmail(rw, r, &verified, "Thank you, your email address is verified.", http.StatusOK)
+	case user.ErrInvalidVerification:
+		return s.renderVerifyEmail(rw, r, usr, err.Error(), http.StatusNotFound)
+	}
+	return err
+}
+
+// VerifyEmailStatus - tells the user whether their address is verified and
+// lets them ask for a new link
+func (s *Service) VerifyEmailStatus(rw http.ResponseWriter, r *http.Request) error {
+	usr := r.Context().Value("user").(*user.AuthUser)
+
+	if r.Method == "GET" || usr.EmailVerified() {
+		return s.renderVerifyEmail(rw, r, usr, "", http.StatusOK)
+	}
+
+	if err := s.sendVerification(r.Context(), *usr); err != nil {
+		return err
+	}
+	return s.renderVerifyEmail(rw, r, usr, fmt.Sprintf("A new link was sent to %s.", usr.Email), http.StatusOK)
+}
+
+// renderVerifyEmail renders the email verification page.
+func (s *Service) renderVerifyEmail(rw http.ResponseWriter, r *http.Request, usr *user.AuthUser, message string, status int) error {
+	data := map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"User":           usr,
+		"Message":        message,
+	}
+
+	rw.WriteHeader(status)
+	return s.t.ExecuteTemplate(rw, "verify_email.gohtml", data)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/user"
+	"photo-contest/business/data/vote"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"photo-contest/foundation/database"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// VotePhoto - casts a vote of the current user for a photo
+func (s *Service) VotePhoto(rw http.ResponseWriter, r *http.Request) error {
+	return s.handleVote(rw, r, true)
+}
+
+// UnvotePhoto - takes back the vote of the current user for a photo
+func (s *Service) UnvotePhoto(rw http.ResponseWriter, r *http.Request) error {
+	return s.handleVote(rw, r, false)
+}
+
+// handleVote casts or removes a vote. Requests that accept JSON get the
+// live count back, others are redirected to the contest page.
+func (s *Service) handleVote(rw http.ResponseWriter, r *http.Request, cast bool) error {
+	ctx := r.Context()
+
+	usr, ok := ctx.Value("user").(*user.AuthUser)
+	if !ok {
+		http.Redirect(rw, r, "/login", http.StatusFound)
+		return nil
+	}
+
+	photoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return validate.NewRequestError(validate.ErrInvalidID, http.StatusBadRequest)
+	}
+
+	p, err := photo.NewStore(s.log, s.db).QueryByID(ctx, photoID)
+	if err != nil {
+		return err
+	}
+
+	c, err := contest.NewStore(s.log, s.db).QueryByID(ctx, p.ContestID)
+	if err != nil {
+		return err
+	}
+
+	// Pages show why the vote failed on the contest page; JSON clients get
+	// the error as it is.
+	if err := s.vote(ctx, usr, c, p, cast); err != nil {
+		var re *validate.RequestError
+		if errors.As(err, &re) && !web.IsAPI(r) {
+			return s.renderContest(rw, r, c, usr, re.Error(), re.Status)
+		}
+		return err
+	}
+
+	if !web.IsAPI(r) {
+		http.Redirect(rw, r, fmt.Sprintf("/contests/%d", c.ID), http.StatusFound)
+		return nil
+	}
+
+	status, err := s.voteStatus(ctx, usr, c, p)
+	if err != nil {
+		return err
+	}
+	web.Respond(rw, status, http.StatusOK)
+	return nil
+}
+
+// vote casts or takes back the vote of a user for a photo of contest c.
+// Errors the user can do something about are returned as
+// *validate.RequestError.
+func (s *Service) vote(ctx context.Context, usr *user.AuthUser, c contest.Contest, p photo.Photo, cast bool) error {
+	if !c.AcceptsVotes() {
+		return validate.NewRequestError(errors.New("Voting is closed for this contest."), http.StatusForbidden)
+	}
+	if usr.HasRole(user.RoleJuror, c.ID) {
+		return validate.NewRequestError(errors.New("Jurors can't vote in the contest they judge."), http.StatusForbidden)
+	}
+
+	votes := vote.NewStore(s.log, s.db)
+	var err error
+	if cast {
+		v := vote.Vote{UserID: usr.ID, PhotoID: p.ID, ContestID: c.ID}
+		err = votes.Cast(ctx, v, c.VoteBudget, time.Now())
+	} else {
+		err = votes.Remove(ctx, usr.ID, p.ID)
+	}
+	switch err {
+	case nil:
+		if cast {
+			votesCast.Inc("cast")
+		} else {
+			votesCast.Inc("remove")
+		}
+		return nil
+	case vote.ErrAlreadyVoted, vote.ErrBudgetExhausted:
+		return validate.NewRequestError(err, http.StatusConflict)
+	case database.ErrNotFound:
+		return validate.NewRequestError(errors.New("You haven't voted for this photo."), http.StatusConflict)
+	default:
+		return err
+	}
+}
+
+// voteStatus is the live vote count of a photo as seen by a user.
+type voteStatus struct {
+	PhotoID   int  `json:"photo_id"`
+	Votes     int  `json:"votes"`
+	Voted     bool `json:"voted"`
+	VotesLeft int  `json:"votes_left"`
+}
+
+// voteStatus returns the vote count of a photo and the votes the user has
+// left in the contest.
+func (s *Service) voteStatus(ctx context.Context, usr *user.AuthUser, c contest.Contest, p photo.Photo) (voteStatus, error) {
+	votes := vote.NewStore(s.log, s.db)
+	count, err := votes.Count(ctx, p.ID)
+	if err != nil {
+		return voteStatus{}, err
+	}
+	mine, err := votes.QueryByUserContest(ctx, usr.ID, c.ID)
+	if err != nil {
+		return voteStatus{}, err
+	}
+
+	status := voteStatus{
+		PhotoID:   p.ID,
+		Votes:     count,
+		VotesLeft: c.VoteBudget - len(mine),
+	}
+	for _, v := range mine {
+		if v.PhotoID == p.ID {
+			status.Voted = true
+		}
+	}
+	return status, nil
+}
@@ -5,12 +5,22 @@ import (
 	"expvar"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
 	"photo-contest/app/webserver/handlers"
+	"photo-contest/business/data/apitoken"
+	"photo-contest/business/data/backup"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/session"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/auth"
 	"photo-contest/business/web"
 	"photo-contest/foundation/database"
+	"photo-contest/foundation/keystore"
+	"photo-contest/foundation/mail"
+	"photo-contest/foundation/metrics"
 	"syscall"
 	"time"
 
@@ -37,18 +47,62 @@ func run(log *log.Logger) error {
 	var cfg struct {
 		conf.Version
 		Web struct {
-			BindAddress  string        `conf:"default:0.0.0.0:8080"`
-			SessionKey   string        `conf:"default:abc123XYZ"`
-			CsrfKey      string        `conf:"default:abcqwertxyz"`
-			IdleTimeout  time.Duration `conf:"default:5s"`
-			ReadTimeout  time.Duration `conf:"default:5s"`
-			WriteTimeout time.Duration `conf:"default:5s"`
+			BindAddress string `conf:"default:0.0.0.0:8080"`
+			// DebugBindAddress serves the health probes, profiling
+			// and metrics. Keep it off the public network.
+			DebugBindAddress string        `conf:"default:127.0.0.1:4000"`
+			PublicURL        string        `conf:"default:http://localhost:8080"`
+			SessionKey       string        `conf:"default:abc123XYZ"`
+			CsrfKey          string        `conf:"default:abcqwertxyz"`
+			VerifyKey        string        `conf:"default:qwe789VerifyKey"`
+			IdleTimeout      time.Duration `conf:"default:5s"`
+			ReadTimeout      time.Duration `conf:"default:5s"`
+			WriteTimeout     time.Duration `conf:"default:5s"`
+			// TrustedProxies are the addresses or CIDR ranges of the
+			// reverse proxies whose X-Forwarded-For is believed,
+			// separated by semicolons.
+			TrustedProxies []string
 		}
 		DB struct {
+			// Driver is sqlite3 or postgres. SQLite uses the file at
+			// Path, Postgres the database Name on Host.
+			Driver      string `conf:"default:sqlite3"`
 			Path        string `conf:"default:var/db.db"`
 			Mode        string `conf:"default:rw"`
 			JournalMode string `conf:"default:WAL"`
 			Cache       string `conf:"default:shared"`
+			Host        string `conf:"default:localhost:5432"`
+			User        string `conf:"default:postgres"`
+			Password    string `conf:"default:postgres,mask"`
+			Name        string `conf:"default:photoc"`
+			DisableTLS  bool   `conf:"default:false"`
+		}
+		Photos struct {
+			Path    string `conf:"default:var/photos"`
+			MaxSize int64  `conf:"default:20971520"`
+		}
+		Sessions struct {
+			SweepInterval time.Duration `conf:"default:1h"`
+		}
+		Backup struct {
+			// Interval between backups of a SQLite database; 0
+			// turns them off. Keep is the number of archives kept.
+			Dir      string        `conf:"default:var/backups"`
+			Interval time.Duration `conf:"default:24h"`
+			Keep     int           `conf:"default:7"`
+			Manifest bool          `conf:"default:true"`
+		}
+		Auth struct {
+			// KeysDir holds the keys signing JSON Web Tokens, one
+			// <key ID>.pem file each. Tokens are only issued when
+			// ActiveKID names one of them.
+			KeysDir   string `conf:"default:var/keys"`
+			ActiveKID string
+			TokenTTL  time.Duration `conf:"default:15m"`
+		}
+		Mail struct {
+			// Dir is where messages are written. They are only logged when empty.
+			Dir string
 		}
 	}
 	cfg.Version.SVN = build
@@ -90,10 +144,16 @@ func run(log *log.Logger) error {
 	//----------------------------------------------------
 	// init DB
 	db, err := database.Open(database.Config{
+		Driver:      cfg.DB.Driver,
 		Path:        cfg.DB.Path,
 		Mode:        cfg.DB.Mode,
 		Cache:       cfg.DB.Cache,
 		JournalMode: cfg.DB.JournalMode,
+		Host:        cfg.DB.Host,
+		User:        cfg.DB.User,
+		Password:    cfg.DB.Password,
+		Name:        cfg.DB.Name,
+		DisableTLS:  cfg.DB.DisableTLS,
 	})
 
 	if err != nil {
@@ -101,44 +161,205 @@ func run(log *log.Logger) error {
 		return errors.Wrap(err, "connecting to db")
 	}
 	defer func() {
-		log.Printf("main: Database Stopping: %s", cfg.DB.Path)
+		log.Printf("main: Database Stopping: %s", db.DriverName())
 		db.Close()
 	}()
 
 	//dataStore := &data.DataStore{DB: db, L: log}
 
-	sqliteVersion, _ := database.GetSQLiteVersion(db)
-	log.Println("using SQLite version", sqliteVersion)
+	dbVersion, _ := database.GetVersion(context.Background(), db)
+	log.Println("using", db.DriverName(), "version", dbVersion)
 
 	log.Println("about to start server on ", cfg.Web.BindAddress)
 
-	service := handlers.NewService(log, db, cfg.Web.SessionKey)
+	limits := photo.DefaultLimits
+	limits.MaxBytes = cfg.Photos.MaxSize
+	photos := photo.NewStorage(cfg.Photos.Path)
+	if err := os.MkdirAll(cfg.Photos.Path, 0755); err != nil {
+		return errors.Wrap(err, "creating photo storage")
+	}
+
+	// =========================================================================
+	// Start Debug Service
+	//
+	// /debug/liveness - the process is up
+	// /debug/readiness - the database and photo storage can be used
+	// /debug/pprof - profiling
+	// /debug/vars - expvars
+	// /metrics - metrics in the Prometheus text format
+
+	debugMux := handlers.DebugMux(build, log, db, photos)
+	go func() {
+		log.Printf("main: Debug listening %s", cfg.Web.DebugBindAddress)
+		if err := http.ListenAndServe(cfg.Web.DebugBindAddress, debugMux); err != nil {
+			log.Printf("main: Debug listener closed: %s", err)
+		}
+	}()
+
+	var mailer mail.Mailer = mail.NewLogMailer(log)
+	if cfg.Mail.Dir != "" {
+		mailer = mail.NewFileMailer(cfg.Mail.Dir)
+	}
+
+	// Expired sessions are removed in the background until shutdown.
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go session.NewStore(log, db).Sweep(sweepCtx, cfg.Sessions.SweepInterval)
+
+	// So is the database backed up. Postgres is left to its own tools.
+	if cfg.Backup.Interval > 0 {
+		if db.DriverName() == database.DriverSQLite {
+			bcfg := backup.Config{
+				DBPath: cfg.DB.Path,
+				Dir:    cfg.Backup.Dir,
+				Keep:   cfg.Backup.Keep,
+			}
+			if cfg.Backup.Manifest {
+				bcfg.Photos = &photos
+			}
+			go backup.NewArchiver(log, bcfg).Run(sweepCtx, cfg.Backup.Interval)
+		} else {
+			log.Printf("main: Backups are only made of SQLite databases")
+		}
+	}
+
+	metrics.NewGaugeFunc("sessions_active", "Signed in sessions that haven't expired.", func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		n, err := session.NewStore(log, db).CountActive(ctx, time.Now())
+		if err != nil {
+			log.Printf("main: counting active sessions: %s", err)
+			return math.NaN()
+		}
+		return float64(n)
+	})
+
+	var jwtAuth *auth.Auth
+	if cfg.Auth.ActiveKID != "" {
+		keys, err := keystore.NewFS(cfg.Auth.KeysDir)
+		if err != nil {
+			return errors.Wrap(err, "loading keys")
+		}
+		jwtAuth, err = auth.New(cfg.Auth.ActiveKID, keys)
+		if err != nil {
+			return errors.Wrap(err, "constructing auth")
+		}
+
+		// Keys rotated on disk are picked up on SIGHUP.
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		go func() {
+			for range hupChan {
+				if err := keys.Reload(); err != nil {
+					log.Printf("main: reloading keys: %s", err)
+					continue
+				}
+				log.Println("main: keys reloaded")
+			}
+		}()
+	} else {
+		log.Println("main: no active key, JSON Web Tokens are turned off")
+	}
+
+	service := handlers.NewService(log, db, cfg.Web.SessionKey, photos, limits, mailer, cfg.Web.PublicURL, cfg.Web.VerifyKey, jwtAuth, cfg.Auth.TokenTTL)
 
 	// auth midleware...
 	authMw := handlers.NewAuth(service)
 
+	// Handlers return their errors; errs turns them into a JSON response
+	// for the API and an error page for everything else.
+	errs := web.Errors(log, service.ErrorPage)
+
 	sm := mux.NewRouter()
-	sm.Handle("/", web.WrapMiddleware(service.Index, authMw.UserViaSession))
-	sm.Handle("/about", web.WrapMiddleware(service.About, authMw.UserViaSession))
+	sm.Handle("/", web.WrapMiddleware(errs(service.Index), authMw.UserViaSession))
+	sm.Handle("/about", web.WrapMiddleware(errs(service.About), authMw.UserViaSession))
 
-	sm.Handle("/settings", web.WrapMiddleware(service.Settings, authMw.UserViaSession, authMw.RequireUser))
-	//sm.Handle("/updategroup/{id:[0-9]+}", web.WrapMiddleware(service.UpdateGroup, authMw.UserViaSession, authMw.RequireUser)).Methods("POST").HeadersRegexp("Content-Type", "application/json")
+	//sm.Handle("/updategroup/{id:[0-9]+}", web.WrapMiddleware(errs(service.UpdateGroup), authMw.UserViaSession, authMw.RequireUser)).Methods("POST").HeadersRegexp("Content-Type", "application/json")
 
 	// make sure we set Secure to true for production
 	csrfMiddleware := csrf.Protect([]byte(cfg.Web.CsrfKey), csrf.Secure(false))
+
+	// Uploads are capped before csrf.Protect reads the multipart form, so the
+	// route is set up ahead of userRouter with its own middleware chain. The
+	// cap leaves some room on top of the file for the other form fields.
+	submitPhoto := web.WrapMiddleware(errs(service.SubmitPhoto), authMw.UserViaSession, authMw.RequireUser, authMw.RequireVerifiedEmail)
+	sm.Handle("/contests/{id:[0-9]+}/submit", web.Apply(csrfMiddleware(submitPhoto), web.MaxBodySize(limits.MaxBytes+1<<20))).Methods("POST", "GET")
+
 	userRouter := sm.Methods("POST", "GET").Subrouter()
 	userRouter.Use(csrfMiddleware)
-	userRouter.HandleFunc("/register", service.UserSignUp)
-	userRouter.HandleFunc("/login", service.UserLogIn)
-	userRouter.HandleFunc("/logout", service.UserLogOut)
+	userRouter.HandleFunc("/register", errs(service.UserSignUp))
+	userRouter.HandleFunc("/login", errs(service.UserLogIn))
+	userRouter.HandleFunc("/login/2fa", errs(service.LoginTwoFactor))
+	userRouter.HandleFunc("/logout", errs(service.UserLogOut))
+	userRouter.HandleFunc("/forgot-password", errs(service.ForgotPassword))
+	userRouter.Handle("/verify-email", web.WrapMiddleware(errs(service.VerifyEmailStatus), authMw.UserViaSession, authMw.RequireUser))
+	userRouter.Handle("/verify-email/{token}", web.WrapMiddleware(errs(service.VerifyEmail), authMw.UserViaSession)).Methods("GET")
+	userRouter.HandleFunc("/reset-password/{token}", errs(service.ResetPassword))
+	userRouter.Handle("/settings", web.WrapMiddleware(errs(service.Settings), authMw.UserViaSession, authMw.RequireUser))
+	userRouter.Handle("/admin/sessions", web.WrapMiddleware(errs(service.AdminSessions), authMw.UserViaSession, authMw.RequireRole(user.RoleSiteAdmin)))
+	userRouter.Handle("/admin/lockouts", web.WrapMiddleware(errs(service.AdminLockouts), authMw.UserViaSession, authMw.RequireRole(user.RoleSiteAdmin)))
+	userRouter.Handle("/admin/roles", web.WrapMiddleware(errs(service.AdminRoles), authMw.UserViaSession, authMw.RequireRole(user.RoleSiteAdmin)))
+	userRouter.Handle("/contests/{id:[0-9]+}", web.WrapMiddleware(errs(service.ContestView), authMw.UserViaSession))
+	userRouter.Handle("/contests/{id:[0-9]+}/jury", web.WrapMiddleware(errs(service.JuryAdmin), authMw.UserViaSession, authMw.RequireContestRole(user.RoleContestAdmin)))
+	userRouter.Handle("/contests/{id:[0-9]+}/results", web.WrapMiddleware(errs(service.Results), authMw.UserViaSession)).Methods("GET")
+	userRouter.Handle("/contests/{id:[0-9]+}/publish", web.WrapMiddleware(errs(service.PublishResults), authMw.UserViaSession, authMw.RequireContestRole(user.RoleContestAdmin))).Methods("POST")
+	userRouter.Handle("/judge/{id:[0-9]+}", web.WrapMiddleware(errs(service.Judge), authMw.UserViaSession, authMw.RequireContestRole(user.RoleJuror))).Methods("GET")
+	userRouter.Handle("/judge/{id:[0-9]+}/photos/{photo_id:[0-9]+}", web.WrapMiddleware(errs(service.JudgePhoto), authMw.UserViaSession, authMw.RequireContestRole(user.RoleJuror)))
+	userRouter.Handle("/photos/{id:[0-9]+}/vote", web.WrapMiddleware(errs(service.VotePhoto), authMw.UserViaSession, authMw.RequireUser, authMw.RequireVerifiedEmail)).Methods("POST")
+	userRouter.Handle("/photos/{id:[0-9]+}/unvote", web.WrapMiddleware(errs(service.UnvotePhoto), authMw.UserViaSession, authMw.RequireUser, authMw.RequireVerifiedEmail)).Methods("POST")
+
+	// The JSON API has no CSRF tokens; APIGuard keeps other sites from using
+	// the session cookie of their visitors instead. Scripts authenticate
+	// with API tokens, limited to the scope each route requires, or with
+	// JSON Web Tokens from /api/v1/auth/token.
+	apiMw := func(h web.Handler, mws ...func(http.Handler) http.HandlerFunc) http.Handler {
+		return web.WrapMiddleware(errs(h), append([]func(http.Handler) http.HandlerFunc{handlers.APIGuard, authMw.UserViaToken, authMw.UserViaSession}, mws...)...)
+	}
+	read := authMw.RequireScope(apitoken.ScopeRead)
+	api := sm.PathPrefix("/api/v1").Subrouter()
+	api.Handle("/users", apiMw(service.APISignUp)).Methods("POST")
+	if jwtAuth != nil {
+		api.Handle("/auth/token", apiMw(service.APIIssueToken)).Methods("POST")
+	}
+	api.Handle("/users/me", apiMw(service.APIMe, authMw.RequireUser, read)).Methods("GET")
+	api.Handle("/users/me/votes", apiMw(service.APIMyVotes, authMw.RequireUser, read)).Methods("GET")
+	api.Handle("/contests", apiMw(service.APIContests, read)).Methods("GET")
+	api.Handle("/contests", apiMw(service.APICreateContest, authMw.RequireScope(apitoken.ScopeManage), authMw.RequireRole(user.RoleContestAdmin))).Methods("POST")
+	api.Handle("/contests/{id:[0-9]+}", apiMw(service.APIContest, read)).Methods("GET")
+	api.Handle("/contests/{id:[0-9]+}", apiMw(service.APIUpdateContest, authMw.RequireScope(apitoken.ScopeManage), authMw.RequireContestRole(user.RoleContestAdmin))).Methods("PATCH")
+	api.Handle("/contests/{id:[0-9]+}/phase", apiMw(service.APISetPhase, authMw.RequireScope(apitoken.ScopeManage), authMw.RequireContestRole(user.RoleContestAdmin))).Methods("PUT")
+	api.Handle("/contests/{id:[0-9]+}/photos", apiMw(service.APIContestPhotos, read)).Methods("GET")
+	api.Handle("/contests/{id:[0-9]+}/photos", apiMw(service.APISubmitPhoto, authMw.RequireScope(apitoken.ScopeSubmit), authMw.RequireUser, authMw.RequireVerifiedEmail)).Methods("POST")
+	api.Handle("/contests/{id:[0-9]+}/results", apiMw(service.APIResults, read)).Methods("GET")
+	api.Handle("/photos/{id:[0-9]+}", apiMw(service.APIPhoto, read)).Methods("GET")
+	api.Handle("/photos/{id:[0-9]+}/vote", apiMw(service.APIVote, authMw.RequireScope(apitoken.ScopeVote), authMw.RequireUser, authMw.RequireVerifiedEmail)).Methods("POST", "DELETE")
+	api.PathPrefix("/").HandlerFunc(errs(service.APINotFound))
+
+	sm.HandleFunc("/photos/{id:[0-9]+}/{size}", errs(service.PhotoFile)).Methods("GET", "HEAD")
 
 	sm.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("var/static/"))))
 
 	sm.Handle("/favicon.ico", http.NotFoundHandler())
 
+	// Requests are measured by the pattern of the route they match.
+	route := func(r *http.Request) string {
+		var match mux.RouteMatch
+		if sm.Match(r, &match) && match.Route != nil {
+			if tpl, err := match.Route.GetPathTemplate(); err == nil {
+				return tpl
+			}
+		}
+		return "unmatched"
+	}
+
+	proxies, err := web.ParseProxies(cfg.Web.TrustedProxies)
+	if err != nil {
+		return errors.Wrap(err, "parsing trusted proxies")
+	}
+
 	s := &http.Server{
 		Addr:         cfg.Web.BindAddress,
-		Handler:      sm,
+		Handler:      web.Apply(sm, web.Proxies(proxies), web.Logger(log), web.Metrics(route), web.Panics(log, service.ErrorPage)),
 		IdleTimeout:  cfg.Web.IdleTimeout,
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
@@ -156,7 +377,8 @@ func run(log *log.Logger) error {
 
 	sig := <-sigChan
 	log.Println("Received terminate, graceful shutdown", sig)
-	ctx, _ := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	s.Shutdown(ctx)
 
 	return nil
@@ -0,0 +1,201 @@
+// Package apitoken provides support for personal API tokens used by scripts
+// and other clients that can't keep a browser session.
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidToken is returned for tokens that are unknown, revoked or
+// expired. The cases are not told apart on purpose.
+var ErrInvalidToken = errors.New("API token is invalid or has expired")
+
+// tokenPrefix starts every token so they are easy to recognize, for example
+// by secret scanners.
+const tokenPrefix = "pc_"
+
+// Store manages the set of API's for API token access.
+type Store struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// NewStore constructs an API token store for api access.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create issues a new token. It returns the token itself along with its
+// record; only a hash of it is stored.
+func (s Store) Create(ctx context.Context, nt NewToken, now time.Time) (Token, string, error) {
+	if err := validate.Check(nt); err != nil {
+		return Token{}, "", errors.Wrap(err, "validating data")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return Token{}, "", errors.Wrap(err, "generating token")
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	scopes := make([]string, len(nt.Scopes))
+	for i, scope := range nt.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	t := Token{
+		UserID:    nt.UserID,
+		Name:      strings.TrimSpace(nt.Name),
+		Prefix:    secret[:len(tokenPrefix)+6],
+		Scopes:    strings.Join(scopes, ","),
+		CreatedOn: now.UTC(),
+	}
+	if nt.Expires != nil {
+		expires := nt.Expires.UTC()
+		t.Expires = &expires
+	}
+
+	data := struct {
+		Token
+		TokenHash string `db:"token_hash"`
+	}{
+		Token:     t,
+		TokenHash: hashToken(secret),
+	}
+	const query = `
+	INSERT INTO api_token
+		(user_id, name, prefix, token_hash, scopes, expires, created)
+	VALUES
+		(:user_id, :name, :prefix, :token_hash, :scopes, :expires, :created)`
+
+	s.log.Printf("%s: user %d token %q", "apitoken.Create", t.UserID, t.Name)
+
+	id, err := database.NamedInsertID(ctx, s.db, query, data, "token_id")
+	if err != nil {
+		return Token{}, "", errors.Wrapf(err, "inserting token for user %d", t.UserID)
+	}
+	t.ID = id
+
+	return t, secret, nil
+}
+
+// Authenticate returns the token record for a token presented by a client
+// and records that it was used.
+func (s Store) Authenticate(ctx context.Context, secret string, now time.Time) (Token, error) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return Token{}, ErrInvalidToken
+	}
+
+	data := struct {
+		TokenHash string    `db:"token_hash"`
+		Now       time.Time `db:"now"`
+	}{
+		TokenHash: hashToken(secret),
+		Now:       now.UTC(),
+	}
+	const query = `
+	SELECT
+		token_id, user_id, name, prefix, scopes, last_used, expires, created
+	FROM api_token
+	WHERE token_hash = :token_hash`
+
+	s.log.Printf("%s: checking token", "apitoken.Authenticate")
+
+	var t Token
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &t); err != nil {
+		if err == database.ErrNotFound {
+			return Token{}, ErrInvalidToken
+		}
+		return Token{}, errors.Wrap(err, "selecting token")
+	}
+	if t.Expired(now) {
+		return Token{}, ErrInvalidToken
+	}
+
+	const touch = `
+	UPDATE api_token SET
+		last_used = :now
+	WHERE token_hash = :token_hash`
+
+	if _, err := s.db.NamedExecContext(ctx, touch, data); err != nil {
+		return Token{}, errors.Wrapf(err, "recording use of token %d", t.ID)
+	}
+	last := now.UTC()
+	t.LastUsed = &last
+
+	return t, nil
+}
+
+// QueryByUser lists the tokens of a user, newest first.
+func (s Store) QueryByUser(ctx context.Context, userID int) ([]Token, error) {
+	data := struct {
+		UserID int `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+	const query = `
+	SELECT
+		token_id, user_id, name, prefix, scopes, last_used, expires, created
+	FROM api_token
+	WHERE user_id = :user_id
+	ORDER BY created DESC, token_id DESC`
+
+	s.log.Printf("%s: %s", "apitoken.QueryByUser", database.Log(query, data))
+
+	var ts []Token
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &ts); err != nil {
+		return nil, errors.Wrapf(err, "selecting tokens of user %d", userID)
+	}
+
+	return ts, nil
+}
+
+// Revoke deletes a token of a user so it can't be used anymore.
+func (s Store) Revoke(ctx context.Context, tokenID, userID int) error {
+	data := struct {
+		TokenID int `db:"token_id"`
+		UserID  int `db:"user_id"`
+	}{
+		TokenID: tokenID,
+		UserID:  userID,
+	}
+	const query = `
+	DELETE FROM api_token
+	WHERE token_id = :token_id AND user_id = :user_id`
+
+	s.log.Printf("%s: %s", "apitoken.Revoke", database.Log(query, data))
+
+	res, err := s.db.NamedExecContext(ctx, query, data)
+	if err != nil {
+		return errors.Wrapf(err, "deleting token %d", tokenID)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return err
+		}
+		return database.ErrNotFound
+	}
+
+	return nil
+}
+
+// hashToken returns the form a token is stored in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,98 @@
+package apitoken_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/apitoken"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"photo-contest/foundation/database"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestAPIToken(t *testing.T) {
+	tests.Run(t, testAPIToken)
+}
+
+func testAPIToken(t *testing.T, log *log.Logger, db *sqlx.DB) {
+	ctx := context.Background()
+
+	usr, err := user.NewStore(log, db).Create(ctx, user.NewAuthUser{
+		Name:        "Scripter",
+		Email:       "scripter@example.com",
+		Pass:        "gophers1",
+		PassConfirm: "gophers1",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	store := apitoken.NewStore(log, db)
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Log("Given the need to work with API tokens.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single token.", testID)
+		{
+			bad := apitoken.NewToken{UserID: usr.ID, Name: "export", Scopes: []apitoken.Scope{"everything"}}
+			if _, _, err := store.Create(ctx, bad, now); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept unknown scopes.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not accept unknown scopes.", tests.Success, testID)
+
+			expires := now.Add(24 * time.Hour)
+			nt := apitoken.NewToken{
+				UserID:  usr.ID,
+				Name:    "export",
+				Scopes:  []apitoken.Scope{apitoken.ScopeRead, apitoken.ScopeManage},
+				Expires: &expires,
+			}
+			tok, secret, err := store.Create(ctx, nt, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a token.", tests.Success, testID)
+
+			got, err := store.Authenticate(ctx, secret, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the token : %s.", tests.Failed, testID, err)
+			}
+			if got.ID != tok.ID || got.UserID != usr.ID || got.LastUsed == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould get the token back : %+v.", tests.Failed, testID, got)
+			}
+			if !got.Allows(apitoken.ScopeManage) || got.Allows(apitoken.ScopeVote) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the scopes : %q.", tests.Failed, testID, got.Scopes)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the token with its scopes.", tests.Success, testID)
+
+			if _, err := store.Authenticate(ctx, secret, expires); err != apitoken.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept an expired token : %v.", tests.Failed, testID, err)
+			}
+			if _, err := store.Authenticate(ctx, secret+"x", now); err != apitoken.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept an unknown token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only accept valid tokens.", tests.Success, testID)
+
+			ts, err := store.QueryByUser(ctx, usr.ID)
+			if err != nil || len(ts) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould list the token : %d, %v.", tests.Failed, testID, len(ts), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the token.", tests.Success, testID)
+
+			if err := store.Revoke(ctx, tok.ID, usr.ID+1); err != database.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not revoke the token of someone else : %v.", tests.Failed, testID, err)
+			}
+			if err := store.Revoke(ctx, tok.ID, usr.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the token : %s.", tests.Failed, testID, err)
+			}
+			if _, err := store.Authenticate(ctx, secret, now); err != apitoken.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a revoked token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke the token.", tests.Success, testID)
+		}
+	}
+}
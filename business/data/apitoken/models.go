@@ -0,0 +1,67 @@
+package apitoken
+
+import (
+	"strings"
+	"time"
+)
+
+// Scope - what an API token is allowed to do
+type Scope string
+
+// Set of scopes a token can be given.
+const (
+	ScopeRead   Scope = "read"
+	ScopeVote   Scope = "vote"
+	ScopeSubmit Scope = "submit"
+	ScopeManage Scope = "manage"
+)
+
+// Scopes lists the known scopes.
+var Scopes = []Scope{ScopeRead, ScopeVote, ScopeSubmit, ScopeManage}
+
+// Token - personal API token of a user. The token itself is only shown once
+// when it is created; Prefix is kept so users can tell their tokens apart.
+type Token struct {
+	ID        int        `db:"token_id" json:"id"`
+	UserID    int        `db:"user_id" json:"user_id"`
+	Name      string     `db:"name" json:"name"`
+	Prefix    string     `db:"prefix" json:"prefix"`
+	Scopes    string     `db:"scopes" json:"scopes"`
+	LastUsed  *time.Time `db:"last_used" json:"date_last_used,omitempty"`
+	Expires   *time.Time `db:"expires" json:"date_expires,omitempty"`
+	CreatedOn time.Time  `db:"created" json:"date_created"`
+}
+
+// ScopeList returns the scopes of the token.
+func (t Token) ScopeList() []Scope {
+	var scopes []Scope
+	for _, s := range strings.Split(t.Scopes, ",") {
+		if s != "" {
+			scopes = append(scopes, Scope(s))
+		}
+	}
+	return scopes
+}
+
+// Allows reports whether the token was given the scope.
+func (t Token) Allows(scope Scope) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the token can no longer be used at the given time.
+func (t Token) Expired(now time.Time) bool {
+	return t.Expires != nil && !now.Before(*t.Expires)
+}
+
+// NewToken - struct for creating API tokens
+type NewToken struct {
+	UserID  int        `json:"user_id" validate:"required"`
+	Name    string     `json:"name" validate:"required,max=100"`
+	Scopes  []Scope    `json:"scopes" validate:"required,min=1,dive,oneof=read vote submit manage"`
+	Expires *time.Time `json:"expires"`
+}
@@ -0,0 +1,419 @@
+// Package backup snapshots the SQLite database, along with a manifest of the
+// photo storage, into timestamped archives and restores the database from
+// them.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"photo-contest/business/data/photo"
+	"photo-contest/foundation/database"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Names of the files inside an archive.
+const (
+	dbFile       = "db.db"
+	manifestFile = "photos.json"
+)
+
+// Archives are named after the time they were taken, so they sort in order.
+const (
+	prefix     = "photoc-"
+	suffix     = ".tar.gz"
+	timeFormat = "20060102T150405Z"
+)
+
+// Config says what to back up and where to.
+type Config struct {
+	// DBPath is the SQLite database file.
+	DBPath string
+
+	// Dir holds the archives.
+	Dir string
+
+	// Keep is the number of archives kept; older ones are removed once a
+	// new one is made. Zero keeps them all.
+	Keep int
+
+	// Photos, when set, has a manifest of its files go in the archives.
+	Photos *photo.Storage
+}
+
+// Archiver makes and restores backups.
+type Archiver struct {
+	log *log.Logger
+	cfg Config
+}
+
+// NewArchiver constructs an Archiver for the given configuration.
+func NewArchiver(log *log.Logger, cfg Config) Archiver {
+	return Archiver{
+		log: log,
+		cfg: cfg,
+	}
+}
+
+// Create snapshots the database while it is in use and writes the snapshot,
+// checked for integrity, to a new archive. It returns the path of the
+// archive.
+func (a Archiver) Create(ctx context.Context, now time.Time) (string, error) {
+	if err := os.MkdirAll(a.cfg.Dir, 0700); err != nil {
+		return "", errors.Wrapf(err, "creating %s", a.cfg.Dir)
+	}
+	tmp, err := ioutil.TempDir(a.cfg.Dir, ".backup-")
+	if err != nil {
+		return "", errors.Wrap(err, "creating work directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	snapshot := filepath.Join(tmp, dbFile)
+	if err := database.Backup(ctx, a.cfg.DBPath, snapshot); err != nil {
+		return "", errors.Wrapf(err, "backing up %s", a.cfg.DBPath)
+	}
+	if err := check(ctx, snapshot); err != nil {
+		return "", errors.Wrap(err, "checking snapshot")
+	}
+
+	files := []string{snapshot}
+	if a.cfg.Photos != nil {
+		m, err := a.cfg.Photos.Manifest()
+		if err != nil {
+			return "", err
+		}
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return "", errors.Wrap(err, "encoding manifest")
+		}
+		file := filepath.Join(tmp, manifestFile)
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			return "", errors.Wrap(err, "writing manifest")
+		}
+		files = append(files, file)
+	}
+
+	// The archive only gets its name once complete, so a backup cut short
+	// is never mistaken for a good one.
+	archive := filepath.Join(a.cfg.Dir, prefix+now.UTC().Format(timeFormat)+suffix)
+	partial := filepath.Join(tmp, "archive")
+	if err := writeArchive(partial, files); err != nil {
+		return "", errors.Wrap(err, "writing archive")
+	}
+	if err := os.Rename(partial, archive); err != nil {
+		return "", errors.Wrap(err, "storing archive")
+	}
+
+	a.log.Printf("%s: wrote %s", "backup.Create", archive)
+
+	if err := a.prune(); err != nil {
+		a.log.Printf("%s: %s", "backup.Create", err)
+	}
+
+	return archive, nil
+}
+
+// Restore replaces the database with the one in archive, once the copy
+// passed an integrity check. The replaced database is kept next to it. The
+// webserver must be stopped while this runs; the restore is refused while
+// the database is open elsewhere.
+func (a Archiver) Restore(ctx context.Context, archive string, now time.Time) error {
+	dir := filepath.Dir(a.cfg.DBPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", dir)
+	}
+
+	// Unpacked next to the database so it can be renamed into place.
+	tmp, err := ioutil.TempDir(dir, ".restore-")
+	if err != nil {
+		return errors.Wrap(err, "creating work directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := readArchive(archive, tmp); err != nil {
+		return errors.Wrapf(err, "reading %s", archive)
+	}
+	restored := filepath.Join(tmp, dbFile)
+	if _, err := os.Stat(restored); err != nil {
+		return errors.Errorf("%s holds no database", archive)
+	}
+	if err := check(ctx, restored); err != nil {
+		return errors.Wrap(err, "checking backup")
+	}
+
+	if a.cfg.Photos != nil {
+		if err := a.checkPhotos(filepath.Join(tmp, manifestFile)); err != nil {
+			return err
+		}
+	}
+
+	// The write-ahead log and shared memory files belong to the database
+	// being replaced and go with it; left behind, SQLite would apply them
+	// to the restored one.
+	if _, err := os.Stat(a.cfg.DBPath); err == nil {
+		if err := a.moveAside(ctx, now); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(restored, a.cfg.DBPath); err != nil {
+		return errors.Wrap(err, "moving restored database in place")
+	}
+
+	a.log.Printf("%s: restored %s from %s", "backup.Restore", a.cfg.DBPath, archive)
+	return nil
+}
+
+// moveAside renames the current database out of the way, holding an
+// exclusive lock on it meanwhile. A database still open elsewhere, by a
+// running webserver say, can't be locked and is left alone.
+func (a Archiver) moveAside(ctx context.Context, now time.Time) error {
+	unlock, err := lock(ctx, a.cfg.DBPath)
+	if err != nil {
+		return errors.Wrap(err, "database in use, stop the webserver first")
+	}
+	defer unlock()
+
+	aside := a.cfg.DBPath + ".pre-restore-" + now.UTC().Format(timeFormat)
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(a.cfg.DBPath+ext, aside+ext); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "moving current database aside")
+		}
+	}
+	a.log.Printf("%s: moved current database to %s", "backup.Restore", aside)
+	return nil
+}
+
+// Run makes a backup every interval until ctx is canceled.
+func (a Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := a.Create(ctx, now); err != nil {
+				a.log.Printf("backup.Run: %s", err)
+			}
+		}
+	}
+}
+
+// List returns the paths of the archives, oldest first.
+func (a Archiver) List() ([]string, error) {
+	archives, err := filepath.Glob(filepath.Join(a.cfg.Dir, prefix+"*"+suffix))
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing archives in %s", a.cfg.Dir)
+	}
+	sort.Strings(archives)
+	return archives, nil
+}
+
+// prune removes the oldest archives beyond the number kept.
+func (a Archiver) prune() error {
+	if a.cfg.Keep <= 0 {
+		return nil
+	}
+	archives, err := a.List()
+	if err != nil {
+		return err
+	}
+	for len(archives) > a.cfg.Keep {
+		if err := os.Remove(archives[0]); err != nil {
+			return errors.Wrap(err, "removing old archive")
+		}
+		a.log.Printf("%s: removed %s", "backup.prune", archives[0])
+		archives = archives[1:]
+	}
+	return nil
+}
+
+// checkPhotos reports the files of the manifest that the photo storage
+// lacks. They are logged rather than failing the restore: the database is
+// still worth having back.
+func (a Archiver) checkPhotos(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading manifest")
+	}
+	var m []photo.ManifestEntry
+	if err := json.Unmarshal(data, &m); err != nil {
+		return errors.Wrap(err, "decoding manifest")
+	}
+
+	missing := a.cfg.Photos.Missing(m)
+	for _, path := range missing {
+		a.log.Printf("%s: photo file missing: %s", "backup.Restore", path)
+	}
+	if len(missing) > 0 {
+		a.log.Printf("%s: %d of %d photo files missing", "backup.Restore", len(missing), len(m))
+	}
+	return nil
+}
+
+// check runs an integrity check on the database file at path.
+func check(ctx context.Context, path string) error {
+	db, err := sqlx.Open(database.DriverSQLite, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return database.IntegrityCheck(ctx, db)
+}
+
+// lock takes the database file at path for a single connection, failing
+// straight away when any other connection has it open. The returned function
+// lets go of it.
+func lock(ctx context.Context, path string) (func(), error) {
+	q := make(url.Values)
+	q.Set("mode", "rw")
+	q.Set("_locking_mode", "EXCLUSIVE")
+	q.Set("_txlock", "exclusive")
+	q.Set("_busy_timeout", "0")
+	u := url.URL{
+		Path:     path,
+		RawQuery: q.Encode(),
+	}
+
+	db, err := sqlx.Open(database.DriverSQLite, u.String())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// In WAL mode the exclusive lock is only taken on the first read.
+	var n int
+	if err := tx.GetContext(ctx, &n, `SELECT COUNT(*) FROM sqlite_master`); err != nil {
+		tx.Rollback()
+		db.Close()
+		return nil, err
+	}
+
+	return func() {
+		tx.Rollback()
+		db.Close()
+	}, nil
+}
+
+// writeArchive writes the files to a gzipped tar at path.
+func writeArchive(path string, files []string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		if err := addFile(tw, file); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addFile writes the file at path to the archive under its base name.
+func addFile(tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := tar.Header{
+		Name:    filepath.Base(path),
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// readArchive unpacks the files of an archive into dir. Only the files a
+// backup holds are taken out; anything else is skipped.
+func readArchive(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || (hdr.Name != dbFile && hdr.Name != manifestFile) {
+			continue
+		}
+		if err := extract(tr, filepath.Join(dir, hdr.Name)); err != nil {
+			return err
+		}
+	}
+}
+
+// extract copies r to a new file at path.
+func extract(r io.Reader, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
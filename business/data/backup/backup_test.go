@@ -0,0 +1,198 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"photo-contest/business/data/backup"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/schema"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"photo-contest/foundation/database"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	log := log.New(os.Stdout, "TEST : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+
+	// Backups copy a database file, so the in-memory test database won't do.
+	dbPath := filepath.Join(dir, "var", "db.db")
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatalf("creating database directory: %s", err)
+	}
+	db := openDB(t, dbPath)
+	if err := schema.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrating database: %s", err)
+	}
+
+	photos := photo.NewStorage(filepath.Join(dir, "photos"))
+	if err := os.MkdirAll(filepath.Join(dir, "photos", "ab"), 0755); err != nil {
+		t.Fatalf("creating photo directory: %s", err)
+	}
+	photoFile := filepath.Join(dir, "photos", "ab", "abcd.jpg")
+	if err := ioutil.WriteFile(photoFile, []byte("jpeg"), 0644); err != nil {
+		t.Fatalf("writing photo: %s", err)
+	}
+
+	archiver := backup.NewArchiver(log, backup.Config{
+		DBPath: dbPath,
+		Dir:    filepath.Join(dir, "backups"),
+		Keep:   2,
+		Photos: &photos,
+	})
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Log("Given the need to back up and restore the database.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen backing up a database in use.", testID)
+		{
+			store := user.NewStore(log, db)
+			kept := addUser(t, store, "kept@example.com")
+
+			archive, err := archiver.Create(ctx, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to back up : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to back up.", tests.Success, testID)
+
+			addUser(t, store, "lost@example.com")
+			db.Close()
+
+			// The manifest is checked against the storage on restore.
+			if err := os.Remove(photoFile); err != nil {
+				t.Fatalf("removing photo: %s", err)
+			}
+			if err := archiver.Restore(ctx, archive, now.Add(time.Hour)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to restore : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to restore.", tests.Success, testID)
+
+			db = openDB(t, dbPath)
+			store = user.NewStore(log, db)
+			if _, err := store.QueryByEmail(ctx, kept.Email); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould find the user backed up : %s.", tests.Failed, testID, err)
+			}
+			if _, err := store.QueryByEmail(ctx, "lost@example.com"); err != database.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find the user added after the backup : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the database as it was backed up.", tests.Success, testID)
+
+			aside := dbPath + ".pre-restore-20210801T130000Z"
+			if _, err := os.Stat(aside); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the replaced database : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the replaced database.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen backing up on a schedule.", testID)
+		{
+			for i := 1; i <= 3; i++ {
+				if _, err := archiver.Create(ctx, now.Add(time.Duration(i)*time.Hour)); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to back up : %s.", tests.Failed, testID, err)
+				}
+			}
+			archives, err := archiver.List()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list archives : %s.", tests.Failed, testID, err)
+			}
+			if len(archives) != 2 || filepath.Base(archives[1]) != "photoc-20210801T150000Z.tar.gz" {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the newest archives : got %v.", tests.Failed, testID, archives)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the newest archives.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen restoring a damaged backup.", testID)
+		{
+			damaged := filepath.Join(dir, "damaged.tar.gz")
+			writeArchive(t, damaged, "db.db", []byte("not a database, not at all"))
+
+			if err := archiver.Restore(ctx, damaged, now.Add(5*time.Hour)); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a backup failing the integrity check.", tests.Failed, testID)
+			}
+			if _, err := user.NewStore(log, db).QueryByEmail(ctx, "kept@example.com"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould leave the database alone : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a backup failing the integrity check.", tests.Success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen restoring a database in use.", testID)
+		{
+			archives, err := archiver.List()
+			if err != nil || len(archives) == 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list archives : %d, %v.", tests.Failed, testID, len(archives), err)
+			}
+
+			// db is still open, as it would be by a running webserver.
+			if err := archiver.Restore(ctx, archives[0], now.Add(6*time.Hour)); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to replace a database in use.", tests.Failed, testID)
+			}
+			if _, err := os.Stat(dbPath + ".pre-restore-20210801T180000Z"); !os.IsNotExist(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould leave the database in place : %v.", tests.Failed, testID, err)
+			}
+			if _, err := user.NewStore(log, db).QueryByEmail(ctx, "kept@example.com"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould leave the database alone : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to replace a database in use.", tests.Success, testID)
+		}
+	}
+
+	db.Close()
+}
+
+// openDB opens the SQLite database file at path.
+func openDB(t *testing.T, path string) *sqlx.DB {
+	db, err := database.Open(database.Config{Path: path})
+	if err != nil {
+		t.Fatalf("opening database: %s", err)
+	}
+	return db
+}
+
+// addUser creates a user with the given email.
+func addUser(t *testing.T, store user.Store, email string) user.AuthUser {
+	nu := user.NewAuthUser{
+		Name:        "Backed Up",
+		Email:       email,
+		Pass:        "gophers123",
+		PassConfirm: "gophers123",
+	}
+	usr, err := store.Create(context.Background(), nu)
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+	return usr
+}
+
+// writeArchive writes an archive holding a single file.
+func writeArchive(t *testing.T, path, name string, data []byte) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating archive: %s", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))}); err != nil {
+		t.Fatalf("writing archive: %s", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatalf("writing archive: %s", err)
+	}
+	tw.Close()
+	gz.Close()
+}
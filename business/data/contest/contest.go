@@ -0,0 +1,326 @@
+// Package contest provides support for managing contests and their lifecycle.
+package contest
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for contest operations.
+var (
+	ErrInvalidPhase  = errors.New("phase transition is not allowed")
+	ErrLocked        = errors.New("contest can no longer be modified")
+	ErrNoTakenDate   = errors.New("photo has no date taken in its metadata")
+	ErrTakenTooEarly = errors.New("photo was taken before the date allowed by the rules")
+	ErrBadCategory   = errors.New("photo must be entered in one of the contest categories")
+	ErrNoWeight      = errors.New("at least one of the jury and the votes must count")
+)
+
+// Store manages the set of API's for contest access.
+type Store struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// NewStore constructs a contest store for api access.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create - add new contest into db. New contests always start as drafts.
+func (s Store) Create(ctx context.Context, nc NewContest, now time.Time) (Contest, error) {
+	if err := validate.Check(nc); err != nil {
+		return Contest{}, errors.Wrap(err, "validating data")
+	}
+
+	if nc.VoteBudget == 0 {
+		nc.VoteBudget = DefaultVoteBudget
+	}
+	if nc.JuryWeight == 0 && nc.VoteWeight == 0 {
+		nc.JuryWeight = DefaultJuryWeight
+	}
+
+	c := Contest{
+		UserID:      nc.UserID,
+		Title:       nc.Title,
+		Description: nc.Description,
+		Rules:       nc.Rules,
+		Phase:       PhaseDraft,
+		SubmitStart: nc.SubmitStart.UTC(),
+		SubmitEnd:   nc.SubmitEnd.UTC(),
+		TakenAfter:  utcPtr(nc.TakenAfter),
+		VoteBudget:  nc.VoteBudget,
+		Categories:  nc.Categories,
+		JuryWeight:  nc.JuryWeight,
+		VoteWeight:  nc.VoteWeight,
+		CreatedOn:   now.UTC(),
+		UpdatedOn:   now.UTC(),
+	}
+
+	const query = `
+	INSERT INTO contest
+		(user_id, title, description, rules, phase, submit_start, submit_end, taken_after, vote_budget,
+		categories, jury_weight, vote_weight, created, updated)
+	VALUES
+		(:user_id, :title, :description, :rules, :phase, :submit_start, :submit_end, :taken_after, :vote_budget,
+		:categories, :jury_weight, :vote_weight, :created, :updated)`
+
+	s.log.Printf("%s: %s", "contest.Create", database.Log(query, c))
+
+	// The creator administers the contest.
+	const grant = `
+	INSERT INTO user_role
+		(user_id, role, contest_id, created)
+	VALUES
+		(:user_id, :role, :contest_id, :created)`
+
+	err := database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		id, err := database.NamedInsertID(ctx, tx, query, c, "contest_id")
+		if err != nil {
+			return errors.Wrap(err, "inserting contest")
+		}
+		c.ID = id
+
+		g := user.Grant{
+			UserID:    c.UserID,
+			Role:      user.RoleContestAdmin,
+			ContestID: c.ID,
+			CreatedOn: c.CreatedOn,
+		}
+
+		s.log.Printf("%s: %s", "contest.Create", database.Log(grant, g))
+
+		if _, err := tx.NamedExecContext(ctx, grant, g); err != nil {
+			return errors.Wrap(err, "granting contest admin")
+		}
+		return nil
+	})
+	if err != nil {
+		return Contest{}, err
+	}
+
+	return c, nil
+}
+
+// Update modifies data about a contest. Published and archived contests are
+// locked and can't be changed anymore.
+func (s Store) Update(ctx context.Context, contestID int, uc UpdateContest, now time.Time) (Contest, error) {
+	if err := validate.Check(uc); err != nil {
+		return Contest{}, errors.Wrap(err, "validating data")
+	}
+
+	c, err := s.QueryByID(ctx, contestID)
+	if err != nil {
+		return Contest{}, errors.Wrap(err, "updating contest")
+	}
+	if c.ResultsVisible() {
+		return Contest{}, ErrLocked
+	}
+
+	if uc.Title != nil {
+		c.Title = *uc.Title
+	}
+	if uc.Description != nil {
+		c.Description = *uc.Description
+	}
+	if uc.Rules != nil {
+		c.Rules = *uc.Rules
+	}
+	if uc.SubmitStart != nil {
+		c.SubmitStart = uc.SubmitStart.UTC()
+	}
+	if uc.SubmitEnd != nil {
+		c.SubmitEnd = uc.SubmitEnd.UTC()
+	}
+	if uc.TakenAfter != nil {
+		c.TakenAfter = utcPtr(uc.TakenAfter)
+	}
+	if uc.VoteBudget != nil {
+		c.VoteBudget = *uc.VoteBudget
+	}
+	if uc.Categories != nil {
+		c.Categories = *uc.Categories
+	}
+	if uc.JuryWeight != nil {
+		c.JuryWeight = *uc.JuryWeight
+	}
+	if uc.VoteWeight != nil {
+		c.VoteWeight = *uc.VoteWeight
+	}
+	if c.JuryWeight == 0 && c.VoteWeight == 0 {
+		return Contest{}, ErrNoWeight
+	}
+	if !c.SubmitEnd.After(c.SubmitStart) {
+		return Contest{}, validate.FieldErrors{
+			{Field: "submit_end", Error: "submit_end must be after submit_start"},
+		}
+	}
+	c.UpdatedOn = now.UTC()
+
+	const query = `
+	UPDATE contest SET
+		title = :title,
+		description = :description,
+		rules = :rules,
+		submit_start = :submit_start,
+		submit_end = :submit_end,
+		taken_after = :taken_after,
+		vote_budget = :vote_budget,
+		categories = :categories,
+		jury_weight = :jury_weight,
+		vote_weight = :vote_weight,
+		updated = :updated
+	WHERE contest_id = :contest_id`
+
+	s.log.Printf("%s: %s", "contest.Update", database.Log(query, c))
+
+	if _, err := s.db.NamedExecContext(ctx, query, c); err != nil {
+		return Contest{}, errors.Wrapf(err, "updating contest %d", c.ID)
+	}
+
+	return c, nil
+}
+
+// SetPhase moves the contest to the given phase. A contest can only advance
+// to the next phase of its lifecycle, except that it can be archived at any
+// time. The time the phase was entered is recorded.
+func (s Store) SetPhase(ctx context.Context, contestID int, phase Phase, now time.Time) (Contest, error) {
+	c, err := s.QueryByID(ctx, contestID)
+	if err != nil {
+		return Contest{}, errors.Wrap(err, "changing phase")
+	}
+
+	from, to := c.Phase.order(), phase.order()
+	switch {
+	case to < 0 || from < 0:
+		return Contest{}, ErrInvalidPhase
+	case phase == PhaseArchived && c.Phase != PhaseArchived:
+	case to != from+1:
+		return Contest{}, ErrInvalidPhase
+	}
+
+	now = now.UTC()
+	c.Phase = phase
+	c.UpdatedOn = now
+	switch phase {
+	case PhaseOpen:
+		c.OpenedOn = &now
+	case PhaseJudging:
+		c.JudgingOn = &now
+	case PhasePublished:
+		c.PublishedOn = &now
+	case PhaseArchived:
+		c.ArchivedOn = &now
+	}
+
+	const query = `
+	UPDATE contest SET
+		phase = :phase,
+		opened = :opened,
+		judging = :judging,
+		published = :published,
+		archived = :archived,
+		updated = :updated
+	WHERE contest_id = :contest_id`
+
+	s.log.Printf("%s: %s", "contest.SetPhase", database.Log(query, c))
+
+	if _, err := s.db.NamedExecContext(ctx, query, c); err != nil {
+		return Contest{}, errors.Wrapf(err, "updating contest %d", c.ID)
+	}
+
+	return c, nil
+}
+
+// QueryByID - return given contest
+func (s Store) QueryByID(ctx context.Context, contestID int) (Contest, error) {
+	data := struct {
+		ContestID int `db:"contest_id"`
+	}{
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT
+		contest_id, user_id, title, description, rules, phase, submit_start, submit_end, taken_after,
+		vote_budget, categories, jury_weight, vote_weight, opened, judging, published, archived,
+		created, updated
+	FROM contest
+	WHERE contest_id = :contest_id`
+
+	s.log.Printf("%s: %s", "contest.QueryByID", database.Log(query, data))
+
+	var c Contest
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &c); err != nil {
+		if err == database.ErrNotFound {
+			return Contest{}, database.ErrNotFound
+		}
+		return Contest{}, errors.Wrapf(err, "selecting contest %d", data.ContestID)
+	}
+
+	return c, nil
+}
+
+// List retrieves all contests, newest first.
+func (s Store) List(ctx context.Context) ([]Contest, error) {
+	const query = `
+	SELECT
+		contest_id, user_id, title, description, rules, phase, submit_start, submit_end, taken_after,
+		vote_budget, categories, jury_weight, vote_weight, opened, judging, published, archived,
+		created, updated
+	FROM contest
+	ORDER BY created DESC, contest_id DESC`
+
+	s.log.Printf("%s: %s", "contest.List", database.Log(query))
+
+	var cs []Contest
+	if err := database.NamedQuerySlice(ctx, s.db, query, struct{}{}, &cs); err != nil {
+		return nil, errors.Wrap(err, "selecting contests")
+	}
+
+	return cs, nil
+}
+
+// QueryByPhase retrieves the contests currently in the given phase, newest first.
+func (s Store) QueryByPhase(ctx context.Context, phase Phase) ([]Contest, error) {
+	data := struct {
+		Phase Phase `db:"phase"`
+	}{
+		Phase: phase,
+	}
+	const query = `
+	SELECT
+		contest_id, user_id, title, description, rules, phase, submit_start, submit_end, taken_after,
+		vote_budget, categories, jury_weight, vote_weight, opened, judging, published, archived,
+		created, updated
+	FROM contest
+	WHERE phase = :phase
+	ORDER BY created DESC, contest_id DESC`
+
+	s.log.Printf("%s: %s", "contest.QueryByPhase", database.Log(query, data))
+
+	var cs []Contest
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &cs); err != nil {
+		return nil, errors.Wrapf(err, "selecting %s contests", phase)
+	}
+
+	return cs, nil
+}
+
+// utcPtr returns a copy of t in UTC, or nil if t is nil.
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
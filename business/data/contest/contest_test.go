@@ -0,0 +1,153 @@
+package contest_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestContest(t *testing.T) {
+	tests.Run(t, testContest)
+}
+
+func testContest(t *testing.T, log *log.Logger, db *sqlx.DB) {
+	ctx := context.Background()
+
+	usr, err := user.NewStore(log, db).Create(ctx, user.NewAuthUser{
+		Name:        "Contest Admin",
+		Email:       "admin@example.com",
+		Pass:        "gophers",
+		PassConfirm: "gophers",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	store := contest.NewStore(log, db)
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Log("Given the need to work with Contest records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single Contest.", testID)
+		{
+			nc := contest.NewContest{
+				UserID:      usr.ID,
+				Title:       "Urban Nature",
+				Description: "Wildlife in the city.",
+				Rules:       "One photo per person.",
+				SubmitStart: now.Add(24 * time.Hour),
+				SubmitEnd:   now.Add(30 * 24 * time.Hour),
+			}
+			c, err := store.Create(ctx, nc, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create contest : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create contest.", tests.Success, testID)
+
+			if c.VoteBudget != contest.DefaultVoteBudget {
+				t.Fatalf("\t%s\tTest %d:\tShould get the default vote budget : got %d.", tests.Failed, testID, c.VoteBudget)
+			}
+			if c.Phase != contest.PhaseDraft {
+				t.Fatalf("\t%s\tTest %d:\tShould start as a draft : got %q.", tests.Failed, testID, c.Phase)
+			}
+			t.Logf("\t%s\tTest %d:\tShould start as a draft.", tests.Success, testID)
+
+			grants, err := user.NewStore(log, db).QueryGrants(ctx, usr.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve grants : %s.", tests.Failed, testID, err)
+			}
+			usr.Grants = grants
+			if !usr.HasRole(user.RoleContestAdmin, c.ID) {
+				t.Fatalf("\t%s\tTest %d:\tShould make the creator a contest admin : %+v.", tests.Failed, testID, grants)
+			}
+			t.Logf("\t%s\tTest %d:\tShould make the creator a contest admin.", tests.Success, testID)
+
+			saved, err := store.QueryByID(ctx, c.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve contest by ID: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve contest by ID.", tests.Success, testID)
+			if diff := cmp.Diff(c, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same contest. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same contest.", tests.Success, testID)
+
+			uc := contest.UpdateContest{
+				Title: tests.StringPointer("Urban Wildlife"),
+			}
+			if _, err := store.Update(ctx, c.ID, uc, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update contest : %s.", tests.Failed, testID, err)
+			}
+			saved, err = store.QueryByID(ctx, c.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve updated contest : %s.", tests.Failed, testID, err)
+			}
+			if saved.Title != *uc.Title {
+				t.Fatalf("\t%s\tTest %d:\tShould see the updated title : got %q.", tests.Failed, testID, saved.Title)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update contest.", tests.Success, testID)
+
+			if _, err := store.SetPhase(ctx, c.ID, contest.PhaseJudging, now); err != contest.ErrInvalidPhase {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to skip a phase : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to skip a phase.", tests.Success, testID)
+
+			c, err = store.SetPhase(ctx, c.ID, contest.PhaseOpen, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to open contest : %s.", tests.Failed, testID, err)
+			}
+			if c.OpenedOn == nil || !c.OpenedOn.Equal(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould record when the contest opened : %v.", tests.Failed, testID, c.OpenedOn)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to open contest.", tests.Success, testID)
+
+			if c.AcceptsSubmissions(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept submissions before the window.", tests.Failed, testID)
+			}
+			if !c.AcceptsSubmissions(now.Add(48 * time.Hour)) {
+				t.Fatalf("\t%s\tTest %d:\tShould accept submissions inside the window.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only accept submissions inside the window.", tests.Success, testID)
+
+			takenAfter := now.Add(-24 * time.Hour)
+			c, err = store.Update(ctx, c.ID, contest.UpdateContest{TakenAfter: &takenAfter}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to set the date taken rule : %s.", tests.Failed, testID, err)
+			}
+			before, after := now.Add(-48*time.Hour), now
+			if c.CheckTakenOn(nil) != contest.ErrNoTakenDate || c.CheckTakenOn(&before) != contest.ErrTakenTooEarly || c.CheckTakenOn(&after) != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould check the date photos were taken.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould check the date photos were taken.", tests.Success, testID)
+
+			open, err := store.QueryByPhase(ctx, contest.PhaseOpen)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list open contests : %s.", tests.Failed, testID, err)
+			}
+			if len(open) != 1 || open[0].ID != c.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould list the open contest : got %d contests.", tests.Failed, testID, len(open))
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to list open contests.", tests.Success, testID)
+
+			for _, p := range []contest.Phase{contest.PhaseJudging, contest.PhasePublished} {
+				if _, err := store.SetPhase(ctx, c.ID, p, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to move to %s : %s.", tests.Failed, testID, p, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to move through the phases.", tests.Success, testID)
+
+			if _, err := store.Update(ctx, c.ID, uc, now); err != contest.ErrLocked {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to update a published contest : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to update a published contest.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package contest
+
+import (
+	"strings"
+	"time"
+)
+
+// Phase - stage of a contest lifecycle
+type Phase string
+
+// Set of phases a contest moves through, in order.
+const (
+	PhaseDraft     Phase = "draft"
+	PhaseOpen      Phase = "open"
+	PhaseJudging   Phase = "judging"
+	PhasePublished Phase = "published"
+	PhaseArchived  Phase = "archived"
+)
+
+// phases lists the lifecycle in the order a contest is allowed to move.
+var phases = []Phase{PhaseDraft, PhaseOpen, PhaseJudging, PhasePublished, PhaseArchived}
+
+// order returns the position of p in the lifecycle or -1 if p is unknown.
+func (p Phase) order() int {
+	for i, ph := range phases {
+		if ph == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// Valid reports whether p is one of the known phases.
+func (p Phase) Valid() bool {
+	return p.order() >= 0
+}
+
+// Contest - contest
+type Contest struct {
+	ID          int        `db:"contest_id" json:"id"`
+	UserID      int        `db:"user_id" json:"user_id"`
+	Title       string     `db:"title" json:"title"`
+	Description string     `db:"description" json:"description"`
+	Rules       string     `db:"rules" json:"rules"`
+	Phase       Phase      `db:"phase" json:"phase"`
+	SubmitStart time.Time  `db:"submit_start" json:"submit_start"`
+	SubmitEnd   time.Time  `db:"submit_end" json:"submit_end"`
+	TakenAfter  *time.Time `db:"taken_after" json:"taken_after,omitempty"`
+	VoteBudget  int        `db:"vote_budget" json:"vote_budget"`
+	Categories  string     `db:"categories" json:"categories"`
+	JuryWeight  float64    `db:"jury_weight" json:"jury_weight"`
+	VoteWeight  float64    `db:"vote_weight" json:"vote_weight"`
+	OpenedOn    *time.Time `db:"opened" json:"date_opened,omitempty"`
+	JudgingOn   *time.Time `db:"judging" json:"date_judging,omitempty"`
+	PublishedOn *time.Time `db:"published" json:"date_published,omitempty"`
+	ArchivedOn  *time.Time `db:"archived" json:"date_archived,omitempty"`
+	CreatedOn   time.Time  `db:"created" json:"date_created"`
+	UpdatedOn   time.Time  `db:"updated" json:"date_updated"`
+}
+
+// AcceptsSubmissions reports whether photos can be submitted at the given time.
+// The contest must be open and the time must fall inside the submission window.
+func (c Contest) AcceptsSubmissions(now time.Time) bool {
+	if c.Phase != PhaseOpen {
+		return false
+	}
+	return !now.Before(c.SubmitStart) && now.Before(c.SubmitEnd)
+}
+
+// CheckTakenOn verifies the date a photo was taken against the contest rules.
+// When the contest requires photos taken after a given date, photos without
+// a known date are rejected as well.
+func (c Contest) CheckTakenOn(taken *time.Time) error {
+	if c.TakenAfter == nil {
+		return nil
+	}
+	if taken == nil {
+		return ErrNoTakenDate
+	}
+	if taken.Before(*c.TakenAfter) {
+		return ErrTakenTooEarly
+	}
+	return nil
+}
+
+// CategoryList returns the categories photos are entered in. Categories are
+// stored as a comma separated list; a contest without categories ranks all
+// its entries together.
+func (c Contest) CategoryList() []string {
+	var cats []string
+	for _, cat := range strings.Split(c.Categories, ",") {
+		if cat = strings.TrimSpace(cat); cat != "" {
+			cats = append(cats, cat)
+		}
+	}
+	return cats
+}
+
+// CheckCategory verifies the category a photo is entered in. Contests with
+// categories require one of them, others take no category at all.
+func (c Contest) CheckCategory(category string) error {
+	cats := c.CategoryList()
+	if len(cats) == 0 {
+		if category != "" {
+			return ErrBadCategory
+		}
+		return nil
+	}
+	for _, cat := range cats {
+		if cat == category {
+			return nil
+		}
+	}
+	return ErrBadCategory
+}
+
+// AcceptsVotes reports whether the public can vote on entries. Voting runs
+// alongside the jury, once submissions are closed.
+func (c Contest) AcceptsVotes() bool {
+	return c.Phase == PhaseJudging
+}
+
+// AcceptsJudging reports whether entries can be judged.
+func (c Contest) AcceptsJudging() bool {
+	return c.Phase == PhaseJudging
+}
+
+// ResultsVisible reports whether the results of the contest can be shown.
+func (c Contest) ResultsVisible() bool {
+	return c.Phase == PhasePublished || c.Phase == PhaseArchived
+}
+
+// DefaultVoteBudget is the number of votes each user gets in a contest when
+// none is configured.
+const DefaultVoteBudget = 3
+
+// DefaultJuryWeight is the weight of the jury in the results when a contest
+// configures neither weight, so results come from the jury alone.
+const DefaultJuryWeight = 1
+
+// NewContest - struct for creating new contests
+type NewContest struct {
+	UserID      int        `json:"user_id" validate:"required"`
+	Title       string     `json:"title" validate:"required"`
+	Description string     `json:"description"`
+	Rules       string     `json:"rules"`
+	SubmitStart time.Time  `json:"submit_start" validate:"required"`
+	SubmitEnd   time.Time  `json:"submit_end" validate:"required,gtfield=SubmitStart"`
+	TakenAfter  *time.Time `json:"taken_after"`
+	VoteBudget  int        `json:"vote_budget" validate:"gte=0"`
+	Categories  string     `json:"categories"`
+	JuryWeight  float64    `json:"jury_weight" validate:"gte=0"`
+	VoteWeight  float64    `json:"vote_weight" validate:"gte=0"`
+}
+
+// UpdateContest defines what information may be provided to modify an
+// existing Contest. All fields are optional so clients can send just the
+// fields they want changed. It uses pointer fields so we can differentiate
+// between a field that was not provided and a field that was provided as
+// explicitly blank.
+type UpdateContest struct {
+	Title       *string    `json:"title" validate:"omitempty,min=1"`
+	Description *string    `json:"description"`
+	Rules       *string    `json:"rules"`
+	SubmitStart *time.Time `json:"submit_start"`
+	SubmitEnd   *time.Time `json:"submit_end"`
+	TakenAfter  *time.Time `json:"taken_after"`
+	VoteBudget  *int       `json:"vote_budget" validate:"omitempty,min=1"`
+	Categories  *string    `json:"categories"`
+	JuryWeight  *float64   `json:"jury_weight" validate:"omitempty,gte=0"`
+	VoteWeight  *float64   `json:"vote_weight" validate:"omitempty,gte=0"`
+}
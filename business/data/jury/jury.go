@@ -0,0 +1,395 @@
+// Package jury provides support for jury scoring of contest entries.
+package jury
+
+import (
+	"context"
+	"log"
+	"math"
+	"photo-contest/business/data/user"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for jury operations.
+var (
+	ErrNotJuror     = errors.New("user is not a juror of this contest")
+	ErrBadCriterion = errors.New("criterion does not belong to this contest")
+	ErrBadScore     = errors.New("scores must be between 1 and 10")
+)
+
+// Store manages the set of API's for jury access.
+type Store struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// NewStore constructs a jury store for api access.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// AddJuror assigns a user to the jury of a contest. Jury seats are juror
+// role grants for the contest. Adding a juror twice is not an error.
+func (s Store) AddJuror(ctx context.Context, contestID, userID int, now time.Time) error {
+	return user.NewStore(s.log, s.db).Grant(ctx, userID, user.RoleJuror, contestID, now)
+}
+
+// RemoveJuror takes a user off the jury of a contest. The scores the juror
+// already gave are kept.
+func (s Store) RemoveJuror(ctx context.Context, contestID, userID int) error {
+	return user.NewStore(s.log, s.db).Revoke(ctx, userID, user.RoleJuror, contestID)
+}
+
+// Jurors returns the jury of a contest.
+func (s Store) Jurors(ctx context.Context, contestID int) ([]Juror, error) {
+	gs, err := user.NewStore(s.log, s.db).QueryByRole(ctx, user.RoleJuror, contestID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "selecting jurors of contest %d", contestID)
+	}
+
+	js := make([]Juror, len(gs))
+	for i, g := range gs {
+		js[i] = Juror{
+			ContestID: g.ContestID,
+			UserID:    g.UserID,
+			Name:      g.Name,
+			Email:     g.Email,
+			CreatedOn: g.CreatedOn,
+		}
+	}
+
+	return js, nil
+}
+
+// IsJuror reports whether a user sits on the jury of a contest.
+func (s Store) IsJuror(ctx context.Context, contestID, userID int) (bool, error) {
+	gs, err := user.NewStore(s.log, s.db).QueryGrants(ctx, userID)
+	if err != nil {
+		return false, errors.Wrapf(err, "selecting juror %d", userID)
+	}
+
+	for _, g := range gs {
+		if g.Role == user.RoleJuror && g.ContestID == contestID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// AddCriterion adds a scoring criterion to a contest.
+func (s Store) AddCriterion(ctx context.Context, nc NewCriterion, now time.Time) (Criterion, error) {
+	if err := validate.Check(nc); err != nil {
+		return Criterion{}, errors.Wrap(err, "validating data")
+	}
+
+	c := Criterion{
+		ContestID: nc.ContestID,
+		Name:      nc.Name,
+		Weight:    nc.Weight,
+		CreatedOn: now.UTC(),
+	}
+
+	const query = `
+	INSERT INTO criterion
+		(contest_id, name, weight, created)
+	VALUES
+		(:contest_id, :name, :weight, :created)`
+
+	s.log.Printf("%s: %s", "jury.AddCriterion", database.Log(query, c))
+
+	id, err := database.NamedInsertID(ctx, s.db, query, c, "criterion_id")
+	if err != nil {
+		return Criterion{}, errors.Wrap(err, "inserting criterion")
+	}
+	c.ID = id
+
+	return c, nil
+}
+
+// RemoveCriterion deletes a criterion of a contest along with the scores
+// given for it.
+func (s Store) RemoveCriterion(ctx context.Context, contestID, criterionID int) error {
+	data := struct {
+		ContestID   int `db:"contest_id"`
+		CriterionID int `db:"criterion_id"`
+	}{
+		ContestID:   contestID,
+		CriterionID: criterionID,
+	}
+
+	const scores = `
+	DELETE FROM score
+	WHERE contest_id = :contest_id AND criterion_id = :criterion_id`
+	const criterion = `
+	DELETE FROM criterion
+	WHERE contest_id = :contest_id AND criterion_id = :criterion_id`
+
+	return database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		for _, query := range []string{scores, criterion} {
+			s.log.Printf("%s: %s", "jury.RemoveCriterion", database.Log(query, data))
+			if _, err := tx.NamedExecContext(ctx, query, data); err != nil {
+				return errors.Wrapf(err, "deleting criterion %d", criterionID)
+			}
+		}
+		return nil
+	})
+}
+
+// Criteria returns the scoring criteria of a contest.
+func (s Store) Criteria(ctx context.Context, contestID int) ([]Criterion, error) {
+	data := struct {
+		ContestID int `db:"contest_id"`
+	}{
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT criterion_id, contest_id, name, weight, created
+	FROM criterion
+	WHERE contest_id = :contest_id
+	ORDER BY criterion_id`
+
+	s.log.Printf("%s: %s", "jury.Criteria", database.Log(query, data))
+
+	var cs []Criterion
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &cs); err != nil {
+		return nil, errors.Wrapf(err, "selecting criteria of contest %d", contestID)
+	}
+
+	return cs, nil
+}
+
+// Score records the marks a juror gives a photo, keyed by criterion ID.
+// Scoring a photo again replaces the previous marks for those criteria.
+// It returns database.ErrNotFound when the photo is not an entry of the contest.
+func (s Store) Score(ctx context.Context, contestID, userID, photoID int, marks map[int]int, now time.Time) error {
+	ok, err := s.IsJuror(ctx, contestID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotJuror
+	}
+
+	criteria, err := s.Criteria(ctx, contestID)
+	if err != nil {
+		return err
+	}
+	known := make(map[int]bool)
+	for _, c := range criteria {
+		known[c.ID] = true
+	}
+	for id, v := range marks {
+		if !known[id] {
+			return ErrBadCriterion
+		}
+		if v < MinScore || v > MaxScore {
+			return ErrBadScore
+		}
+	}
+
+	const query = `
+	INSERT INTO score
+		(contest_id, photo_id, user_id, criterion_id, value, updated)
+	VALUES
+		(:contest_id, :photo_id, :user_id, :criterion_id, :value, :updated)
+	ON CONFLICT (photo_id, user_id, criterion_id) DO UPDATE SET
+		value = excluded.value,
+		updated = excluded.updated`
+
+	owner := struct {
+		ContestID int `db:"contest_id"`
+		PhotoID   int `db:"photo_id"`
+	}{
+		ContestID: contestID,
+		PhotoID:   photoID,
+	}
+	const check = `
+	SELECT contest_id, photo_id
+	FROM photo
+	WHERE photo_id = :photo_id AND contest_id = :contest_id`
+
+	return database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		s.log.Printf("%s: %s", "jury.Score", database.Log(check, owner))
+
+		// Jurors of one contest must not be able to move the standings of
+		// another, so the photo has to be an entry of this contest.
+		if err := database.NamedQueryStruct(ctx, tx, check, owner, &owner); err != nil {
+			if err == database.ErrNotFound {
+				return database.ErrNotFound
+			}
+			return errors.Wrapf(err, "selecting photo %d", photoID)
+		}
+
+		for id, v := range marks {
+			sc := Score{
+				ContestID:   contestID,
+				PhotoID:     photoID,
+				UserID:      userID,
+				CriterionID: id,
+				Value:       v,
+				UpdatedOn:   now.UTC(),
+			}
+
+			s.log.Printf("%s: %s", "jury.Score", database.Log(query, sc))
+
+			if _, err := tx.NamedExecContext(ctx, query, sc); err != nil {
+				return errors.Wrapf(err, "scoring photo %d", photoID)
+			}
+		}
+		return nil
+	})
+}
+
+// ScoresByJuror returns the marks a juror gave in a contest.
+func (s Store) ScoresByJuror(ctx context.Context, contestID, userID int) ([]Score, error) {
+	data := struct {
+		ContestID int `db:"contest_id"`
+		UserID    int `db:"user_id"`
+	}{
+		ContestID: contestID,
+		UserID:    userID,
+	}
+	const query = `
+	SELECT contest_id, photo_id, user_id, criterion_id, value, updated
+	FROM score
+	WHERE contest_id = :contest_id AND user_id = :user_id
+	ORDER BY photo_id, criterion_id`
+
+	s.log.Printf("%s: %s", "jury.ScoresByJuror", database.Log(query, data))
+
+	var ss []Score
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &ss); err != nil {
+		return nil, errors.Wrapf(err, "selecting scores of juror %d", userID)
+	}
+
+	return ss, nil
+}
+
+// Standings computes the jury score of every scored photo of a contest,
+// best first.
+func (s Store) Standings(ctx context.Context, contestID int) ([]Standing, error) {
+	data := struct {
+		ContestID int `db:"contest_id"`
+	}{
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT
+		s.photo_id, s.user_id, s.value, c.weight
+	FROM score s
+		JOIN criterion c ON c.criterion_id = s.criterion_id
+	WHERE s.contest_id = :contest_id`
+
+	s.log.Printf("%s: %s", "jury.Standings", database.Log(query, data))
+
+	var marks []mark
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &marks); err != nil {
+		return nil, errors.Wrapf(err, "selecting scores of contest %d", contestID)
+	}
+
+	return standings(marks), nil
+}
+
+// mark is a single weighted score used to compute standings.
+type mark struct {
+	PhotoID int     `db:"photo_id"`
+	UserID  int     `db:"user_id"`
+	Value   int     `db:"value"`
+	Weight  float64 `db:"weight"`
+}
+
+// standings balances the marks of the jurors. The weighted total each juror
+// gave each photo is turned into a z-score against everything that juror
+// scored, so a juror who only hands out 8s to 10s counts the same as one
+// who uses the whole scale. A photo's score is the mean of its z-scores.
+func standings(marks []mark) []Standing {
+	type key struct{ juror, photo int }
+	sums := make(map[key]float64)
+	weights := make(map[key]float64)
+	for _, m := range marks {
+		k := key{m.UserID, m.PhotoID}
+		sums[k] += m.Weight * float64(m.Value)
+		weights[k] += m.Weight
+	}
+
+	totals := make(map[int]map[int]float64)
+	for k, sum := range sums {
+		if totals[k.juror] == nil {
+			totals[k.juror] = make(map[int]float64)
+		}
+		totals[k.juror][k.photo] = sum / weights[k]
+	}
+
+	zs := make(map[int][]float64)
+	raws := make(map[int][]float64)
+	for _, byPhoto := range totals {
+		var mean float64
+		for _, t := range byPhoto {
+			mean += t
+		}
+		mean /= float64(len(byPhoto))
+
+		var variance float64
+		for _, t := range byPhoto {
+			variance += (t - mean) * (t - mean)
+		}
+		sd := math.Sqrt(variance / float64(len(byPhoto)))
+
+		for photoID, t := range byPhoto {
+			var z float64
+			if sd > 0 {
+				z = (t - mean) / sd
+			}
+			zs[photoID] = append(zs[photoID], z)
+			raws[photoID] = append(raws[photoID], t)
+		}
+	}
+
+	sts := make([]Standing, 0, len(zs))
+	for photoID, z := range zs {
+		sts = append(sts, Standing{
+			PhotoID: photoID,
+			Score:   mean(z),
+			Mean:    mean(raws[photoID]),
+			Median:  median(raws[photoID]),
+			Jurors:  len(z),
+		})
+	}
+	sort.Slice(sts, func(i, j int) bool {
+		if sts[i].Score != sts[j].Score {
+			return sts[i].Score > sts[j].Score
+		}
+		return sts[i].PhotoID < sts[j].PhotoID
+	})
+
+	return sts
+}
+
+// mean returns the arithmetic mean of vs.
+func mean(vs []float64) float64 {
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+// median returns the median of vs.
+func median(vs []float64) float64 {
+	s := append([]float64(nil), vs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
@@ -0,0 +1,173 @@
+package jury_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/jury"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"photo-contest/foundation/database"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestJury(t *testing.T) {
+	tests.Run(t, testJury)
+}
+
+func testJury(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	var users []user.AuthUser
+	for i := 0; i < 3; i++ {
+		usr, err := user.NewStore(log, db).Create(ctx, user.NewAuthUser{
+			Name:        fmt.Sprintf("Juror %d", i),
+			Email:       fmt.Sprintf("juror%d@example.com", i),
+			Pass:        "gophers",
+			PassConfirm: "gophers",
+		})
+		if err != nil {
+			t.Fatalf("creating user: %s", err)
+		}
+		users = append(users, usr)
+	}
+	lenient, harsh, outsider := users[0], users[1], users[2]
+
+	c, err := contest.NewStore(log, db).Create(ctx, contest.NewContest{
+		UserID:      lenient.ID,
+		Title:       "Urban Nature",
+		SubmitStart: now,
+		SubmitEnd:   now.Add(24 * time.Hour),
+	}, now)
+	if err != nil {
+		t.Fatalf("creating contest: %s", err)
+	}
+
+	var photos []photo.Photo
+	for i := 0; i < 3; i++ {
+		orig := photo.Original{SHA256: fmt.Sprintf("%064d", i), MIME: "image/jpeg", Size: 1, Width: 640, Height: 640}
+		np := photo.NewPhoto{ContestID: c.ID, UserID: outsider.ID, Title: fmt.Sprintf("Photo %d", i)}
+		p, err := photo.NewStore(log, db).Create(ctx, np, orig, now)
+		if err != nil {
+			t.Fatalf("creating photo: %s", err)
+		}
+		photos = append(photos, p)
+	}
+
+	other, err := contest.NewStore(log, db).Create(ctx, contest.NewContest{
+		UserID:      outsider.ID,
+		Title:       "Night Streets",
+		SubmitStart: now,
+		SubmitEnd:   now.Add(24 * time.Hour),
+	}, now)
+	if err != nil {
+		t.Fatalf("creating contest: %s", err)
+	}
+	orig := photo.Original{SHA256: fmt.Sprintf("%064d", 9), MIME: "image/jpeg", Size: 1, Width: 640, Height: 640}
+	foreign, err := photo.NewStore(log, db).Create(ctx, photo.NewPhoto{ContestID: other.ID, UserID: outsider.ID, Title: "Elsewhere"}, orig, now)
+	if err != nil {
+		t.Fatalf("creating photo: %s", err)
+	}
+
+	store := jury.NewStore(log, db)
+
+	t.Log("Given the need to score photos with a jury.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen setting up the jury.", testID)
+		{
+			for _, usr := range []user.AuthUser{lenient, harsh, harsh} {
+				if err := store.AddJuror(ctx, c.ID, usr.ID, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a juror : %s.", tests.Failed, testID, err)
+				}
+			}
+			js, err := store.Jurors(ctx, c.ID)
+			if err != nil || len(js) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould list two jurors : %d, %v.", tests.Failed, testID, len(js), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to add jurors.", tests.Success, testID)
+
+			if ok, err := store.IsJuror(ctx, c.ID, outsider.ID); ok || err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not count outsiders as jurors : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not count outsiders as jurors.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen scoring with weighted criteria.", testID)
+		{
+			comp, err := store.AddCriterion(ctx, jury.NewCriterion{ContestID: c.ID, Name: "Composition", Weight: 2}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to add a criterion : %s.", tests.Failed, testID, err)
+			}
+			tech, err := store.AddCriterion(ctx, jury.NewCriterion{ContestID: c.ID, Name: "Technique", Weight: 1}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to add a criterion : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to add criteria.", tests.Success, testID)
+
+			if err := store.Score(ctx, c.ID, outsider.ID, photos[0].ID, map[int]int{comp.ID: 5}, now); err != jury.ErrNotJuror {
+				t.Fatalf("\t%s\tTest %d:\tShould not let outsiders score : %v.", tests.Failed, testID, err)
+			}
+			if err := store.Score(ctx, c.ID, harsh.ID, photos[0].ID, map[int]int{comp.ID: 11}, now); err != jury.ErrBadScore {
+				t.Fatalf("\t%s\tTest %d:\tShould reject marks out of range : %v.", tests.Failed, testID, err)
+			}
+			if err := store.Score(ctx, c.ID, harsh.ID, photos[0].ID, map[int]int{comp.ID + 100: 5}, now); err != jury.ErrBadCriterion {
+				t.Fatalf("\t%s\tTest %d:\tShould reject unknown criteria : %v.", tests.Failed, testID, err)
+			}
+			if err := store.Score(ctx, c.ID, harsh.ID, foreign.ID, map[int]int{comp.ID: 5}, now); err != database.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not score photos of other contests : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject invalid scores.", tests.Success, testID)
+
+			// The lenient juror gives weighted totals of 9, 8 and 7 and the
+			// harsh one 3, 1 and 2.
+			marks := map[int][][2]int{
+				lenient.ID: {{10, 7}, {8, 8}, {7, 7}},
+				harsh.ID:   {{3, 3}, {1, 1}, {2, 2}},
+			}
+			if err := store.Score(ctx, c.ID, lenient.ID, photos[0].ID, map[int]int{comp.ID: 1, tech.ID: 1}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to score : %s.", tests.Failed, testID, err)
+			}
+			for jurorID, ms := range marks {
+				for i, m := range ms {
+					if err := store.Score(ctx, c.ID, jurorID, photos[i].ID, map[int]int{comp.ID: m[0], tech.ID: m[1]}, now); err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to score : %s.", tests.Failed, testID, err)
+					}
+				}
+			}
+			ss, err := store.ScoresByJuror(ctx, c.ID, lenient.ID)
+			if err != nil || len(ss) != 6 {
+				t.Fatalf("\t%s\tTest %d:\tShould replace earlier marks : %d, %v.", tests.Failed, testID, len(ss), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to score.", tests.Success, testID)
+
+			sts, err := store.Standings(ctx, c.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to compute standings : %s.", tests.Failed, testID, err)
+			}
+			if len(sts) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould rank three photos : got %d.", tests.Failed, testID, len(sts))
+			}
+			top := sts[0]
+			if top.PhotoID != photos[0].ID || top.Jurors != 2 || top.Mean != 6 || top.Median != 6 {
+				t.Fatalf("\t%s\tTest %d:\tShould rank the first photo on top : got %+v.", tests.Failed, testID, top)
+			}
+			if math.Abs(top.Score-math.Sqrt(1.5)) > 1e-9 {
+				t.Fatalf("\t%s\tTest %d:\tShould normalize per juror : got %f.", tests.Failed, testID, top.Score)
+			}
+			if sts[1].PhotoID != photos[1].ID || sts[1].Score != sts[2].Score {
+				t.Fatalf("\t%s\tTest %d:\tShould balance harsh and lenient jurors : got %+v.", tests.Failed, testID, sts)
+			}
+			t.Logf("\t%s\tTest %d:\tShould balance harsh and lenient jurors.", tests.Success, testID)
+		}
+	}
+}
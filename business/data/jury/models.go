@@ -0,0 +1,70 @@
+package jury
+
+import (
+	"time"
+)
+
+// Juror - user assigned to judge a contest
+type Juror struct {
+	ContestID int       `db:"contest_id" json:"contest_id"`
+	UserID    int       `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	Email     string    `db:"email" json:"email"`
+	CreatedOn time.Time `db:"created" json:"date_created"`
+}
+
+// Criterion - aspect of a photo the jury scores, with its weight in the total
+type Criterion struct {
+	ID        int       `db:"criterion_id" json:"id"`
+	ContestID int       `db:"contest_id" json:"contest_id"`
+	Name      string    `db:"name" json:"name"`
+	Weight    float64   `db:"weight" json:"weight"`
+	CreatedOn time.Time `db:"created" json:"date_created"`
+}
+
+// NewCriterion - struct for adding criteria to a contest
+type NewCriterion struct {
+	ContestID int     `json:"contest_id" validate:"required"`
+	Name      string  `json:"name" validate:"required,max=100"`
+	Weight    float64 `json:"weight" validate:"gt=0"`
+}
+
+// DefaultCriteria are offered to contests that don't define their own.
+var DefaultCriteria = []NewCriterion{
+	{Name: "Composition", Weight: 1},
+	{Name: "Technique", Weight: 1},
+	{Name: "Theme fit", Weight: 1},
+}
+
+// Score - mark a juror gave a photo on one criterion
+type Score struct {
+	ContestID   int       `db:"contest_id" json:"contest_id"`
+	PhotoID     int       `db:"photo_id" json:"photo_id"`
+	UserID      int       `db:"user_id" json:"user_id"`
+	CriterionID int       `db:"criterion_id" json:"criterion_id"`
+	Value       int       `db:"value" json:"value"`
+	UpdatedOn   time.Time `db:"updated" json:"date_updated"`
+}
+
+// Set of bounds for the marks given by jurors.
+const (
+	MinScore = 1
+	MaxScore = 10
+)
+
+// Standing - jury score of a photo, balanced across jurors
+type Standing struct {
+	PhotoID int `json:"photo_id"`
+
+	// Score is the mean of the normalized scores the jurors gave the photo.
+	// Each juror's weighted totals are turned into z-scores so harsh and
+	// lenient jurors weigh the same.
+	Score float64 `json:"score"`
+
+	// Mean and Median are computed over the raw weighted totals.
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+
+	// Jurors is the number of jurors that scored the photo.
+	Jurors int `json:"jurors"`
+}
@@ -0,0 +1,224 @@
+// Package lockout provides support for throttling failed logins per account
+// and per address.
+package lockout
+
+import (
+	"context"
+	"log"
+	"photo-contest/foundation/database"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Store manages the set of API's for lockout access.
+type Store struct {
+	log      *log.Logger
+	db       *sqlx.DB
+	policies map[Kind]Policy
+}
+
+// NewStore constructs a lockout store for api access using DefaultPolicies.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log:      log,
+		db:       db,
+		policies: DefaultPolicies,
+	}
+}
+
+// Query returns the failures counted against a key. Keys without failures
+// give back an empty throttle.
+func (s Store) Query(ctx context.Context, kind Kind, key string) (Throttle, error) {
+	data := struct {
+		Kind Kind   `db:"kind"`
+		Key  string `db:"key"`
+	}{
+		Kind: kind,
+		Key:  key,
+	}
+	const query = `
+	SELECT
+		kind, key, failures, last_failure, locked_until
+	FROM login_throttle
+	WHERE kind = :kind AND key = :key`
+
+	s.log.Printf("%s: %s", "lockout.Query", database.Log(query, data))
+
+	var t Throttle
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &t); err != nil {
+		if err == database.ErrNotFound {
+			return Throttle{Kind: kind, Key: key}, nil
+		}
+		return Throttle{}, errors.Wrapf(err, "selecting %s throttle", kind)
+	}
+
+	return t, nil
+}
+
+// Fail counts a failed login against a key and locks it once the policy of
+// its kind says so. Failures older than the policy window start over.
+func (s Store) Fail(ctx context.Context, kind Kind, key string, now time.Time) (Throttle, error) {
+	policy := s.policies[kind]
+	now = now.UTC()
+
+	data := struct {
+		Kind        Kind      `db:"kind"`
+		Key         string    `db:"key"`
+		Now         time.Time `db:"now"`
+		WindowStart time.Time `db:"window_start"`
+	}{
+		Kind:        kind,
+		Key:         key,
+		Now:         now,
+		WindowStart: now.Add(-policy.Window),
+	}
+
+	// The count is raised by the database in one statement so failures
+	// arriving together are all counted; under Postgres the upsert also
+	// holds the row lock until commit, so the lock below goes with the count
+	// read back. The driver's SQLite predates RETURNING, so the count is
+	// read back in the same transaction instead.
+	const fail = `
+	INSERT INTO login_throttle
+		(kind, key, failures, last_failure, locked_until)
+	VALUES
+		(:kind, :key, 1, :now, NULL)
+	ON CONFLICT (kind, key) DO UPDATE SET
+		failures = CASE WHEN login_throttle.last_failure < :window_start THEN 1 ELSE login_throttle.failures + 1 END,
+		locked_until = CASE WHEN login_throttle.last_failure < :window_start THEN NULL ELSE login_throttle.locked_until END,
+		last_failure = excluded.last_failure`
+	const query = `
+	SELECT
+		kind, key, failures, last_failure, locked_until
+	FROM login_throttle
+	WHERE kind = :kind AND key = :key`
+
+	var t Throttle
+	err := database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		s.log.Printf("%s: %s", "lockout.Fail", database.Log(fail, data))
+
+		if _, err := tx.NamedExecContext(ctx, fail, data); err != nil {
+			return errors.Wrapf(err, "counting %s failure", kind)
+		}
+		if err := database.NamedQueryStruct(ctx, tx, query, data, &t); err != nil {
+			return errors.Wrapf(err, "selecting %s throttle", kind)
+		}
+
+		delay := policy.Delay(t.Failures)
+		if delay <= 0 {
+			return nil
+		}
+		until := now.Add(delay)
+		t.LockedUntil = &until
+
+		const lock = `
+		UPDATE login_throttle SET
+			locked_until = :locked_until
+		WHERE kind = :kind AND key = :key`
+
+		s.log.Printf("%s: %s", "lockout.Fail", database.Log(lock, t))
+
+		if _, err := tx.NamedExecContext(ctx, lock, t); err != nil {
+			return errors.Wrapf(err, "locking %s", kind)
+		}
+
+		e := Event{
+			Kind:        kind,
+			Key:         key,
+			Failures:    t.Failures,
+			LockedUntil: until,
+			CreatedOn:   now,
+		}
+		const event = `
+		INSERT INTO lockout_event
+			(kind, key, failures, locked_until, created)
+		VALUES
+			(:kind, :key, :failures, :locked_until, :created)`
+
+		s.log.Printf("%s: %s", "lockout.Fail", database.Log(event, e))
+
+		if _, err := tx.NamedExecContext(ctx, event, e); err != nil {
+			return errors.Wrapf(err, "recording %s lockout", kind)
+		}
+		return nil
+	})
+	if err != nil {
+		return Throttle{}, err
+	}
+
+	return t, nil
+}
+
+// Reset forgets the failures counted against a key. It is used after a
+// successful login and by admins to unlock a key.
+func (s Store) Reset(ctx context.Context, kind Kind, key string) error {
+	data := struct {
+		Kind Kind   `db:"kind"`
+		Key  string `db:"key"`
+	}{
+		Kind: kind,
+		Key:  key,
+	}
+	const query = `
+	DELETE FROM login_throttle
+	WHERE kind = :kind AND key = :key`
+
+	s.log.Printf("%s: %s", "lockout.Reset", database.Log(query, data))
+
+	if _, err := s.db.NamedExecContext(ctx, query, data); err != nil {
+		return errors.Wrapf(err, "resetting %s throttle", kind)
+	}
+
+	return nil
+}
+
+// QueryLocked retrieves the keys locked at the given time, the longest
+// locked first.
+func (s Store) QueryLocked(ctx context.Context, now time.Time) ([]Throttle, error) {
+	data := struct {
+		Now time.Time `db:"now"`
+	}{
+		Now: now.UTC(),
+	}
+	const query = `
+	SELECT
+		kind, key, failures, last_failure, locked_until
+	FROM login_throttle
+	WHERE locked_until > :now
+	ORDER BY locked_until DESC`
+
+	s.log.Printf("%s: %s", "lockout.QueryLocked", database.Log(query, data))
+
+	var ts []Throttle
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &ts); err != nil {
+		return nil, errors.Wrap(err, "selecting locked throttles")
+	}
+
+	return ts, nil
+}
+
+// QueryEvents retrieves the most recent lockouts.
+func (s Store) QueryEvents(ctx context.Context, limit int) ([]Event, error) {
+	data := struct {
+		Limit int `db:"limit"`
+	}{
+		Limit: limit,
+	}
+	const query = `
+	SELECT
+		event_id, kind, key, failures, locked_until, created
+	FROM lockout_event
+	ORDER BY created DESC, event_id DESC
+	LIMIT :limit`
+
+	s.log.Printf("%s: %s", "lockout.QueryEvents", database.Log(query, data))
+
+	var es []Event
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &es); err != nil {
+		return nil, errors.Wrap(err, "selecting lockout events")
+	}
+
+	return es, nil
+}
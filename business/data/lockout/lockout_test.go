@@ -0,0 +1,119 @@
+package lockout_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/lockout"
+	"photo-contest/business/data/tests"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestLockout(t *testing.T) {
+	tests.Run(t, testLockout)
+}
+
+func testLockout(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	store := lockout.NewStore(log, db)
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+	policy := lockout.DefaultPolicies[lockout.KindAccount]
+	const email = "target@example.com"
+
+	t.Log("Given the need to throttle failed logins.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen an account keeps failing.", testID)
+		{
+			var th lockout.Throttle
+			var err error
+			for i := 0; i < policy.Free; i++ {
+				if th, err = store.Fail(ctx, lockout.KindAccount, email, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to count a failure : %s.", tests.Failed, testID, err)
+				}
+			}
+			if th.Locked(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow the free failures.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow the free failures.", tests.Success, testID)
+
+			th, err = store.Fail(ctx, lockout.KindAccount, email, now)
+			if err != nil || !th.Locked(now) || th.Locked(now.Add(policy.Base)) {
+				t.Fatalf("\t%s\tTest %d:\tShould lock the account for the base delay : %+v, %v.", tests.Failed, testID, th, err)
+			}
+			th, err = store.Fail(ctx, lockout.KindAccount, email, now)
+			if err != nil || !th.Locked(now.Add(policy.Base)) || th.Locked(now.Add(2*policy.Base)) {
+				t.Fatalf("\t%s\tTest %d:\tShould double the delay : %+v, %v.", tests.Failed, testID, th, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould back off exponentially.", tests.Success, testID)
+
+			if policy.Delay(1000) != policy.Max {
+				t.Fatalf("\t%s\tTest %d:\tShould cap the delay : %s.", tests.Failed, testID, policy.Delay(1000))
+			}
+			t.Logf("\t%s\tTest %d:\tShould cap the delay.", tests.Success, testID)
+
+			saved, err := store.Query(ctx, lockout.KindAccount, email)
+			if err != nil || saved.Failures != policy.Free+2 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the failures : %+v, %v.", tests.Failed, testID, saved, err)
+			}
+			locked, err := store.QueryLocked(ctx, now)
+			if err != nil || len(locked) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould list the locked account : %d, %v.", tests.Failed, testID, len(locked), err)
+			}
+			events, err := store.QueryEvents(ctx, 10)
+			if err != nil || len(events) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould record the lockouts : %d, %v.", tests.Failed, testID, len(events), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould surface the lockouts.", tests.Success, testID)
+
+			if err := store.Reset(ctx, lockout.KindAccount, email); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unlock : %s.", tests.Failed, testID, err)
+			}
+			saved, err = store.Query(ctx, lockout.KindAccount, email)
+			if err != nil || saved.Failures != 0 || saved.Locked(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unlock : %+v, %v.", tests.Failed, testID, saved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to unlock.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen failures are old.", testID)
+		{
+			if _, err := store.Fail(ctx, lockout.KindIP, "192.0.2.1", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to count a failure : %s.", tests.Failed, testID, err)
+			}
+			window := lockout.DefaultPolicies[lockout.KindIP].Window
+			th, err := store.Fail(ctx, lockout.KindIP, "192.0.2.1", now.Add(window+time.Second))
+			if err != nil || th.Failures != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould forget failures outside the window : %+v, %v.", tests.Failed, testID, th, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould forget failures outside the window.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen failures arrive together.", testID)
+		{
+			const n = 10
+			errs := make(chan error, n)
+			for i := 0; i < n; i++ {
+				go func() {
+					_, err := store.Fail(ctx, lockout.KindIP, "192.0.2.2", now)
+					errs <- err
+				}()
+			}
+			for i := 0; i < n; i++ {
+				if err := <-errs; err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to count a failure : %s.", tests.Failed, testID, err)
+				}
+			}
+			th, err := store.Query(ctx, lockout.KindIP, "192.0.2.2")
+			if err != nil || th.Failures != n {
+				t.Fatalf("\t%s\tTest %d:\tShould count every failure : %+v, %v.", tests.Failed, testID, th, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count every failure.", tests.Success, testID)
+		}
+	}
+}
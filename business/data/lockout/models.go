@@ -0,0 +1,74 @@
+package lockout
+
+import (
+	"time"
+)
+
+// Kind - what failed logins are counted against
+type Kind string
+
+// Set of things failed logins are counted against.
+const (
+	KindAccount Kind = "account"
+	KindIP      Kind = "ip"
+)
+
+// Policy - how many failures are tolerated before logins are slowed down
+type Policy struct {
+	// Free is the number of failures allowed before any lockout.
+	Free int
+
+	// Every failure past the free ones locks the key for Base, doubled for
+	// each further failure, up to Max.
+	Base time.Duration
+	Max  time.Duration
+
+	// Failures older than Window are forgotten.
+	Window time.Duration
+}
+
+// Delay returns how long a key is locked after the given number of failures.
+func (p Policy) Delay(failures int) time.Duration {
+	over := failures - p.Free
+	if over <= 0 {
+		return 0
+	}
+	d := p.Base
+	for i := 1; i < over && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	return d
+}
+
+// DefaultPolicies are lenient with addresses since many users can share one.
+var DefaultPolicies = map[Kind]Policy{
+	KindAccount: {Free: 5, Base: time.Second, Max: 15 * time.Minute, Window: 24 * time.Hour},
+	KindIP:      {Free: 20, Base: time.Second, Max: 15 * time.Minute, Window: time.Hour},
+}
+
+// Throttle - failed logins counted against an account or address
+type Throttle struct {
+	Kind        Kind       `db:"kind" json:"kind"`
+	Key         string     `db:"key" json:"key"`
+	Failures    int        `db:"failures" json:"failures"`
+	LastFailure time.Time  `db:"last_failure" json:"date_last_failure"`
+	LockedUntil *time.Time `db:"locked_until" json:"date_locked_until,omitempty"`
+}
+
+// Locked reports whether logins for the key are refused at the given time.
+func (t Throttle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
+
+// Event - lockout of an account or address, kept for admins
+type Event struct {
+	ID          int       `db:"event_id" json:"id"`
+	Kind        Kind      `db:"kind" json:"kind"`
+	Key         string    `db:"key" json:"key"`
+	Failures    int       `db:"failures" json:"failures"`
+	LockedUntil time.Time `db:"locked_until" json:"date_locked_until"`
+	CreatedOn   time.Time `db:"created" json:"date_created"`
+}
@@ -0,0 +1,110 @@
+package photo
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"photo-contest/foundation/imaging"
+
+	"github.com/pkg/errors"
+)
+
+// Size - name of a rendition generated for the gallery
+type Size string
+
+// Set of renditions generated for every submitted photo.
+const (
+	SizeThumb  Size = "thumb"
+	SizeMedium Size = "medium"
+	SizeFull   Size = "full"
+)
+
+// Sizes maps each rendition to the length of its longest edge in pixels.
+var Sizes = map[Size]int{
+	SizeThumb:  320,
+	SizeMedium: 1024,
+	SizeFull:   2048,
+}
+
+// derivativeQuality is the JPEG quality used for all renditions.
+const derivativeQuality = 85
+
+// ErrUnknownSize is returned when asking for a rendition that doesn't exist.
+var ErrUnknownSize = errors.New("unknown photo size")
+
+// DerivativePath returns the location of a rendition of the given original.
+// Renditions are always JPEGs and live next to the original.
+func (s Storage) DerivativePath(sum string, size Size) string {
+	return filepath.Join(s.Dir(sum), sum+"_"+string(size)+".jpg")
+}
+
+// Derive generates all the renditions of a stored original. Renditions that
+// are already on disk are left alone, so it is safe to call it again for an
+// original that was uploaded before.
+//
+// Renditions are re-encoded from the decoded pixels, so none of the metadata
+// of the original (GPS position, camera serial numbers, owner names) makes
+// it into the files we serve. The EXIF orientation is applied to the pixels
+// instead, since the tag is dropped with the rest.
+func (s Storage) Derive(orig Original) error {
+	var missing []Size
+	for size := range Sizes {
+		if _, err := os.Stat(s.DerivativePath(orig.SHA256, size)); os.IsNotExist(err) {
+			missing = append(missing, size)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	f, err := os.Open(s.OriginalPath(orig.SHA256, orig.MIME))
+	if err != nil {
+		return errors.Wrap(err, "opening original")
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return errors.Wrapf(err, "decoding %s", orig.SHA256)
+	}
+
+	e, err := s.EXIF(orig)
+	if err != nil {
+		return err
+	}
+
+	for _, size := range missing {
+		if err := s.writeDerivative(img, e.Orientation, orig.SHA256, size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeDerivative scales img for the given size, turns the result upright
+// according to the EXIF orientation and writes it to disk. Orienting after
+// scaling keeps the full size original from being copied pixel by pixel.
+// The file is written under a unique temporary name first, so a partially
+// written rendition is never served and requests deriving the same photo at
+// once don't write over each other's files.
+func (s Storage) writeDerivative(img image.Image, orientation int, sum string, size Size) error {
+	dst := s.DerivativePath(sum, size)
+
+	f, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "creating %s rendition", size)
+	}
+	defer os.Remove(f.Name())
+
+	if err := imaging.EncodeJPEG(f, imaging.Orient(imaging.Fit(img, Sizes[size]), orientation), derivativeQuality); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "encoding %s rendition", size)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "writing %s rendition", size)
+	}
+
+	return os.Rename(f.Name(), dst)
+}
@@ -0,0 +1,136 @@
+package photo
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// ErrBadEXIF is returned for images carrying EXIF data that can't be read.
+var ErrBadEXIF = errors.New("photo metadata can't be read")
+
+// exifTimeLayout is the format EXIF uses for dates.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// ReadEXIF extracts the metadata we care about from an image. Images without
+// EXIF data (PNG, WebP or stripped JPEGs) give back an empty EXIF and no error;
+// EXIF data that can't be read is an error.
+func ReadEXIF(r io.Reader) (EXIF, error) {
+	x, err := exif.Decode(r)
+	if err != nil {
+		switch {
+		case noEXIF(err):
+			return EXIF{}, nil
+		case x == nil || exif.IsCriticalError(err):
+			return EXIF{}, errors.Wrapf(ErrBadEXIF, "decoding exif: %v", err)
+		}
+
+		// Only a sub-directory, such as the GPS one, failed to load; the
+		// tags read from the others are still good.
+	}
+
+	var e EXIF
+	e.CameraMake = exifString(x, exif.Make)
+	e.CameraModel = exifString(x, exif.Model)
+	e.LensModel = exifString(x, exif.LensModel)
+	e.Orientation = exifInt(x, exif.Orientation)
+	e.ISO = exifInt(x, exif.ISOSpeedRatings)
+
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && num > 0 && den > 0 {
+			e.ExposureTime = big.NewRat(num, den).RatString()
+		}
+	}
+	if tag, err := x.Get(exif.FNumber); err == nil {
+		if r, err := tag.Rat(0); err == nil {
+			e.FNumber, _ = r.Float64()
+		}
+	}
+	if tag, err := x.Get(exif.FocalLength); err == nil {
+		if r, err := tag.Rat(0); err == nil {
+			e.FocalLength, _ = r.Float64()
+		}
+	}
+
+	// Cameras record the wall clock without a time zone, take it as UTC.
+	if s := exifString(x, exif.DateTimeOriginal); s != "" {
+		if t, err := time.Parse(exifTimeLayout, s); err == nil {
+			e.TakenOn = &t
+		}
+	}
+
+	if lat, lng, err := x.LatLong(); err == nil {
+		e.Latitude = &lat
+		e.Longitude = &lng
+	}
+
+	return e, nil
+}
+
+// noEXIF reports whether err says the image carries no EXIF at all: the
+// JPEG has no APP1 segment, or only one holding something else, like XMP.
+// The decoder has no error values for either.
+func noEXIF(err error) bool {
+	return err == io.EOF || strings.Contains(err.Error(), "failed to find exif intro marker")
+}
+
+// exifString returns the string value of a tag or "" if it is missing.
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	s, _ := tag.StringVal()
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+// exifInt returns the integer value of a tag or 0 if it is missing.
+func exifInt(x *exif.Exif, name exif.FieldName) int {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.IntVal {
+		return 0
+	}
+	v, _ := tag.Int(0)
+	return v
+}
+
+// EXIF reads the metadata of a stored original.
+func (s Storage) EXIF(orig Original) (EXIF, error) {
+	if orig.MIME != "image/jpeg" {
+		return EXIF{}, nil
+	}
+
+	f, err := os.Open(s.OriginalPath(orig.SHA256, orig.MIME))
+	if err != nil {
+		return EXIF{}, errors.Wrap(err, "opening original")
+	}
+	defer f.Close()
+
+	return ReadEXIF(f)
+}
+
+// Summary returns the exposure settings in the short form photographers use,
+// eg "1/250s f/8 ISO 200 50mm".
+func (e EXIF) Summary() string {
+	var parts []string
+	if e.ExposureTime != "" {
+		parts = append(parts, e.ExposureTime+"s")
+	}
+	if e.FNumber > 0 {
+		parts = append(parts, fmt.Sprintf("f/%g", e.FNumber))
+	}
+	if e.ISO > 0 {
+		parts = append(parts, fmt.Sprintf("ISO %d", e.ISO))
+	}
+	if e.FocalLength > 0 {
+		parts = append(parts, fmt.Sprintf("%gmm", e.FocalLength))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,87 @@
+package photo
+
+import (
+	"time"
+)
+
+// Photo - photo submitted to a contest
+type Photo struct {
+	ID        int       `db:"photo_id" json:"id"`
+	ContestID int       `db:"contest_id" json:"contest_id"`
+	UserID    int       `db:"user_id" json:"user_id"`
+	Title     string    `db:"title" json:"title"`
+	Caption   string    `db:"caption" json:"caption"`
+	Category  string    `db:"category" json:"category"`
+	SHA256    string    `db:"sha256" json:"sha256"`
+	MIME      string    `db:"mime" json:"mime"`
+	Size      int64     `db:"size" json:"size"`
+	Width     int       `db:"width" json:"width"`
+	Height    int       `db:"height" json:"height"`
+	CreatedOn time.Time `db:"created" json:"date_created"`
+}
+
+// Original returns the description of the stored original file.
+func (p Photo) Original() Original {
+	return Original{
+		SHA256: p.SHA256,
+		MIME:   p.MIME,
+		Size:   p.Size,
+		Width:  p.Width,
+		Height: p.Height,
+	}
+}
+
+// EXIF - metadata extracted from the original of a photo. GPS coordinates
+// are kept for rule checks and the organizers only, they are never sent to
+// clients.
+type EXIF struct {
+	PhotoID      int        `db:"photo_id" json:"photo_id"`
+	CameraMake   string     `db:"camera_make" json:"camera_make"`
+	CameraModel  string     `db:"camera_model" json:"camera_model"`
+	LensModel    string     `db:"lens_model" json:"lens_model"`
+	ExposureTime string     `db:"exposure_time" json:"exposure_time"`
+	FNumber      float64    `db:"f_number" json:"f_number"`
+	ISO          int        `db:"iso" json:"iso"`
+	FocalLength  float64    `db:"focal_length" json:"focal_length"`
+	Orientation  int        `db:"orientation" json:"-"`
+	TakenOn      *time.Time `db:"taken" json:"date_taken,omitempty"`
+	Latitude     *float64   `db:"gps_lat" json:"-"`
+	Longitude    *float64   `db:"gps_lng" json:"-"`
+}
+
+// NewPhoto - struct for submitting new photos
+type NewPhoto struct {
+	ContestID int    `json:"contest_id" validate:"required"`
+	UserID    int    `json:"user_id" validate:"required"`
+	Title     string `json:"title" validate:"required,max=200"`
+	Caption   string `json:"caption" validate:"max=2000"`
+	Category  string `json:"category" validate:"max=100"`
+}
+
+// Original describes an uploaded file once it has been written to the
+// storage and checked against the upload limits.
+type Original struct {
+	SHA256 string
+	MIME   string
+	Size   int64
+	Width  int
+	Height int
+}
+
+// Limits - constraints an upload has to satisfy
+type Limits struct {
+	MaxBytes  int64
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+}
+
+// DefaultLimits are used when no explicit limits are configured.
+var DefaultLimits = Limits{
+	MaxBytes:  20 << 20,
+	MinWidth:  640,
+	MinHeight: 640,
+	MaxWidth:  12000,
+	MaxHeight: 12000,
+}
@@ -0,0 +1,257 @@
+// Package photo provides support for storing and managing contest photos.
+package photo
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ErrDuplicate is returned when the same file was already submitted to a contest.
+var ErrDuplicate = errors.New("photo was already submitted to this contest")
+
+// Store manages the set of API's for photo access.
+type Store struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// NewStore constructs a photo store for api access.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create records a submission of an already stored original.
+func (s Store) Create(ctx context.Context, np NewPhoto, orig Original, now time.Time) (Photo, error) {
+	return s.create(ctx, s.db, np, orig, now)
+}
+
+// Submit records a submission of an already stored original along with its
+// metadata, in one transaction so a photo is never left without them.
+func (s Store) Submit(ctx context.Context, np NewPhoto, orig Original, e EXIF, now time.Time) (Photo, error) {
+	var p Photo
+	err := database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		var err error
+		if p, err = s.create(ctx, tx, np, orig, now); err != nil {
+			return err
+		}
+		return s.saveEXIF(ctx, tx, p.ID, e)
+	})
+	if err != nil {
+		return Photo{}, err
+	}
+
+	return p, nil
+}
+
+// create inserts the photo using db, the database or a transaction.
+func (s Store) create(ctx context.Context, db sqlx.ExtContext, np NewPhoto, orig Original, now time.Time) (Photo, error) {
+	if err := validate.Check(np); err != nil {
+		return Photo{}, errors.Wrap(err, "validating data")
+	}
+
+	_, err := s.queryBySHA256(ctx, db, np.ContestID, orig.SHA256)
+	switch {
+	case err == nil:
+		return Photo{}, ErrDuplicate
+	case err != database.ErrNotFound:
+		return Photo{}, errors.Wrap(err, "checking for duplicates")
+	}
+
+	p := Photo{
+		ContestID: np.ContestID,
+		UserID:    np.UserID,
+		Title:     np.Title,
+		Caption:   np.Caption,
+		Category:  np.Category,
+		SHA256:    orig.SHA256,
+		MIME:      orig.MIME,
+		Size:      orig.Size,
+		Width:     orig.Width,
+		Height:    orig.Height,
+		CreatedOn: now.UTC(),
+	}
+
+	const query = `
+	INSERT INTO photo
+		(contest_id, user_id, title, caption, category, sha256, mime, size, width, height, created)
+	VALUES
+		(:contest_id, :user_id, :title, :caption, :category, :sha256, :mime, :size, :width, :height, :created)`
+
+	s.log.Printf("%s: %s", "photo.Create", database.Log(query, p))
+
+	id, err := database.NamedInsertID(ctx, db, query, p, "photo_id")
+	if err != nil {
+		return Photo{}, errors.Wrap(err, "inserting photo")
+	}
+	p.ID = id
+
+	return p, nil
+}
+
+// QueryByID - return given photo
+func (s Store) QueryByID(ctx context.Context, photoID int) (Photo, error) {
+	data := struct {
+		PhotoID int `db:"photo_id"`
+	}{
+		PhotoID: photoID,
+	}
+	const query = `
+	SELECT
+		photo_id, contest_id, user_id, title, caption, category, sha256, mime, size, width, height, created
+	FROM photo
+	WHERE photo_id = :photo_id`
+
+	s.log.Printf("%s: %s", "photo.QueryByID", database.Log(query, data))
+
+	var p Photo
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &p); err != nil {
+		if err == database.ErrNotFound {
+			return Photo{}, database.ErrNotFound
+		}
+		return Photo{}, errors.Wrapf(err, "selecting photo %d", data.PhotoID)
+	}
+
+	return p, nil
+}
+
+// CountBySHA256 returns how many photos, in any contest, share the given
+// content hash and so the stored original.
+func (s Store) CountBySHA256(ctx context.Context, sum string) (int, error) {
+	data := struct {
+		SHA256 string `db:"sha256"`
+	}{
+		SHA256: sum,
+	}
+	const query = `
+	SELECT
+		COUNT(*) AS n
+	FROM photo
+	WHERE sha256 = :sha256`
+
+	s.log.Printf("%s: %s", "photo.CountBySHA256", database.Log(query, data))
+
+	var row struct {
+		N int `db:"n"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &row); err != nil {
+		return 0, errors.Wrapf(err, "counting photos %q", data.SHA256)
+	}
+
+	return row.N, nil
+}
+
+// QueryBySHA256 returns the photo with the given content hash submitted to a contest.
+func (s Store) QueryBySHA256(ctx context.Context, contestID int, sum string) (Photo, error) {
+	return s.queryBySHA256(ctx, s.db, contestID, sum)
+}
+
+// queryBySHA256 looks the photo up using db, the database or a transaction.
+func (s Store) queryBySHA256(ctx context.Context, db sqlx.ExtContext, contestID int, sum string) (Photo, error) {
+	data := struct {
+		ContestID int    `db:"contest_id"`
+		SHA256    string `db:"sha256"`
+	}{
+		ContestID: contestID,
+		SHA256:    sum,
+	}
+	const query = `
+	SELECT
+		photo_id, contest_id, user_id, title, caption, category, sha256, mime, size, width, height, created
+	FROM photo
+	WHERE contest_id = :contest_id AND sha256 = :sha256`
+
+	s.log.Printf("%s: %s", "photo.QueryBySHA256", database.Log(query, data))
+
+	var p Photo
+	if err := database.NamedQueryStruct(ctx, db, query, data, &p); err != nil {
+		if err == database.ErrNotFound {
+			return Photo{}, database.ErrNotFound
+		}
+		return Photo{}, errors.Wrapf(err, "selecting photo %q", data.SHA256)
+	}
+
+	return p, nil
+}
+
+// QueryByContest retrieves the photos submitted to a contest, oldest first.
+func (s Store) QueryByContest(ctx context.Context, contestID int) ([]Photo, error) {
+	data := struct {
+		ContestID int `db:"contest_id"`
+	}{
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT
+		photo_id, contest_id, user_id, title, caption, category, sha256, mime, size, width, height, created
+	FROM photo
+	WHERE contest_id = :contest_id
+	ORDER BY created, photo_id`
+
+	s.log.Printf("%s: %s", "photo.QueryByContest", database.Log(query, data))
+
+	var ps []Photo
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &ps); err != nil {
+		return nil, errors.Wrapf(err, "selecting photos for contest %d", contestID)
+	}
+
+	return ps, nil
+}
+
+// saveEXIF stores the metadata extracted from the original of a photo,
+// using db, the database or a transaction.
+func (s Store) saveEXIF(ctx context.Context, db sqlx.ExtContext, photoID int, e EXIF) error {
+	e.PhotoID = photoID
+
+	const query = `
+	INSERT INTO photo_exif
+		(photo_id, camera_make, camera_model, lens_model, exposure_time, f_number, iso,
+		focal_length, orientation, taken, gps_lat, gps_lng)
+	VALUES
+		(:photo_id, :camera_make, :camera_model, :lens_model, :exposure_time, :f_number, :iso,
+		:focal_length, :orientation, :taken, :gps_lat, :gps_lng)`
+
+	// Don't log the values, they include the GPS coordinates.
+	s.log.Printf("%s: photo %d", "photo.saveEXIF", photoID)
+
+	if _, err := sqlx.NamedExecContext(ctx, db, query, e); err != nil {
+		return errors.Wrapf(err, "inserting exif for photo %d", photoID)
+	}
+
+	return nil
+}
+
+// QueryEXIF returns the metadata of the given photo.
+func (s Store) QueryEXIF(ctx context.Context, photoID int) (EXIF, error) {
+	data := struct {
+		PhotoID int `db:"photo_id"`
+	}{
+		PhotoID: photoID,
+	}
+	const query = `
+	SELECT
+		photo_id, camera_make, camera_model, lens_model, exposure_time, f_number, iso,
+		focal_length, orientation, taken, gps_lat, gps_lng
+	FROM photo_exif
+	WHERE photo_id = :photo_id`
+
+	s.log.Printf("%s: %s", "photo.QueryEXIF", database.Log(query, data))
+
+	var e EXIF
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &e); err != nil {
+		if err == database.ErrNotFound {
+			return EXIF{}, database.ErrNotFound
+		}
+		return EXIF{}, errors.Wrapf(err, "selecting exif for photo %d", data.PhotoID)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,414 @@
+package photo_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// newPNG encodes a solid image of the given size.
+func newPNG(t *testing.T, w, h int, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding png: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// exifTag is a single TIFF directory entry used to build test EXIF blocks.
+type exifTag struct {
+	id    uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// Set of TIFF field types used by the test EXIF blocks.
+const (
+	tiffASCII    = 2
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+func asciiTag(id uint16, s string) exifTag {
+	return exifTag{id, tiffASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func shortTag(id uint16, v uint16) exifTag {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	return exifTag{id, tiffShort, 1, b}
+}
+
+func longTag(id uint16, v uint32) exifTag {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return exifTag{id, tiffLong, 1, b}
+}
+
+func ratTag(id uint16, vals ...uint32) exifTag {
+	b := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return exifTag{id, tiffRational, uint32(len(vals) / 2), b}
+}
+
+// exifDir encodes a TIFF directory that starts at offset start, followed by
+// the values that don't fit in the entries.
+func exifDir(start uint32, tags []exifTag) []byte {
+	var dir, data bytes.Buffer
+	dataStart := start + 2 + 12*uint32(len(tags)) + 4
+
+	binary.Write(&dir, binary.LittleEndian, uint16(len(tags)))
+	for _, tag := range tags {
+		binary.Write(&dir, binary.LittleEndian, tag.id)
+		binary.Write(&dir, binary.LittleEndian, tag.typ)
+		binary.Write(&dir, binary.LittleEndian, tag.count)
+		if len(tag.data) <= 4 {
+			v := make([]byte, 4)
+			copy(v, tag.data)
+			dir.Write(v)
+			continue
+		}
+		binary.Write(&dir, binary.LittleEndian, dataStart+uint32(data.Len()))
+		data.Write(tag.data)
+		if data.Len()%2 == 1 {
+			data.WriteByte(0)
+		}
+	}
+	binary.Write(&dir, binary.LittleEndian, uint32(0))
+
+	return append(dir.Bytes(), data.Bytes()...)
+}
+
+// newJPEGWithEXIF encodes a w x h JPEG with an EXIF block carrying camera
+// details, a date taken, GPS coordinates and the given orientation.
+func newJPEGWithEXIF(t *testing.T, w, h int, orientation uint16) []byte {
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatalf("encoding jpeg: %s", err)
+	}
+
+	exifIFD := []exifTag{
+		ratTag(0x829A, 1, 250),
+		ratTag(0x829D, 8, 1),
+		shortTag(0x8827, 200),
+		asciiTag(0x9003, "2021:08:02 10:30:00"),
+		asciiTag(0xA434, "50mm F1.8"),
+	}
+	gpsIFD := []exifTag{
+		asciiTag(0x0001, "N"),
+		ratTag(0x0002, 40, 1, 51, 1, 0, 1),
+		asciiTag(0x0003, "W"),
+		ratTag(0x0004, 73, 1, 30, 1, 0, 1),
+	}
+	ifd0 := func(exifAt, gpsAt uint32) []exifTag {
+		return []exifTag{
+			asciiTag(0x010F, "Gopher"),
+			asciiTag(0x0110, "G-1"),
+			shortTag(0x0112, orientation),
+			longTag(0x8769, exifAt),
+			longTag(0x8825, gpsAt),
+		}
+	}
+
+	dir0 := exifDir(8, ifd0(0, 0))
+	exifAt := 8 + uint32(len(dir0))
+	dirExif := exifDir(exifAt, exifIFD)
+	gpsAt := exifAt + uint32(len(dirExif))
+
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	tiff.Write(exifDir(8, ifd0(exifAt, gpsAt)))
+	tiff.Write(dirExif)
+	tiff.Write(exifDir(gpsAt, gpsIFD))
+
+	app1 := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(img.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(app1)+2))
+	out.Write(app1)
+	out.Write(img.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestPhoto(t *testing.T) {
+	tests.Run(t, testPhoto)
+}
+
+func testPhoto(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	usr, err := user.NewStore(log, db).Create(ctx, user.NewAuthUser{
+		Name:        "Photographer",
+		Email:       "photographer@example.com",
+		Pass:        "gophers",
+		PassConfirm: "gophers",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+	c, err := contest.NewStore(log, db).Create(ctx, contest.NewContest{
+		UserID:      usr.ID,
+		Title:       "Urban Nature",
+		SubmitStart: now,
+		SubmitEnd:   now.Add(24 * time.Hour),
+	}, now)
+	if err != nil {
+		t.Fatalf("creating contest: %s", err)
+	}
+
+	storage := photo.NewStorage(t.TempDir())
+	store := photo.NewStore(log, db)
+	lim := photo.Limits{MaxBytes: 1 << 20, MinWidth: 32, MinHeight: 32, MaxWidth: 256, MaxHeight: 256}
+
+	t.Log("Given the need to work with Photo records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen submitting a single Photo.", testID)
+		{
+			if err := storage.StatusCheck(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write to the storage : %s.", tests.Failed, testID, err)
+			}
+			file := filepath.Join(t.TempDir(), "file")
+			if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+				t.Fatalf("creating file: %s", err)
+			}
+			if err := photo.NewStorage(file).StatusCheck(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould report a storage that can't be written to.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould check the storage can be written to.", tests.Success, testID)
+
+			data := newPNG(t, 64, 48, color.RGBA{R: 200, A: 255})
+
+			orig, err := storage.Save(bytes.NewReader(data), lim)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the original : %s.", tests.Failed, testID, err)
+			}
+			if orig.MIME != "image/png" || orig.Width != 64 || orig.Height != 48 || orig.Size != int64(len(data)) {
+				t.Fatalf("\t%s\tTest %d:\tShould inspect the original : got %+v.", tests.Failed, testID, orig)
+			}
+			if _, err := os.Stat(storage.OriginalPath(orig.SHA256, orig.MIME)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould find the original on disk : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to store the original.", tests.Success, testID)
+
+			np := photo.NewPhoto{
+				ContestID: c.ID,
+				UserID:    usr.ID,
+				Title:     "Red square",
+				Caption:   "Very red.",
+			}
+			p, err := store.Create(ctx, np, orig, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create photo : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create photo.", tests.Success, testID)
+
+			saved, err := store.QueryByID(ctx, p.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve photo by ID: %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff(p, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same photo. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same photo.", tests.Success, testID)
+
+			again, err := storage.Save(bytes.NewReader(data), lim)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the same bytes again : %s.", tests.Failed, testID, err)
+			}
+			if _, err := store.Create(ctx, np, again, now); err != photo.ErrDuplicate {
+				t.Fatalf("\t%s\tTest %d:\tShould detect the duplicate : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould detect the duplicate.", tests.Success, testID)
+
+			ps, err := store.QueryByContest(ctx, c.ID)
+			if err != nil || len(ps) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould list a single photo for the contest : %d, %v.", tests.Failed, testID, len(ps), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list a single photo for the contest.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen uploading invalid files.", testID)
+		{
+			if _, err := storage.Save(bytes.NewReader([]byte("just some text")), lim); err != photo.ErrUnsupportedType {
+				t.Fatalf("\t%s\tTest %d:\tShould reject files that aren't images : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject files that aren't images.", tests.Success, testID)
+
+			small := newPNG(t, 16, 16, color.White)
+			if _, err := storage.Save(bytes.NewReader(small), lim); err != photo.ErrDimensions {
+				t.Fatalf("\t%s\tTest %d:\tShould reject images that are too small : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject images that are too small.", tests.Success, testID)
+
+			big := newPNG(t, 64, 64, color.Black)
+			tight := lim
+			tight.MaxBytes = int64(len(big)) - 1
+			if _, err := storage.Save(bytes.NewReader(big), tight); err != photo.ErrTooLarge {
+				t.Fatalf("\t%s\tTest %d:\tShould reject files that are too large : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject files that are too large.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen generating renditions.", testID)
+		{
+			data := newPNG(t, 800, 640, color.RGBA{B: 200, A: 255})
+			orig, err := storage.Save(bytes.NewReader(data), photo.DefaultLimits)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the original : %s.", tests.Failed, testID, err)
+			}
+			// Every request for a missing rendition derives it, so several
+			// may do so at once.
+			errs := make(chan error, 4)
+			for i := 0; i < cap(errs); i++ {
+				go func() { errs <- storage.Derive(orig) }()
+			}
+			for i := 0; i < cap(errs); i++ {
+				if err := <-errs; err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate renditions : %s.", tests.Failed, testID, err)
+				}
+			}
+			tmps, err := filepath.Glob(filepath.Join(storage.Dir(orig.SHA256), "*.tmp"))
+			if err != nil || len(tmps) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not leave temporary files behind : %v, %v.", tests.Failed, testID, tmps, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate renditions.", tests.Success, testID)
+
+			exp := map[photo.Size]image.Point{
+				photo.SizeThumb:  {X: 320, Y: 256},
+				photo.SizeMedium: {X: 800, Y: 640},
+				photo.SizeFull:   {X: 800, Y: 640},
+			}
+			for size, dim := range exp {
+				f, err := os.Open(storage.DerivativePath(orig.SHA256, size))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould find the %s rendition : %s.", tests.Failed, testID, size, err)
+				}
+				cfg, format, err := image.DecodeConfig(f)
+				f.Close()
+				if err != nil || format != "jpeg" {
+					t.Fatalf("\t%s\tTest %d:\tShould store the %s rendition as JPEG : %s, %v.", tests.Failed, testID, size, format, err)
+				}
+				if cfg.Width != dim.X || cfg.Height != dim.Y {
+					t.Fatalf("\t%s\tTest %d:\tShould scale the %s rendition to %v : got %dx%d.", tests.Failed, testID, size, dim, cfg.Width, cfg.Height)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould scale renditions without upscaling.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen handling EXIF metadata.", testID)
+		{
+			data := newJPEGWithEXIF(t, 960, 720, 6)
+			orig, err := storage.Save(bytes.NewReader(data), photo.DefaultLimits)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the original : %s.", tests.Failed, testID, err)
+			}
+
+			meta, err := storage.EXIF(orig)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the EXIF : %s.", tests.Failed, testID, err)
+			}
+			taken := time.Date(2021, time.August, 2, 10, 30, 0, 0, time.UTC)
+			if meta.CameraMake != "Gopher" || meta.CameraModel != "G-1" || meta.LensModel != "50mm F1.8" ||
+				meta.Orientation != 6 || meta.TakenOn == nil || !meta.TakenOn.Equal(taken) {
+				t.Fatalf("\t%s\tTest %d:\tShould read the camera details : got %+v.", tests.Failed, testID, meta)
+			}
+			if got := meta.Summary(); got != "1/250s f/8 ISO 200" {
+				t.Fatalf("\t%s\tTest %d:\tShould summarize the exposure : got %q.", tests.Failed, testID, got)
+			}
+			if meta.Latitude == nil || meta.Longitude == nil || *meta.Latitude < 40.84 || *meta.Longitude > -73.49 {
+				t.Fatalf("\t%s\tTest %d:\tShould read the GPS position : got %v, %v.", tests.Failed, testID, meta.Latitude, meta.Longitude)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to read the EXIF.", tests.Success, testID)
+
+			var plain bytes.Buffer
+			if err := jpeg.Encode(&plain, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+				t.Fatalf("encoding jpeg: %s", err)
+			}
+			if meta, err := photo.ReadEXIF(bytes.NewReader(plain.Bytes())); err != nil || meta != (photo.EXIF{}) {
+				t.Fatalf("\t%s\tTest %d:\tShould read nothing from a photo without EXIF : %+v, %v.", tests.Failed, testID, meta, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould read nothing from a photo without EXIF.", tests.Success, testID)
+
+			// The first directory points past the end of the TIFF data.
+			broken := append([]byte{}, data...)
+			copy(broken[12:], "II*\x00\xff\xff\xff\xff")
+			if _, err := photo.ReadEXIF(bytes.NewReader(broken)); errors.Cause(err) != photo.ErrBadEXIF {
+				t.Fatalf("\t%s\tTest %d:\tShould fail on EXIF it can't read.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail on EXIF it can't read.", tests.Success, testID)
+
+			np := photo.NewPhoto{ContestID: c.ID, UserID: usr.ID, Title: "Gray"}
+			p, err := store.Submit(ctx, np, orig, meta, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to submit the photo with its EXIF : %s.", tests.Failed, testID, err)
+			}
+			if _, err := store.Submit(ctx, np, orig, meta, now); err != photo.ErrDuplicate {
+				t.Fatalf("\t%s\tTest %d:\tShould detect the duplicate submission : %v.", tests.Failed, testID, err)
+			}
+			saved, err := store.QueryEXIF(ctx, p.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the EXIF : %s.", tests.Failed, testID, err)
+			}
+			meta.PhotoID = p.ID
+			if diff := cmp.Diff(meta, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same EXIF. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to save the EXIF.", tests.Success, testID)
+
+			if err := storage.Derive(orig); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate renditions : %s.", tests.Failed, testID, err)
+			}
+			thumb, err := os.ReadFile(storage.DerivativePath(orig.SHA256, photo.SizeThumb))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould find the thumbnail : %s.", tests.Failed, testID, err)
+			}
+			if bytes.Contains(thumb, []byte("Exif")) || bytes.Contains(thumb, []byte("Gopher")) {
+				t.Fatalf("\t%s\tTest %d:\tShould strip the metadata from renditions.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould strip the metadata from renditions.", tests.Success, testID)
+
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil || cfg.Width != 240 || cfg.Height != 320 {
+				t.Fatalf("\t%s\tTest %d:\tShould rotate renditions upright : got %dx%d, %v.", tests.Failed, testID, cfg.Width, cfg.Height, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould rotate renditions upright.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package photo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	_ "image/jpeg" // Register the JPEG decoder.
+	_ "image/png"  // Register the PNG decoder.
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	_ "golang.org/x/image/webp" // Register the WebP decoder.
+)
+
+// Set of error variables for uploads.
+var (
+	ErrUnsupportedType = errors.New("file is not a JPEG, PNG or WebP image")
+	ErrTooLarge        = errors.New("file is too large")
+	ErrDimensions      = errors.New("image dimensions are out of the allowed range")
+)
+
+// mimeTypes maps the accepted content types to the extension used on disk.
+var mimeTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Storage keeps photo files on disk. Files are content-addressed: each
+// original is stored under the hex SHA-256 of its bytes, fanned out in
+// sub-directories by the first two characters of the hash.
+type Storage struct {
+	root string
+}
+
+// NewStorage constructs a storage rooted at the given directory.
+func NewStorage(root string) Storage {
+	return Storage{root: root}
+}
+
+// Dir returns the directory that holds the files for the given hash.
+func (s Storage) Dir(sum string) string {
+	return filepath.Join(s.root, sum[:2])
+}
+
+// OriginalPath returns the location of the original file for the given hash.
+func (s Storage) OriginalPath(sum, mime string) string {
+	return filepath.Join(s.Dir(sum), sum+mimeTypes[mime])
+}
+
+// StatusCheck returns nil when new uploads can be written to the storage.
+// The root directory has to be there already: when it is gone, the volume
+// holding the photos is most likely not mounted, and recreating it would
+// hide that.
+func (s Storage) StatusCheck() error {
+	fi, err := os.Stat(s.root)
+	if err != nil {
+		return errors.Wrap(err, "checking photo directory")
+	}
+	if !fi.IsDir() {
+		return errors.Errorf("%s is not a directory", s.root)
+	}
+
+	tmpDir := filepath.Join(s.root, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return errors.Wrap(err, "creating upload directory")
+	}
+
+	f, err := ioutil.TempFile(tmpDir, "check-")
+	if err != nil {
+		return errors.Wrap(err, "creating temp file")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write([]byte("ok")); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing temp file")
+	}
+	return f.Close()
+}
+
+// Save streams r to disk while hashing it, then checks the content type and
+// the image dimensions against the limits. The file only lands at its final
+// content-addressed location once all checks passed; uploading the same bytes
+// twice leaves a single copy on disk.
+func (s Storage) Save(r io.Reader, lim Limits) (Original, error) {
+	tmpDir := filepath.Join(s.root, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return Original{}, errors.Wrap(err, "creating upload directory")
+	}
+
+	tmp, err := ioutil.TempFile(tmpDir, "upload-")
+	if err != nil {
+		return Original{}, errors.Wrap(err, "creating temp file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, lim.MaxBytes+1))
+	if err != nil {
+		return Original{}, errors.Wrap(err, "writing upload")
+	}
+	if size > lim.MaxBytes {
+		return Original{}, ErrTooLarge
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return Original{}, errors.Wrap(err, "rewinding upload")
+	}
+	br := bufio.NewReader(tmp)
+	head, _ := br.Peek(512)
+	mime := http.DetectContentType(head)
+	if _, ok := mimeTypes[mime]; !ok {
+		return Original{}, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(br)
+	if err != nil {
+		return Original{}, ErrUnsupportedType
+	}
+	if cfg.Width < lim.MinWidth || cfg.Height < lim.MinHeight ||
+		cfg.Width > lim.MaxWidth || cfg.Height > lim.MaxHeight {
+		return Original{}, ErrDimensions
+	}
+
+	orig := Original{
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		MIME:   mime,
+		Size:   size,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+	}
+
+	if err := tmp.Close(); err != nil {
+		return Original{}, errors.Wrap(err, "closing upload")
+	}
+
+	dst := s.OriginalPath(orig.SHA256, orig.MIME)
+	if _, err := os.Stat(dst); err == nil {
+		return orig, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return Original{}, errors.Wrap(err, "creating photo directory")
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return Original{}, errors.Wrapf(err, "storing %s", orig.SHA256)
+	}
+
+	return orig, nil
+}
+
+// Remove deletes a stored original along with its renditions. Originals are
+// shared by every photo with the same bytes, so callers must make sure none
+// refers to it any more.
+func (s Storage) Remove(orig Original) error {
+	files := []string{s.OriginalPath(orig.SHA256, orig.MIME)}
+	for size := range Sizes {
+		files = append(files, s.DerivativePath(orig.SHA256, size))
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "removing %s", file)
+		}
+	}
+	return nil
+}
+
+// ManifestEntry describes a file kept in the storage.
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Manifest lists the files in the storage, originals and renditions, with
+// paths relative to its root. Uploads in progress are left out.
+func (s Storage) Manifest() ([]ManifestEntry, error) {
+	m := []ManifestEntry{}
+
+	// Nothing was uploaded yet.
+	if _, err := os.Stat(s.root); os.IsNotExist(err) {
+		return m, nil
+	}
+
+	err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel == "tmp" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		m = append(m, ManifestEntry{Path: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing photo storage")
+	}
+	return m, nil
+}
+
+// Missing returns the paths of the manifest entries the storage doesn't
+// hold, or holds with a different size.
+func (s Storage) Missing(m []ManifestEntry) []string {
+	var missing []string
+	for _, e := range m {
+		info, err := os.Stat(filepath.Join(s.root, filepath.FromSlash(e.Path)))
+		if err != nil || info.Size() != e.Size {
+			missing = append(missing, e.Path)
+		}
+	}
+	return missing
+}
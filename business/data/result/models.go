@@ -0,0 +1,45 @@
+package result
+
+import (
+	"time"
+)
+
+// Result - final standing of a photo in its category
+type Result struct {
+	ContestID int    `db:"contest_id" json:"contest_id"`
+	PhotoID   int    `db:"photo_id" json:"photo_id"`
+	Title     string `db:"title" json:"title"`
+	Category  string `db:"category" json:"category"`
+	Rank      int    `db:"rank" json:"rank"`
+
+	// Score combines the jury and the public votes per the contest formula.
+	// It ranges from 0 to 1 within a category.
+	Score float64 `db:"score" json:"score"`
+
+	// JuryScore is the balanced jury score of the photo, see jury.Standing.
+	JuryScore  float64 `db:"jury_score" json:"jury_score"`
+	JuryMedian float64 `db:"jury_median" json:"jury_median"`
+	Votes      int     `db:"votes" json:"votes"`
+
+	SubmittedOn time.Time `db:"submitted" json:"date_submitted"`
+	CreatedOn   time.Time `db:"created" json:"date_created"`
+}
+
+// Category - ranked results of one category
+type Category struct {
+	Name    string   `json:"name"`
+	Results []Result `json:"results"`
+}
+
+// ByCategory groups results ordered by category and rank.
+func ByCategory(rs []Result) []Category {
+	var cats []Category
+	for _, r := range rs {
+		if len(cats) == 0 || cats[len(cats)-1].Name != r.Category {
+			cats = append(cats, Category{Name: r.Category})
+		}
+		last := &cats[len(cats)-1]
+		last.Results = append(last.Results, r)
+	}
+	return cats
+}
@@ -0,0 +1,255 @@
+// Package result provides support for ranking contest entries and keeping
+// the published results.
+package result
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/jury"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/vote"
+	"photo-contest/foundation/database"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Store manages the set of API's for result access.
+type Store struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// NewStore constructs a result store for api access.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Compute ranks the entries of a contest from the current jury scores and
+// votes. Nothing is stored, see Publish for that.
+func (s Store) Compute(ctx context.Context, c contest.Contest, now time.Time) ([]Result, error) {
+	photos, err := photo.NewStore(s.log, s.db).QueryByContest(ctx, c.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing results")
+	}
+	standings, err := jury.NewStore(s.log, s.db).Standings(ctx, c.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing results")
+	}
+	tallies, err := vote.NewStore(s.log, s.db).Tallies(ctx, c.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing results")
+	}
+
+	return rank(c, photos, standings, tallies, now.UTC()), nil
+}
+
+// Publish computes the results of a contest in judging, stores them and
+// publishes the contest in the same transaction. From then on the stored
+// results are what's shown, so later changes to scores or votes don't
+// alter the published winners.
+func (s Store) Publish(ctx context.Context, c contest.Contest, now time.Time) ([]Result, error) {
+	if c.Phase != contest.PhaseJudging {
+		return nil, contest.ErrInvalidPhase
+	}
+
+	rs, err := s.Compute(ctx, c, now)
+	if err != nil {
+		return nil, err
+	}
+
+	data := struct {
+		ContestID int           `db:"contest_id"`
+		Published contest.Phase `db:"published_phase"`
+		Judging   contest.Phase `db:"judging_phase"`
+		Now       time.Time     `db:"now"`
+	}{
+		ContestID: c.ID,
+		Published: contest.PhasePublished,
+		Judging:   contest.PhaseJudging,
+		Now:       now.UTC(),
+	}
+
+	// The phase is checked again in the update so two admins publishing at
+	// once don't both store results.
+	const publish = `
+	UPDATE contest SET
+		phase = :published_phase,
+		published = :now,
+		updated = :now
+	WHERE contest_id = :contest_id AND phase = :judging_phase`
+
+	s.log.Printf("%s: %s", "result.Publish", database.Log(publish, data))
+
+	const insert = `
+	INSERT INTO contest_result
+		(contest_id, photo_id, category, rank, score, jury_score, jury_median, votes, created)
+	VALUES
+		(:contest_id, :photo_id, :category, :rank, :score, :jury_score, :jury_median, :votes, :created)`
+
+	err = database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, publish, data)
+		if err != nil {
+			return errors.Wrapf(err, "publishing contest %d", c.ID)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return contest.ErrInvalidPhase
+		}
+
+		for _, r := range rs {
+			s.log.Printf("%s: %s", "result.Publish", database.Log(insert, r))
+			if _, err := tx.NamedExecContext(ctx, insert, r); err != nil {
+				return errors.Wrapf(err, "inserting result of photo %d", r.PhotoID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// QueryByContest retrieves the published results of a contest, ordered by
+// category and rank.
+func (s Store) QueryByContest(ctx context.Context, contestID int) ([]Result, error) {
+	data := struct {
+		ContestID int `db:"contest_id"`
+	}{
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT
+		r.contest_id, r.photo_id, p.title, r.category, r.rank, r.score, r.jury_score, r.jury_median,
+		r.votes, p.created AS submitted, r.created
+	FROM contest_result r
+		JOIN photo p ON p.photo_id = r.photo_id
+	WHERE r.contest_id = :contest_id
+	ORDER BY r.category, r.rank`
+
+	s.log.Printf("%s: %s", "result.QueryByContest", database.Log(query, data))
+
+	var rs []Result
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &rs); err != nil {
+		return nil, errors.Wrapf(err, "selecting results of contest %d", contestID)
+	}
+
+	return rs, nil
+}
+
+// rank computes the results of every category.
+//
+// Within a category the jury scores and the vote counts are both scaled to
+// the 0 to 1 range, the best entry getting 1, and combined with the weights
+// of the contest. Photos the jury didn't score get 0 for the jury part.
+//
+// Ties are broken by the earlier submission, then by the higher jury median
+// and finally by photo ID, so the order is always the same.
+func rank(c contest.Contest, photos []photo.Photo, standings []jury.Standing, tallies []vote.Tally, now time.Time) []Result {
+	byPhoto := make(map[int]jury.Standing)
+	for _, st := range standings {
+		byPhoto[st.PhotoID] = st
+	}
+	votes := make(map[int]int)
+	for _, t := range tallies {
+		votes[t.PhotoID] = t.Votes
+	}
+
+	cats := make(map[string][]photo.Photo)
+	for _, p := range photos {
+		cats[p.Category] = append(cats[p.Category], p)
+	}
+
+	var rs []Result
+	for cat, ps := range cats {
+		var minJury, maxJury float64
+		var maxVotes int
+		scored := 0
+		for _, p := range ps {
+			if st, ok := byPhoto[p.ID]; ok {
+				if scored == 0 || st.Score < minJury {
+					minJury = st.Score
+				}
+				if scored == 0 || st.Score > maxJury {
+					maxJury = st.Score
+				}
+				scored++
+			}
+			if votes[p.ID] > maxVotes {
+				maxVotes = votes[p.ID]
+			}
+		}
+
+		start := len(rs)
+		for _, p := range ps {
+			st, ok := byPhoto[p.ID]
+
+			var juryPart, votePart float64
+			switch {
+			case !ok:
+			case maxJury > minJury:
+				juryPart = (st.Score - minJury) / (maxJury - minJury)
+			default:
+				juryPart = 1
+			}
+			if maxVotes > 0 {
+				votePart = float64(votes[p.ID]) / float64(maxVotes)
+			}
+
+			var score float64
+			if w := c.JuryWeight + c.VoteWeight; w > 0 {
+				score = (c.JuryWeight*juryPart + c.VoteWeight*votePart) / w
+			}
+
+			rs = append(rs, Result{
+				ContestID:   c.ID,
+				PhotoID:     p.ID,
+				Title:       p.Title,
+				Category:    cat,
+				Score:       score,
+				JuryScore:   st.Score,
+				JuryMedian:  st.Median,
+				Votes:       votes[p.ID],
+				SubmittedOn: p.CreatedOn,
+				CreatedOn:   now,
+			})
+		}
+
+		group := rs[start:]
+		sort.Slice(group, func(i, j int) bool {
+			a, b := group[i], group[j]
+			switch {
+			case a.Score != b.Score:
+				return a.Score > b.Score
+			case !a.SubmittedOn.Equal(b.SubmittedOn):
+				return a.SubmittedOn.Before(b.SubmittedOn)
+			case a.JuryMedian != b.JuryMedian:
+				return a.JuryMedian > b.JuryMedian
+			}
+			return a.PhotoID < b.PhotoID
+		})
+		for i := range group {
+			group[i].Rank = i + 1
+		}
+	}
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		if rs[i].Category != rs[j].Category {
+			return rs[i].Category < rs[j].Category
+		}
+		return rs[i].Rank < rs[j].Rank
+	})
+
+	return rs
+}
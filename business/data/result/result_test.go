@@ -0,0 +1,160 @@
+package result_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/jury"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/result"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"photo-contest/business/data/vote"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestResult(t *testing.T) {
+	tests.Run(t, testResult)
+}
+
+func testResult(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	usr, err := user.NewStore(log, db).Create(ctx, user.NewAuthUser{
+		Name:        "Contest Admin",
+		Email:       "admin@example.com",
+		Pass:        "gophers",
+		PassConfirm: "gophers",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	contests := contest.NewStore(log, db)
+	c, err := contests.Create(ctx, contest.NewContest{
+		UserID:      usr.ID,
+		Title:       "Urban Nature",
+		SubmitStart: now,
+		SubmitEnd:   now.Add(24 * time.Hour),
+		Categories:  "Streets, Parks",
+		JuryWeight:  1,
+		VoteWeight:  1,
+	}, now)
+	if err != nil {
+		t.Fatalf("creating contest: %s", err)
+	}
+
+	var photos []photo.Photo
+	for i, cat := range []string{"Streets", "Streets", "Parks"} {
+		orig := photo.Original{SHA256: fmt.Sprintf("%064d", i), MIME: "image/jpeg", Size: 1, Width: 640, Height: 640}
+		np := photo.NewPhoto{ContestID: c.ID, UserID: usr.ID, Title: fmt.Sprintf("Photo %d", i), Category: cat}
+		p, err := photo.NewStore(log, db).Create(ctx, np, orig, now.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("creating photo: %s", err)
+		}
+		photos = append(photos, p)
+	}
+	early, late, park := photos[0], photos[1], photos[2]
+
+	juries := jury.NewStore(log, db)
+	if err := juries.AddJuror(ctx, c.ID, usr.ID, now); err != nil {
+		t.Fatalf("adding juror: %s", err)
+	}
+	cr, err := juries.AddCriterion(ctx, jury.NewCriterion{ContestID: c.ID, Name: "Composition", Weight: 1}, now)
+	if err != nil {
+		t.Fatalf("adding criterion: %s", err)
+	}
+	for _, p := range photos {
+		if err := juries.Score(ctx, c.ID, usr.ID, p.ID, map[int]int{cr.ID: 7}, now); err != nil {
+			t.Fatalf("scoring photo: %s", err)
+		}
+	}
+
+	for _, ph := range []contest.Phase{contest.PhaseOpen, contest.PhaseJudging} {
+		if c, err = contests.SetPhase(ctx, c.ID, ph, now); err != nil {
+			t.Fatalf("moving contest to %s: %s", ph, err)
+		}
+	}
+
+	store := result.NewStore(log, db)
+	votes := vote.NewStore(log, db)
+
+	t.Log("Given the need to rank contest entries.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen computing the results.", testID)
+		{
+			rs, err := store.Compute(ctx, c, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to compute results : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to compute results.", tests.Success, testID)
+
+			cats := result.ByCategory(rs)
+			if len(cats) != 2 || cats[0].Name != "Parks" || cats[1].Name != "Streets" {
+				t.Fatalf("\t%s\tTest %d:\tShould rank each category on its own : %+v.", tests.Failed, testID, cats)
+			}
+			if cats[0].Results[0].PhotoID != park.ID || cats[0].Results[0].Rank != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould rank the only park photo first : %+v.", tests.Failed, testID, cats[0].Results)
+			}
+			t.Logf("\t%s\tTest %d:\tShould rank each category on its own.", tests.Success, testID)
+
+			streets := cats[1].Results
+			if streets[0].PhotoID != early.ID || streets[1].PhotoID != late.ID || streets[1].Rank != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould break ties by the earlier submission : %+v.", tests.Failed, testID, streets)
+			}
+			t.Logf("\t%s\tTest %d:\tShould break ties by the earlier submission.", tests.Success, testID)
+
+			v := vote.Vote{UserID: usr.ID, PhotoID: late.ID, ContestID: c.ID}
+			if err := votes.Cast(ctx, v, c.VoteBudget, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to vote : %s.", tests.Failed, testID, err)
+			}
+			rs, err = store.Compute(ctx, c, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to compute results : %s.", tests.Failed, testID, err)
+			}
+			streets = result.ByCategory(rs)[1].Results
+			if streets[0].PhotoID != late.ID || streets[0].Votes != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the votes : %+v.", tests.Failed, testID, streets)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the votes.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen publishing the results.", testID)
+		{
+			if _, err := store.Publish(ctx, c, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to publish : %s.", tests.Failed, testID, err)
+			}
+			saved, err := contests.QueryByID(ctx, c.ID)
+			if err != nil || saved.Phase != contest.PhasePublished || saved.PublishedOn == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould publish the contest : %+v, %v.", tests.Failed, testID, saved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to publish.", tests.Success, testID)
+
+			if _, err := store.Publish(ctx, c, now); err != contest.ErrInvalidPhase {
+				t.Fatalf("\t%s\tTest %d:\tShould not publish twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not publish twice.", tests.Success, testID)
+
+			if err := votes.Remove(ctx, usr.ID, late.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to remove the vote : %s.", tests.Failed, testID, err)
+			}
+			rs, err := store.QueryByContest(ctx, c.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve results : %s.", tests.Failed, testID, err)
+			}
+			streets := result.ByCategory(rs)[1].Results
+			if streets[0].PhotoID != late.ID || streets[0].Votes != 1 || streets[0].Title != late.Title {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the published results : %+v.", tests.Failed, testID, streets)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the published results.", tests.Success, testID)
+		}
+	}
+}
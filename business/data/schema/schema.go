@@ -16,6 +16,9 @@ var (
 	//go:embed sql/schema.sql
 	schemaDoc string
 
+	//go:embed sql/postgres/schema.sql
+	postgresSchemaDoc string
+
 	//go:embed sql/seed.sql
 	seedDoc string
 
@@ -24,18 +27,26 @@ var (
 )
 
 // Migrate attempts to bring the schema for db up to date with the migrations
-// defined in this package.
+// defined in this package. Postgres has its own copy of the migrations, in
+// its types, under the same versions.
 func Migrate(ctx context.Context, db *sqlx.DB) error {
 	if err := database.StatusCheck(ctx, db); err != nil {
 		return errors.Wrap(err, "status check database")
 	}
 
-	driver, err := darwin.NewGenericDriver(db.DB, darwin.SqliteDialect{})
+	var dialect darwin.Dialect = darwin.SqliteDialect{}
+	doc := schemaDoc
+	if db.DriverName() == database.DriverPostgres {
+		dialect = darwin.PostgresDialect{}
+		doc = postgresSchemaDoc
+	}
+
+	driver, err := darwin.NewGenericDriver(db.DB, dialect)
 	if err != nil {
 		return errors.Wrap(err, "construct darwin driver")
 	}
 
-	d := darwin.New(driver, darwin.ParseMigrations(schemaDoc))
+	d := darwin.New(driver, darwin.ParseMigrations(doc))
 	return d.Migrate()
 }
 
@@ -46,35 +57,17 @@ func Seed(ctx context.Context, db *sqlx.DB) error {
 		return errors.Wrap(err, "status check database")
 	}
 
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-
-	if _, err := tx.Exec(seedDoc); err != nil {
-		if err := tx.Rollback(); err != nil {
-			return err
-		}
+	return database.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, seedDoc)
 		return err
-	}
-
-	return tx.Commit()
+	})
 }
 
 // DeleteAll runs the set of Drop-table queries against db. The queries are ran in a
 // transaction and rolled back if any fail.
-func DeleteAll(db *sqlx.DB) error {
-	tx, err := db.Begin()
-	if err != nil {
+func DeleteAll(ctx context.Context, db *sqlx.DB) error {
+	return database.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, deleteDoc)
 		return err
-	}
-
-	if _, err := tx.Exec(deleteDoc); err != nil {
-		if err := tx.Rollback(); err != nil {
-			return err
-		}
-		return err
-	}
-
-	return tx.Commit()
+	})
 }
@@ -0,0 +1,61 @@
+package schema_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/jury"
+	"photo-contest/business/data/schema"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestSeed(t *testing.T) {
+	tests.Run(t, testSeed)
+}
+
+func testSeed(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	ctx := context.Background()
+
+	t.Log("Given the need to start from sample data.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen seeding a migrated database.", testID)
+		{
+			if err := schema.Seed(ctx, db); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to seed the database : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to seed the database.", tests.Success, testID)
+
+			store := user.NewStore(log, db)
+			admin, err := store.Authenticate(ctx, "admin@example.com", "gophers1")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould sign in as the admin : %s.", tests.Failed, testID, err)
+			}
+			admin.Grants, err = store.QueryGrants(ctx, admin.ID)
+			if err != nil || !admin.HasRole(user.RoleSiteAdmin, 0) || !admin.EmailVerified() {
+				t.Fatalf("\t%s\tTest %d:\tShould make the admin a verified site admin : %+v, %v.", tests.Failed, testID, admin, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign in as the site admin.", tests.Success, testID)
+
+			cs, err := contest.NewStore(log, db).QueryByPhase(ctx, contest.PhaseOpen)
+			if err != nil || len(cs) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould find the sample contest : %d, %v.", tests.Failed, testID, len(cs), err)
+			}
+			c := cs[0]
+			if !c.AcceptsSubmissions(time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC)) || len(c.CategoryList()) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould open the sample contest for submissions : %+v.", tests.Failed, testID, c)
+			}
+			criteria, err := jury.NewStore(log, db).Criteria(ctx, c.ID)
+			if err != nil || len(criteria) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould give the sample contest criteria : %d, %v.", tests.Failed, testID, len(criteria), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould open a sample contest for submissions.", tests.Success, testID)
+		}
+	}
+}
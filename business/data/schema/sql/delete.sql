@@ -1 +1,15 @@
+DELETE FROM lockout_event;
+DELETE FROM login_throttle;
+DELETE FROM contest_result;
+DELETE FROM score;
+DELETE FROM criterion;
+DELETE FROM api_token;
+DELETE FROM session;
+DELETE FROM user_role;
+DELETE FROM recovery_code;
+DELETE FROM password_reset;
+DELETE FROM vote;
+DELETE FROM photo_exif;
+DELETE FROM photo;
+DELETE FROM contest;
 DELETE FROM auth_user;
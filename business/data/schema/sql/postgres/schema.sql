@@ -0,0 +1,232 @@
+-- Version: 1.0
+-- Description: Create table users
+CREATE TABLE auth_user (
+    user_id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    passw BYTEA NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX auth_user1 ON auth_user(user_id);
+CREATE UNIQUE INDEX auth_user_id_UNIQUE ON auth_user(email ASC);
+
+-- Version: 1.1
+-- Description: Create table contest
+CREATE TABLE contest (
+    contest_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    rules TEXT NOT NULL DEFAULT '',
+    phase TEXT NOT NULL DEFAULT 'draft',
+    submit_start TIMESTAMPTZ NOT NULL,
+    submit_end TIMESTAMPTZ NOT NULL,
+    opened TIMESTAMPTZ,
+    judging TIMESTAMPTZ,
+    published TIMESTAMPTZ,
+    archived TIMESTAMPTZ,
+    created TIMESTAMPTZ NOT NULL,
+    updated TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX contest_phase ON contest(phase);
+
+-- Version: 1.2
+-- Description: Create table photo
+CREATE TABLE photo (
+    photo_id SERIAL PRIMARY KEY,
+    contest_id INTEGER NOT NULL REFERENCES contest(contest_id),
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    title TEXT NOT NULL,
+    caption TEXT NOT NULL DEFAULT '',
+    sha256 TEXT NOT NULL,
+    mime TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX photo_user ON photo(user_id);
+CREATE UNIQUE INDEX photo_contest_sha256_UNIQUE ON photo(contest_id, sha256);
+
+-- Version: 1.3
+-- Description: Create table photo_exif
+CREATE TABLE photo_exif (
+    photo_id INTEGER PRIMARY KEY REFERENCES photo(photo_id),
+    camera_make TEXT NOT NULL DEFAULT '',
+    camera_model TEXT NOT NULL DEFAULT '',
+    lens_model TEXT NOT NULL DEFAULT '',
+    exposure_time TEXT NOT NULL DEFAULT '',
+    f_number DOUBLE PRECISION NOT NULL DEFAULT 0,
+    iso INTEGER NOT NULL DEFAULT 0,
+    focal_length DOUBLE PRECISION NOT NULL DEFAULT 0,
+    orientation INTEGER NOT NULL DEFAULT 0,
+    taken TIMESTAMPTZ,
+    gps_lat DOUBLE PRECISION,
+    gps_lng DOUBLE PRECISION
+);
+
+-- Version: 1.4
+-- Description: Add the date taken rule to contests
+ALTER TABLE contest ADD COLUMN taken_after TIMESTAMPTZ;
+
+-- Version: 1.5
+-- Description: Create table vote
+CREATE TABLE vote (
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    photo_id INTEGER NOT NULL REFERENCES photo(photo_id),
+    contest_id INTEGER NOT NULL REFERENCES contest(contest_id),
+    created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, photo_id)
+);
+
+CREATE INDEX vote_photo ON vote(photo_id);
+CREATE INDEX vote_user_contest ON vote(user_id, contest_id);
+
+-- Version: 1.6
+-- Description: Add the vote budget to contests
+ALTER TABLE contest ADD COLUMN vote_budget INTEGER NOT NULL DEFAULT 3;
+
+-- Version: 1.7
+-- Description: Create tables for jury scoring
+CREATE TABLE criterion (
+    criterion_id SERIAL PRIMARY KEY,
+    contest_id INTEGER NOT NULL REFERENCES contest(contest_id),
+    name TEXT NOT NULL,
+    weight DOUBLE PRECISION NOT NULL DEFAULT 1,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX criterion_contest ON criterion(contest_id);
+
+CREATE TABLE score (
+    contest_id INTEGER NOT NULL REFERENCES contest(contest_id),
+    photo_id INTEGER NOT NULL REFERENCES photo(photo_id),
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    criterion_id INTEGER NOT NULL REFERENCES criterion(criterion_id),
+    value INTEGER NOT NULL,
+    updated TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (photo_id, user_id, criterion_id)
+);
+
+CREATE INDEX score_contest ON score(contest_id);
+
+
+-- Version: 1.8
+-- Description: Add categories and the results formula
+ALTER TABLE contest ADD COLUMN categories TEXT NOT NULL DEFAULT '';
+ALTER TABLE contest ADD COLUMN jury_weight DOUBLE PRECISION NOT NULL DEFAULT 1;
+ALTER TABLE contest ADD COLUMN vote_weight DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE photo ADD COLUMN category TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE contest_result (
+    contest_id INTEGER NOT NULL REFERENCES contest(contest_id),
+    photo_id INTEGER NOT NULL REFERENCES photo(photo_id),
+    category TEXT NOT NULL,
+    rank INTEGER NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    jury_score DOUBLE PRECISION NOT NULL,
+    jury_median DOUBLE PRECISION NOT NULL,
+    votes INTEGER NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (contest_id, photo_id)
+);
+
+-- Version: 1.9
+-- Description: Create table user_role and make contest owners admins of their contests
+CREATE TABLE user_role (
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    role TEXT NOT NULL,
+    contest_id INTEGER NOT NULL DEFAULT 0,
+    created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, role, contest_id)
+);
+
+CREATE INDEX user_role_contest ON user_role(contest_id, role);
+
+INSERT INTO user_role (user_id, role, contest_id, created)
+    SELECT user_id, 'contest_admin', contest_id, created FROM contest;
+
+-- Version: 2.0
+-- Description: Create table password_reset
+CREATE TABLE password_reset (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    expires TIMESTAMPTZ NOT NULL,
+    used TIMESTAMPTZ,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX password_reset_user ON password_reset(user_id);
+
+-- Version: 2.1
+-- Description: Add email verification to users
+ALTER TABLE auth_user ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Version: 2.2
+-- Description: Create table session
+CREATE TABLE session (
+    session_id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    data BYTEA NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    expires TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX session_user ON session(user_id);
+CREATE INDEX session_expires ON session(expires);
+
+-- Version: 2.3
+-- Description: Create tables for login throttling
+CREATE TABLE login_throttle (
+    kind TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failure TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (kind, key)
+);
+
+CREATE TABLE lockout_event (
+    event_id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+
+-- Version: 2.4
+-- Description: Add two-factor authentication to users
+ALTER TABLE auth_user ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_user ADD COLUMN totp_enabled_at TIMESTAMPTZ;
+ALTER TABLE auth_user ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_code (
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    code_hash TEXT NOT NULL,
+    used TIMESTAMPTZ,
+    created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- Version: 2.5
+-- Description: Create table api_token
+CREATE TABLE api_token (
+    token_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES auth_user(user_id),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    last_used TIMESTAMPTZ,
+    expires TIMESTAMPTZ,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX api_token_user ON api_token(user_id);
@@ -0,0 +1,26 @@
+-- Seed data for development: a site admin who can sign in with the password
+-- "gophers1", and a contest open for submissions with two jury criteria.
+-- Rows reference each other through lookups rather than fixed IDs, so the
+-- Postgres sequences stay in step. Times are written the way the SQLite
+-- driver stores them, which Postgres reads as well.
+INSERT INTO auth_user (name, email, passw, created, email_verified_at) VALUES
+    ('Admin Gopher', 'admin@example.com', '$2a$10$ouG6Jt4P1YOABrvNohnGnuUtVn1Vf2dDeBdS3NyhrlZzIpOavQKXS',
+    '2021-08-01 00:00:00+00:00', '2021-08-01 00:00:00+00:00');
+
+INSERT INTO user_role (user_id, role, contest_id, created) VALUES
+    ((SELECT user_id FROM auth_user WHERE email = 'admin@example.com'), 'site_admin', 0, '2021-08-01 00:00:00+00:00');
+
+INSERT INTO contest (user_id, title, description, rules, phase, submit_start, submit_end, opened, created, updated,
+    vote_budget, categories, jury_weight, vote_weight) VALUES
+    ((SELECT user_id FROM auth_user WHERE email = 'admin@example.com'), 'Urban Nature',
+    'Wildlife and plants finding their way in the city.', 'One photo per category. No composites.',
+    'open', '2021-08-01 00:00:00+00:00', '2031-08-01 00:00:00+00:00', '2021-08-01 00:00:00+00:00',
+    '2021-08-01 00:00:00+00:00', '2021-08-01 00:00:00+00:00', 3, 'Wildlife,Plants', 0.7, 0.3);
+
+INSERT INTO user_role (user_id, role, contest_id, created) VALUES
+    ((SELECT user_id FROM auth_user WHERE email = 'admin@example.com'), 'contest_admin',
+    (SELECT contest_id FROM contest WHERE title = 'Urban Nature'), '2021-08-01 00:00:00+00:00');
+
+INSERT INTO criterion (contest_id, name, weight, created) VALUES
+    ((SELECT contest_id FROM contest WHERE title = 'Urban Nature'), 'Composition', 2, '2021-08-01 00:00:00+00:00'),
+    ((SELECT contest_id FROM contest WHERE title = 'Urban Nature'), 'Technique', 1, '2021-08-01 00:00:00+00:00');
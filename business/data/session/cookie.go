@@ -0,0 +1,179 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"photo-contest/foundation/database"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/pkg/errors"
+)
+
+// touchEvery limits how often the last use of a session is written.
+const touchEvery = time.Minute
+
+// CookieStore implements sessions.Store keeping the session values in the
+// database. The cookie only carries a signed random token, so a session can
+// be revoked on the server by deleting its row.
+//
+// Sessions are indexed by the int stored under the "user_id" value, which is
+// how the sessions of a user are listed and revoked.
+type CookieStore struct {
+	store   Store
+	codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+// NewCookieStore constructs a session store saving sessions with store. The
+// key pairs are used to sign the cookies, see securecookie.CodecsFromPairs.
+func NewCookieStore(store Store, keyPairs ...[]byte) *CookieStore {
+	return &CookieStore{
+		store:  store,
+		codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+	}
+}
+
+// Get returns the session with the given name for the request, sharing it
+// with the other handlers of the same request.
+func (cs *CookieStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(cs, name)
+}
+
+// New loads the session from the database. A new session is returned when
+// the cookie is missing, invalid or the session was revoked or expired.
+func (cs *CookieStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	sess := sessions.NewSession(cs, name)
+	opts := *cs.Options
+	sess.Options = &opts
+	sess.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return sess, nil
+	}
+	var token string
+	if err := securecookie.DecodeMulti(name, c.Value, &token, cs.codecs...); err != nil {
+		return sess, nil
+	}
+
+	now := time.Now()
+	stored, err := cs.store.QueryByID(r.Context(), StoredID(token), now)
+	if err != nil {
+		if err == database.ErrNotFound {
+			return sess, nil
+		}
+		return sess, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&sess.Values); err != nil {
+		return sess, errors.Wrap(err, "decoding session")
+	}
+	sess.ID = token
+	sess.IsNew = false
+
+	if now.Sub(stored.LastSeen) > touchEvery {
+		if err := cs.store.Touch(r.Context(), stored.ID, now); err != nil {
+			return sess, err
+		}
+	}
+
+	return sess, nil
+}
+
+// Save writes the session to the database and sets the cookie. A negative
+// MaxAge revokes the session.
+func (cs *CookieStore) Save(r *http.Request, w http.ResponseWriter, sess *sessions.Session) error {
+	if sess.Options.MaxAge < 0 {
+		if sess.ID != "" {
+			if err := cs.store.Delete(r.Context(), StoredID(sess.ID), 0); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(sess.Name(), "", sess.Options))
+		return nil
+	}
+
+	if sess.ID == "" {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return errors.Wrap(err, "generating session token")
+		}
+		sess.ID = base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sess.Values); err != nil {
+		return errors.Wrap(err, "encoding session")
+	}
+
+	maxAge := time.Duration(sess.Options.MaxAge) * time.Second
+	if maxAge == 0 {
+		maxAge = 24 * time.Hour
+	}
+	userID, _ := sess.Values["user_id"].(int)
+	if sess.Values["logged_in"] != true {
+		userID = 0
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	ua := r.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+
+	now := time.Now().UTC()
+	stored := Session{
+		ID:        StoredID(sess.ID),
+		UserID:    userID,
+		Data:      buf.Bytes(),
+		UserAgent: ua,
+		IP:        ip,
+		CreatedOn: now,
+		LastSeen:  now,
+		Expires:   now.Add(maxAge),
+	}
+	if err := cs.store.Save(r.Context(), stored); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(sess.Name(), sess.ID, cs.codecs...)
+	if err != nil {
+		return errors.Wrap(err, "encoding session cookie")
+	}
+	http.SetCookie(w, sessions.NewCookie(sess.Name(), encoded, sess.Options))
+
+	return nil
+}
+
+// Renew revokes the stored session and gives it a new token on the next
+// Save, keeping its values. Call it when a user signs in so a token planted
+// before can't be used to ride the new session.
+func (cs *CookieStore) Renew(r *http.Request, sess *sessions.Session) error {
+	if sess.ID == "" {
+		return nil
+	}
+	if err := cs.store.Delete(r.Context(), StoredID(sess.ID), 0); err != nil {
+		return err
+	}
+	sess.ID = ""
+	return nil
+}
+
+// StoredID returns the ID a session token is stored under.
+func StoredID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,25 @@
+package session
+
+import (
+	"time"
+)
+
+// Session - server side state of a browser session. The ID is a hash of the
+// token held in the cookie, so the table can't be used to hijack sessions.
+type Session struct {
+	ID        string    `db:"session_id" json:"id"`
+	UserID    int       `db:"user_id" json:"user_id"`
+	Data      []byte    `db:"data" json:"-"`
+	UserAgent string    `db:"user_agent" json:"user_agent"`
+	IP        string    `db:"ip" json:"ip"`
+	CreatedOn time.Time `db:"created" json:"date_created"`
+	LastSeen  time.Time `db:"last_seen" json:"date_last_seen"`
+	Expires   time.Time `db:"expires" json:"date_expires"`
+}
+
+// Active - session of a signed in user, as listed to admins
+type Active struct {
+	Session
+	Name  string `db:"name" json:"name"`
+	Email string `db:"email" json:"email"`
+}
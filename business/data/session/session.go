@@ -0,0 +1,269 @@
+// Package session provides support for keeping browser sessions on the
+// server side.
+package session
+
+import (
+	"context"
+	"log"
+	"photo-contest/foundation/database"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Store manages the set of API's for session access.
+type Store struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// NewStore constructs a session store for api access.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Save inserts or replaces a session.
+func (s Store) Save(ctx context.Context, sess Session) error {
+	const query = `
+	INSERT INTO session
+		(session_id, user_id, data, user_agent, ip, created, last_seen, expires)
+	VALUES
+		(:session_id, :user_id, :data, :user_agent, :ip, :created, :last_seen, :expires)
+	ON CONFLICT (session_id) DO UPDATE SET
+		user_id = excluded.user_id,
+		data = excluded.data,
+		user_agent = excluded.user_agent,
+		ip = excluded.ip,
+		last_seen = excluded.last_seen,
+		expires = excluded.expires`
+
+	// Don't log the data, it is the content of the session.
+	s.log.Printf("%s: user %d", "session.Save", sess.UserID)
+
+	if _, err := s.db.NamedExecContext(ctx, query, sess); err != nil {
+		return errors.Wrap(err, "saving session")
+	}
+
+	return nil
+}
+
+// QueryByID returns a session that hasn't expired yet.
+func (s Store) QueryByID(ctx context.Context, sessionID string, now time.Time) (Session, error) {
+	data := struct {
+		SessionID string    `db:"session_id"`
+		Now       time.Time `db:"now"`
+	}{
+		SessionID: sessionID,
+		Now:       now.UTC(),
+	}
+	const query = `
+	SELECT
+		session_id, user_id, data, user_agent, ip, created, last_seen, expires
+	FROM session
+	WHERE session_id = :session_id AND expires > :now`
+
+	s.log.Printf("%s: %s", "session.QueryByID", "selecting session")
+
+	var sess Session
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &sess); err != nil {
+		if err == database.ErrNotFound {
+			return Session{}, database.ErrNotFound
+		}
+		return Session{}, errors.Wrap(err, "selecting session")
+	}
+
+	return sess, nil
+}
+
+// QueryByUser retrieves the active sessions of a user, most recent first.
+func (s Store) QueryByUser(ctx context.Context, userID int, now time.Time) ([]Session, error) {
+	data := struct {
+		UserID int       `db:"user_id"`
+		Now    time.Time `db:"now"`
+	}{
+		UserID: userID,
+		Now:    now.UTC(),
+	}
+	const query = `
+	SELECT
+		session_id, user_id, user_agent, ip, created, last_seen, expires
+	FROM session
+	WHERE user_id = :user_id AND expires > :now
+	ORDER BY last_seen DESC`
+
+	s.log.Printf("%s: %s", "session.QueryByUser", database.Log(query, data))
+
+	var ss []Session
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &ss); err != nil {
+		return nil, errors.Wrapf(err, "selecting sessions of user %d", userID)
+	}
+
+	return ss, nil
+}
+
+// QueryActive retrieves the active sessions of signed in users, most recent
+// first.
+func (s Store) QueryActive(ctx context.Context, now time.Time) ([]Active, error) {
+	data := struct {
+		Now time.Time `db:"now"`
+	}{
+		Now: now.UTC(),
+	}
+	const query = `
+	SELECT
+		s.session_id, s.user_id, s.user_agent, s.ip, s.created, s.last_seen, s.expires,
+		u.name, u.email
+	FROM session s
+		JOIN auth_user u ON u.user_id = s.user_id
+	WHERE s.expires > :now
+	ORDER BY s.last_seen DESC`
+
+	s.log.Printf("%s: %s", "session.QueryActive", database.Log(query, data))
+
+	var as []Active
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &as); err != nil {
+		return nil, errors.Wrap(err, "selecting active sessions")
+	}
+
+	return as, nil
+}
+
+// CountActive returns how many signed in sessions haven't expired yet.
+// Sessions of visitors that never signed in are left out.
+func (s Store) CountActive(ctx context.Context, now time.Time) (int, error) {
+	data := struct {
+		Now time.Time `db:"now"`
+	}{
+		Now: now.UTC(),
+	}
+	const query = `
+	SELECT
+		COUNT(*) AS n
+	FROM session
+	WHERE user_id <> 0 AND expires > :now`
+
+	s.log.Printf("%s: %s", "session.CountActive", database.Log(query, data))
+
+	var row struct {
+		N int `db:"n"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &row); err != nil {
+		return 0, errors.Wrap(err, "counting active sessions")
+	}
+
+	return row.N, nil
+}
+
+// Touch records that the session was just used.
+func (s Store) Touch(ctx context.Context, sessionID string, now time.Time) error {
+	data := struct {
+		SessionID string    `db:"session_id"`
+		Now       time.Time `db:"now"`
+	}{
+		SessionID: sessionID,
+		Now:       now.UTC(),
+	}
+	const query = `
+	UPDATE session SET
+		last_seen = :now
+	WHERE session_id = :session_id`
+
+	if _, err := s.db.NamedExecContext(ctx, query, data); err != nil {
+		return errors.Wrap(err, "touching session")
+	}
+
+	return nil
+}
+
+// Delete revokes a session. Deleting a session of another user is a no-op
+// unless userID is 0.
+func (s Store) Delete(ctx context.Context, sessionID string, userID int) error {
+	data := struct {
+		SessionID string `db:"session_id"`
+		UserID    int    `db:"user_id"`
+	}{
+		SessionID: sessionID,
+		UserID:    userID,
+	}
+	const query = `
+	DELETE FROM session
+	WHERE session_id = :session_id AND (:user_id = 0 OR user_id = :user_id)`
+
+	s.log.Printf("%s: user %d", "session.Delete", userID)
+
+	if _, err := s.db.NamedExecContext(ctx, query, data); err != nil {
+		return errors.Wrap(err, "deleting session")
+	}
+
+	return nil
+}
+
+// DeleteByUser revokes all the sessions of a user except the one given, which
+// can be empty. It returns the number of sessions revoked.
+func (s Store) DeleteByUser(ctx context.Context, userID int, exceptID string) (int64, error) {
+	data := struct {
+		UserID    int    `db:"user_id"`
+		SessionID string `db:"session_id"`
+	}{
+		UserID:    userID,
+		SessionID: exceptID,
+	}
+	const query = `
+	DELETE FROM session
+	WHERE user_id = :user_id AND session_id != :session_id`
+
+	s.log.Printf("%s: user %d", "session.DeleteByUser", userID)
+
+	res, err := s.db.NamedExecContext(ctx, query, data)
+	if err != nil {
+		return 0, errors.Wrapf(err, "deleting sessions of user %d", userID)
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteExpired removes the sessions that expired. It returns the number of
+// sessions removed.
+func (s Store) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	data := struct {
+		Now time.Time `db:"now"`
+	}{
+		Now: now.UTC(),
+	}
+	const query = `
+	DELETE FROM session
+	WHERE expires <= :now`
+
+	res, err := s.db.NamedExecContext(ctx, query, data)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting expired sessions")
+	}
+
+	return res.RowsAffected()
+}
+
+// Sweep deletes expired sessions every interval until ctx is canceled.
+func (s Store) Sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := s.DeleteExpired(ctx, now)
+			if err != nil {
+				s.log.Printf("session.Sweep: %s", err)
+				continue
+			}
+			if n > 0 {
+				s.log.Printf("session.Sweep: removed %d expired sessions", n)
+			}
+		}
+	}
+}
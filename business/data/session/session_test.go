@@ -0,0 +1,145 @@
+package session_test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"photo-contest/business/data/session"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestSession(t *testing.T) {
+	tests.Run(t, testSession)
+}
+
+func testSession(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	ctx := context.Background()
+
+	usr, err := user.NewStore(log, db).Create(ctx, user.NewAuthUser{
+		Name:        "Traveler",
+		Email:       "traveler@example.com",
+		Pass:        "gophers1",
+		PassConfirm: "gophers1",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	store := session.NewStore(log, db)
+	cookies := session.NewCookieStore(store, []byte("0123456789abcdef0123456789abcdef"))
+
+	// login saves a signed in session and returns its cookie.
+	login := func() *http.Cookie {
+		r := httptest.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		sess, err := cookies.Get(r, "session")
+		if err != nil {
+			t.Fatalf("getting session: %s", err)
+		}
+		sess.Values["logged_in"] = true
+		sess.Values["user_id"] = usr.ID
+		if err := sess.Save(r, w); err != nil {
+			t.Fatalf("saving session: %s", err)
+		}
+		return w.Result().Cookies()[0]
+	}
+
+	// load reads the session the cookie points to.
+	load := func(c *http.Cookie) bool {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(c)
+		sess, err := cookies.Get(r, "session")
+		if err != nil {
+			t.Fatalf("getting session: %s", err)
+		}
+		return !sess.IsNew && sess.Values["user_id"] == usr.ID
+	}
+
+	t.Log("Given the need to keep sessions on the server.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the cookie store.", testID)
+		{
+			laptop, phone := login(), login()
+			if !load(laptop) || !load(phone) {
+				t.Fatalf("\t%s\tTest %d:\tShould load saved sessions.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould load saved sessions.", tests.Success, testID)
+
+			forged := *laptop
+			forged.Value = "forged"
+			if load(&forged) {
+				t.Fatalf("\t%s\tTest %d:\tShould not load forged cookies.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not load forged cookies.", tests.Success, testID)
+
+			ss, err := store.QueryByUser(ctx, usr.ID, time.Now())
+			if err != nil || len(ss) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould list the sessions of the user : %d, %v.", tests.Failed, testID, len(ss), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the sessions of the user.", tests.Success, testID)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(laptop)
+			sess, err := cookies.Get(r, "session")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould get the session : %s.", tests.Failed, testID, err)
+			}
+			n, err := store.DeleteByUser(ctx, usr.ID, session.StoredID(sess.ID))
+			if err != nil || n != 1 || !load(laptop) || load(phone) {
+				t.Fatalf("\t%s\tTest %d:\tShould sign out the other sessions : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign out the other sessions.", tests.Success, testID)
+
+			sess.Options.MaxAge = -1
+			if err := sess.Save(r, httptest.NewRecorder()); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to log out : %s.", tests.Failed, testID, err)
+			}
+			if load(laptop) {
+				t.Fatalf("\t%s\tTest %d:\tShould revoke the session on log out.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould revoke the session on log out.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen sessions expire.", testID)
+		{
+			c := login()
+			later := time.Now().Add(time.Duration(cookies.Options.MaxAge+1) * time.Second)
+
+			// A visitor who never signed in still gets a session, for the
+			// CSRF token and flash messages.
+			r := httptest.NewRequest("GET", "/", nil)
+			anon, err := cookies.Get(r, "session")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould get a session : %s.", tests.Failed, testID, err)
+			}
+			anon.Values["flash"] = "hello"
+			if err := anon.Save(r, httptest.NewRecorder()); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould save an anonymous session : %s.", tests.Failed, testID, err)
+			}
+			if n, err := store.CountActive(ctx, time.Now()); err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the signed in session only : %d, %v.", tests.Failed, testID, n, err)
+			}
+			if n, err := store.CountActive(ctx, later); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not count expired sessions : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the signed in sessions.", tests.Success, testID)
+
+			if n, err := store.DeleteExpired(ctx, time.Now()); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep active sessions : %d, %v.", tests.Failed, testID, n, err)
+			}
+			if n, err := store.DeleteExpired(ctx, later); err != nil || n != 2 || load(c) {
+				t.Fatalf("\t%s\tTest %d:\tShould remove expired sessions : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould remove expired sessions.", tests.Success, testID)
+		}
+	}
+}
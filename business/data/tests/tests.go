@@ -23,13 +23,26 @@ const (
 	Failed  = "\u2717"
 )
 
+// Run runs test against a fresh database of every driver: SQLite always, and
+// Postgres when one is available to NewUnitPostgres.
+func Run(t *testing.T, test func(t *testing.T, log *log.Logger, db *sqlx.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		log, db, teardown := NewUnit(t)
+		t.Cleanup(teardown)
+		test(t, log, db)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		log, db, teardown := NewUnitPostgres(t)
+		t.Cleanup(teardown)
+		test(t, log, db)
+	})
+}
+
 // NewUnit creates a test in-memory database. It creates the
 // required table structure but the database is otherwise empty. It returns
 // the database to use as well as a function to call at the end of the test.
 func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
-	r, w, _ := os.Pipe()
-	old := os.Stdout
-	os.Stdout = w
+	log, restore := captureLogs()
 
 	db, err := database.Open(database.Config{
 		Path:        ":memory:",
@@ -40,21 +53,99 @@ func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
 	if err != nil {
 		t.Fatalf("Opening database connection: %v", err)
 	}
+	migrate(t, db)
+
+	// teardown is the function that should be invoked when the caller is done
+	// with the database.
+	teardown := func() {
+		t.Helper()
+		db.Close()
+		restore()
+	}
+
+	return log, db, teardown
+}
+
+// NewUnitPostgres creates a test database on the Postgres server named by
+// PHOTOC_TEST_DB_HOST, as PHOTOC_TEST_DB_USER with PHOTOC_TEST_DB_PASSWORD
+// (both "postgres" by default). The test is skipped when there is no server.
+// The database is dropped again by the function returned.
+func NewUnitPostgres(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
+	host := os.Getenv("PHOTOC_TEST_DB_HOST")
+	if host == "" {
+		t.Skip("PHOTOC_TEST_DB_HOST is not set")
+	}
+	cfg := database.Config{
+		Driver:     database.DriverPostgres,
+		Host:       host,
+		User:       getenv("PHOTOC_TEST_DB_USER", "postgres"),
+		Password:   getenv("PHOTOC_TEST_DB_PASSWORD", "postgres"),
+		Name:       "postgres",
+		DisableTLS: true,
+	}
+
+	admin, err := database.Open(cfg)
+	if err != nil {
+		t.Fatalf("Opening database connection: %v", err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	if err := schema.Migrate(ctx, db); err != nil {
-		t.Fatalf("Migrating error: %s", err)
+	if err := database.StatusCheck(ctx, admin); err != nil {
+		admin.Close()
+		t.Skipf("Postgres at %s is not available: %v", host, err)
 	}
 
+	cfg.Name = fmt.Sprintf("photoc_test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, "CREATE DATABASE "+cfg.Name); err != nil {
+		admin.Close()
+		t.Fatalf("Creating database %s: %v", cfg.Name, err)
+	}
+
+	log, restore := captureLogs()
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		t.Fatalf("Opening database connection: %v", err)
+	}
+	migrate(t, db)
+
 	// teardown is the function that should be invoked when the caller is done
 	// with the database.
 	teardown := func() {
-		fmt.Println("!!!!!!!!!!!!!!! in teardown...")
 		t.Helper()
 		db.Close()
+		if _, err := admin.Exec("DROP DATABASE " + cfg.Name); err != nil {
+			t.Errorf("Dropping database %s: %v", cfg.Name, err)
+		}
+		admin.Close()
+		restore()
+	}
+
+	return log, db, teardown
+}
+
+// migrate brings the schema of a test database up to date.
+func migrate(t *testing.T, db *sqlx.DB) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	if err := schema.Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrating error: %s", err)
+	}
+}
+
+// captureLogs returns a logger whose output, along with anything else sent
+// to stdout, is held back until restore prints it after the test.
+func captureLogs() (*log.Logger, func()) {
+	r, w, _ := os.Pipe()
+	old := os.Stdout
+	os.Stdout = w
+
+	restore := func() {
 		w.Close()
 		var buf bytes.Buffer
 		io.Copy(&buf, r)
@@ -65,7 +156,15 @@ func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
 	}
 
 	log := log.New(os.Stdout, "TEST : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
-	return log, db, teardown
+	return log, restore
+}
+
+// getenv returns the environment variable key, or def when it is not set.
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
 }
 
 // StringPointer is a helper to get a *string from a string. It is in the tests
@@ -11,12 +11,94 @@ type AuthUser struct {
 	Email     string    `db:"email" json:"email"`
 	Pass      []byte    `db:"passw" json:"-"`
 	CreatedOn time.Time `db:"created" json:"date_created"`
+
+	// EmailVerifiedOn is when the user proved they own the email address.
+	EmailVerifiedOn *time.Time `db:"email_verified_at" json:"date_email_verified,omitempty"`
+
+	// TOTPEnabledOn is when the user turned on two-factor authentication.
+	TOTPEnabledOn *time.Time `db:"totp_enabled_at" json:"date_totp_enabled,omitempty"`
+
+	// Grants are the roles given to the user. They are loaded separately,
+	// see Store.QueryGrants.
+	Grants []Grant `db:"-" json:"grants,omitempty"`
+}
+
+// EmailVerified reports whether the user verified their email address.
+func (u AuthUser) EmailVerified() bool {
+	return u.EmailVerifiedOn != nil
+}
+
+// TOTPEnabled reports whether signing in needs a code from an authenticator
+// app on top of the password.
+func (u AuthUser) TOTPEnabled() bool {
+	return u.TOTPEnabledOn != nil
+}
+
+// HasRole reports whether the user holds a role, either site wide or for
+// the given contest. Pass 0 as contestID to only consider site wide grants.
+//
+// Every user is a participant. Site admins hold every role except juror:
+// jury seats are always granted explicitly since scores are tied to them.
+func (u AuthUser) HasRole(role Role, contestID int) bool {
+	if role == RoleParticipant {
+		return true
+	}
+	for _, g := range u.Grants {
+		if g.Role == RoleSiteAdmin && role != RoleJuror {
+			return true
+		}
+		if g.Role == role && (g.ContestID == 0 || g.ContestID == contestID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Role - what a user is allowed to do
+type Role string
+
+// Set of roles a user can be granted.
+const (
+	RoleParticipant  Role = "participant"
+	RoleJuror        Role = "juror"
+	RoleContestAdmin Role = "contest_admin"
+	RoleSiteAdmin    Role = "site_admin"
+)
+
+// Roles lists the known roles.
+var Roles = []Role{RoleParticipant, RoleJuror, RoleContestAdmin, RoleSiteAdmin}
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	for _, role := range Roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Grant - role given to a user, for a single contest or site wide when
+// ContestID is 0
+type Grant struct {
+	UserID    int       `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	Email     string    `db:"email" json:"email"`
+	Role      Role      `db:"role" json:"role"`
+	ContestID int       `db:"contest_id" json:"contest_id,omitempty"`
+	CreatedOn time.Time `db:"created" json:"date_created"`
 }
 
 // NewAuthUser - struct for creating new users
 type NewAuthUser struct {
 	Name        string `json:"name" validate:"required"`
-	Email       string `json:"email" validate:"required"`
-	Pass        string `json:"pass" valdate:"required"`
+	Email       string `json:"email" validate:"required,email"`
+	Pass        string `json:"pass" validate:"required"`
+	PassConfirm string `json:"pass_confirm" validate:"eqfield=Pass"`
+}
+
+// NewPassword - struct for changing the password of a user
+type NewPassword struct {
+	Pass        string `json:"pass" validate:"required,min=8"`
 	PassConfirm string `json:"pass_confirm" validate:"eqfield=Pass"`
 }
@@ -0,0 +1,171 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"photo-contest/foundation/reqid"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidToken is returned for reset tokens that are unknown, expired or
+// already used. The cases are not told apart on purpose.
+var ErrInvalidToken = errors.New("password reset link is invalid or has expired")
+
+// ResetTokenTTL is how long a password reset link stays valid.
+const ResetTokenTTL = time.Hour
+
+// CreateResetToken issues a single use token allowing the user to pick a new
+// password. Only a hash of the token is stored; the token itself is meant to
+// be emailed to the user.
+func (s Store) CreateResetToken(ctx context.Context, userID int, now time.Time) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", errors.Wrap(err, "generating token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	data := struct {
+		TokenHash string    `db:"token_hash"`
+		UserID    int       `db:"user_id"`
+		Expires   time.Time `db:"expires"`
+		CreatedOn time.Time `db:"created"`
+	}{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		Expires:   now.Add(ResetTokenTTL).UTC(),
+		CreatedOn: now.UTC(),
+	}
+	const query = `
+	INSERT INTO password_reset
+		(token_hash, user_id, expires, created)
+	VALUES
+		(:token_hash, :user_id, :expires, :created)`
+
+	s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.CreateResetToken", userID)
+
+	if _, err := s.db.NamedExecContext(ctx, query, data); err != nil {
+		return "", errors.Wrapf(err, "inserting reset token for user %d", userID)
+	}
+
+	return token, nil
+}
+
+// CheckResetToken returns the ID of the user a reset token was issued for,
+// as long as the token can still be used.
+func (s Store) CheckResetToken(ctx context.Context, token string, now time.Time) (int, error) {
+	data := struct {
+		TokenHash string    `db:"token_hash"`
+		Now       time.Time `db:"now"`
+	}{
+		TokenHash: hashToken(token),
+		Now:       now.UTC(),
+	}
+	const query = `
+	SELECT
+		user_id
+	FROM password_reset
+	WHERE token_hash = :token_hash AND used IS NULL AND expires > :now`
+
+	s.log.Printf("%s: %s: checking token", reqid.Get(ctx), "user.CheckResetToken")
+
+	var row struct {
+		UserID int `db:"user_id"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &row); err != nil {
+		if err == database.ErrNotFound {
+			return 0, ErrInvalidToken
+		}
+		return 0, errors.Wrap(err, "selecting reset token")
+	}
+
+	return row.UserID, nil
+}
+
+// ResetPassword sets a new password for the user the token was issued for,
+// whose ID it returns so their sessions can be revoked. The token is used up
+// along with any other token issued to the user.
+func (s Store) ResetPassword(ctx context.Context, token string, np NewPassword, now time.Time) (int, error) {
+	if err := validate.Check(np); err != nil {
+		return 0, errors.Wrap(err, "validating data")
+	}
+
+	userID, err := s.CheckResetToken(ctx, token, now)
+	if err != nil {
+		return 0, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(np.Pass), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, errors.Wrap(err, "generating password hash")
+	}
+
+	data := struct {
+		UserID    int       `db:"user_id"`
+		TokenHash string    `db:"token_hash"`
+		Pass      []byte    `db:"passw"`
+		Now       time.Time `db:"now"`
+	}{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		Pass:      hash,
+		Now:       now.UTC(),
+	}
+
+	// Using the token is the first statement and checks it is still unused,
+	// so two concurrent resets with the same token can't both succeed.
+	const use = `
+	UPDATE password_reset SET
+		used = :now
+	WHERE token_hash = :token_hash AND used IS NULL`
+	const others = `
+	UPDATE password_reset SET
+		used = :now
+	WHERE user_id = :user_id AND used IS NULL`
+	const passw = `
+	UPDATE auth_user SET
+		passw = :passw
+	WHERE user_id = :user_id`
+
+	s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.ResetPassword", userID)
+
+	err = database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, use, data)
+		if err != nil {
+			return errors.Wrap(err, "using reset token")
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrInvalidToken
+		}
+
+		for _, query := range []string{others, passw} {
+			if _, err := tx.NamedExecContext(ctx, query, data); err != nil {
+				return errors.Wrapf(err, "resetting password of user %d", userID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// hashToken returns the form a token is stored in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package user_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestResetPassword(t *testing.T) {
+	tests.Run(t, testResetPassword)
+}
+
+func testResetPassword(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	store := user.NewStore(log, db)
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	usr, err := store.Create(ctx, user.NewAuthUser{
+		Name:        "Forgetful",
+		Email:       "forgetful@example.com",
+		Pass:        "gophers1",
+		PassConfirm: "gophers1",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	t.Log("Given the need to reset forgotten passwords.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a reset token.", testID)
+		{
+			token, err := store.CreateResetToken(ctx, usr.ID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a token.", tests.Success, testID)
+
+			if id, err := store.CheckResetToken(ctx, token, now); err != nil || id != usr.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the token : %d, %v.", tests.Failed, testID, id, err)
+			}
+			if _, err := store.CheckResetToken(ctx, token, now.Add(user.ResetTokenTTL)); err != user.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept an expired token : %v.", tests.Failed, testID, err)
+			}
+			if _, err := store.CheckResetToken(ctx, token+"x", now); err != user.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept an unknown token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only accept valid tokens.", tests.Success, testID)
+
+			short := user.NewPassword{Pass: "short", PassConfirm: "short"}
+			if _, err := store.ResetPassword(ctx, token, short, now); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a short password.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not accept a short password.", tests.Success, testID)
+
+			other, err := store.CreateResetToken(ctx, usr.ID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a second token : %s.", tests.Failed, testID, err)
+			}
+
+			np := user.NewPassword{Pass: "gophers2", PassConfirm: "gophers2"}
+			userID, err := store.ResetPassword(ctx, token, np, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset the password : %s.", tests.Failed, testID, err)
+			}
+			if userID != usr.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould reset the password of the user : got user %d.", tests.Failed, testID, userID)
+			}
+			if _, err := store.Authenticate(ctx, usr.Email, np.Pass); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould log in with the new password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reset the password.", tests.Success, testID)
+
+			for _, tok := range []string{token, other} {
+				if _, err := store.ResetPassword(ctx, tok, np, now); err != user.ErrInvalidToken {
+					t.Fatalf("\t%s\tTest %d:\tShould not reuse tokens : %v.", tests.Failed, testID, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould not reuse tokens.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package user
+
+import (
+	"context"
+	"photo-contest/foundation/database"
+	"photo-contest/foundation/reqid"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for granting roles.
+var (
+	ErrInvalidRole  = errors.New("role is not valid")
+	ErrNeedsContest = errors.New("role can only be granted for a contest")
+)
+
+// Grant gives a role to a user. Use 0 as contestID for a site wide grant.
+// Jurors and contest admins always sit on a given contest, since a site wide
+// grant would give them a say in every contest.
+// Granting a role twice is not an error.
+func (s Store) Grant(ctx context.Context, userID int, role Role, contestID int, now time.Time) error {
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+	if contestID == 0 && (role == RoleJuror || role == RoleContestAdmin) {
+		return ErrNeedsContest
+	}
+
+	g := Grant{
+		UserID:    userID,
+		Role:      role,
+		ContestID: contestID,
+		CreatedOn: now.UTC(),
+	}
+	const query = `
+	INSERT INTO user_role
+		(user_id, role, contest_id, created)
+	VALUES
+		(:user_id, :role, :contest_id, :created)
+	ON CONFLICT (user_id, role, contest_id) DO NOTHING`
+
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.Grant", database.Log(query, g))
+
+	if _, err := s.db.NamedExecContext(ctx, query, g); err != nil {
+		return errors.Wrapf(err, "granting %s to user %d", role, userID)
+	}
+
+	return nil
+}
+
+// Revoke takes a role away from a user.
+func (s Store) Revoke(ctx context.Context, userID int, role Role, contestID int) error {
+	g := Grant{
+		UserID:    userID,
+		Role:      role,
+		ContestID: contestID,
+	}
+	const query = `
+	DELETE FROM user_role
+	WHERE user_id = :user_id AND role = :role AND contest_id = :contest_id`
+
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.Revoke", database.Log(query, g))
+
+	if _, err := s.db.NamedExecContext(ctx, query, g); err != nil {
+		return errors.Wrapf(err, "revoking %s from user %d", role, userID)
+	}
+
+	return nil
+}
+
+// QueryGrants retrieves the roles given to a user.
+func (s Store) QueryGrants(ctx context.Context, userID int) ([]Grant, error) {
+	data := struct {
+		UserID int `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+	const query = `
+	SELECT
+		r.user_id, u.name, u.email, r.role, r.contest_id, r.created
+	FROM user_role r
+		JOIN auth_user u ON u.user_id = r.user_id
+	WHERE r.user_id = :user_id
+	ORDER BY r.contest_id, r.role`
+
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.QueryGrants", database.Log(query, data))
+
+	var gs []Grant
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &gs); err != nil {
+		return nil, errors.Wrapf(err, "selecting grants of user %d", userID)
+	}
+
+	return gs, nil
+}
+
+// QueryByRole retrieves the users holding a role. Use 0 as contestID for
+// site wide grants.
+func (s Store) QueryByRole(ctx context.Context, role Role, contestID int) ([]Grant, error) {
+	data := struct {
+		Role      Role `db:"role"`
+		ContestID int  `db:"contest_id"`
+	}{
+		Role:      role,
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT
+		r.user_id, u.name, u.email, r.role, r.contest_id, r.created
+	FROM user_role r
+		JOIN auth_user u ON u.user_id = r.user_id
+	WHERE r.role = :role AND r.contest_id = :contest_id
+	ORDER BY u.name`
+
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.QueryByRole", database.Log(query, data))
+
+	var gs []Grant
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &gs); err != nil {
+		return nil, errors.Wrapf(err, "selecting %s grants", role)
+	}
+
+	return gs, nil
+}
+
+// ListGrants retrieves all the roles given to users, site wide grants first.
+func (s Store) ListGrants(ctx context.Context) ([]Grant, error) {
+	const query = `
+	SELECT
+		r.user_id, u.name, u.email, r.role, r.contest_id, r.created
+	FROM user_role r
+		JOIN auth_user u ON u.user_id = r.user_id
+	ORDER BY r.contest_id, r.role, u.name`
+
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.ListGrants", database.Log(query))
+
+	var gs []Grant
+	if err := database.NamedQuerySlice(ctx, s.db, query, struct{}{}, &gs); err != nil {
+		return nil, errors.Wrap(err, "selecting grants")
+	}
+
+	return gs, nil
+}
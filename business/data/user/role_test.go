@@ -0,0 +1,107 @@
+package user_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRole(t *testing.T) {
+	tests.Run(t, testRole)
+}
+
+func testRole(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	store := user.NewStore(log, db)
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	usr, err := store.Create(ctx, user.NewAuthUser{
+		Name:        "Juror",
+		Email:       "juror@example.com",
+		Pass:        "gophers",
+		PassConfirm: "gophers",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	t.Log("Given the need to give roles to users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen granting roles per contest.", testID)
+		{
+			if err := store.Grant(ctx, usr.ID, user.Role("owner"), 0, now); err != user.ErrInvalidRole {
+				t.Fatalf("\t%s\tTest %d:\tShould not grant unknown roles : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not grant unknown roles.", tests.Success, testID)
+
+			for i := 0; i < 2; i++ {
+				if err := store.Grant(ctx, usr.ID, user.RoleJuror, 1, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to grant a role : %s.", tests.Failed, testID, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to grant a role.", tests.Success, testID)
+
+			usr.Grants, err = store.QueryGrants(ctx, usr.ID)
+			if err != nil || len(usr.Grants) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould retrieve one grant : %d, %v.", tests.Failed, testID, len(usr.Grants), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retrieve one grant.", tests.Success, testID)
+
+			if !usr.HasRole(user.RoleJuror, 1) || usr.HasRole(user.RoleJuror, 2) || usr.HasRole(user.RoleJuror, 0) {
+				t.Fatalf("\t%s\tTest %d:\tShould be a juror of the granted contest only.", tests.Failed, testID)
+			}
+			if !usr.HasRole(user.RoleParticipant, 2) || usr.HasRole(user.RoleContestAdmin, 1) {
+				t.Fatalf("\t%s\tTest %d:\tShould be a participant elsewhere.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be a juror of the granted contest only.", tests.Success, testID)
+
+			jurors, err := store.QueryByRole(ctx, user.RoleJuror, 1)
+			if err != nil || len(jurors) != 1 || jurors[0].Email != usr.Email {
+				t.Fatalf("\t%s\tTest %d:\tShould list the jurors of the contest : %+v, %v.", tests.Failed, testID, jurors, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the jurors of the contest.", tests.Success, testID)
+
+			if err := store.Revoke(ctx, usr.ID, user.RoleJuror, 1); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke a role : %s.", tests.Failed, testID, err)
+			}
+			usr.Grants, err = store.QueryGrants(ctx, usr.ID)
+			if err != nil || usr.HasRole(user.RoleJuror, 1) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke a role : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke a role.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen granting site wide roles.", testID)
+		{
+			for _, role := range []user.Role{user.RoleJuror, user.RoleContestAdmin} {
+				if err := store.Grant(ctx, usr.ID, role, 0, now); err != user.ErrNeedsContest {
+					t.Fatalf("\t%s\tTest %d:\tShould not grant %s site wide : %v.", tests.Failed, testID, role, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould only grant contest roles for a contest.", tests.Success, testID)
+
+			if err := store.Grant(ctx, usr.ID, user.RoleSiteAdmin, 0, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to grant a site wide role : %s.", tests.Failed, testID, err)
+			}
+			usr.Grants, err = store.QueryGrants(ctx, usr.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve grants : %s.", tests.Failed, testID, err)
+			}
+			if !usr.HasRole(user.RoleSiteAdmin, 0) || !usr.HasRole(user.RoleContestAdmin, 7) {
+				t.Fatalf("\t%s\tTest %d:\tShould let site admins administer every contest.", tests.Failed, testID)
+			}
+			if usr.HasRole(user.RoleJuror, 7) {
+				t.Fatalf("\t%s\tTest %d:\tShould not make site admins jurors.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould let site admins administer every contest.", tests.Success, testID)
+		}
+	}
+}
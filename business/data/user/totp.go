@@ -0,0 +1,373 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"photo-contest/foundation/database"
+	"photo-contest/foundation/reqid"
+	"photo-contest/foundation/totp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of errors returned by the two-factor authentication functions.
+var (
+	ErrInvalidCode    = errors.New("authentication code is invalid")
+	ErrTOTPEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled = errors.New("two-factor authentication is not enabled")
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets at once.
+const RecoveryCodeCount = 10
+
+// recoveryEncoding spells recovery codes in lower case base32.
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// BeginTOTP generates the secret the user adds to their authenticator app.
+// Two-factor authentication only gets turned on once EnableTOTP is given a
+// code proving the app was set up; until then a new call replaces the
+// secret.
+func (s Store) BeginTOTP(ctx context.Context, userID int) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		UserID int    `db:"user_id"`
+		Secret string `db:"totp_secret"`
+	}{
+		UserID: userID,
+		Secret: secret,
+	}
+	const query = `
+	UPDATE auth_user SET
+		totp_secret = :totp_secret
+	WHERE user_id = :user_id AND totp_enabled_at IS NULL`
+
+	s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.BeginTOTP", userID)
+
+	res, err := s.db.NamedExecContext(ctx, query, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "setting secret of user %d", userID)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return "", err
+		}
+		return "", ErrTOTPEnabled
+	}
+
+	return secret, nil
+}
+
+// PendingTOTP returns the secret set by BeginTOTP while two-factor
+// authentication is not enabled yet, or an empty string if there is none.
+func (s Store) PendingTOTP(ctx context.Context, userID int) (string, error) {
+	t, err := s.queryTOTP(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if t.EnabledOn != nil {
+		return "", nil
+	}
+	return t.Secret, nil
+}
+
+// EnableTOTP turns two-factor authentication on once the user typed a valid
+// code for the pending secret. It returns the recovery codes, which are only
+// stored hashed and can't be shown again.
+func (s Store) EnableTOTP(ctx context.Context, userID int, code string, now time.Time) ([]string, error) {
+	t, err := s.queryTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if t.EnabledOn != nil {
+		return nil, ErrTOTPEnabled
+	}
+	if t.Secret == "" {
+		return nil, ErrTOTPNotEnabled
+	}
+	step, ok := totp.Validate(t.Secret, code, now)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	data := struct {
+		UserID    int       `db:"user_id"`
+		Step      int64     `db:"totp_last_step"`
+		EnabledOn time.Time `db:"totp_enabled_at"`
+	}{
+		UserID:    userID,
+		Step:      step,
+		EnabledOn: now.UTC(),
+	}
+	const query = `
+	UPDATE auth_user SET
+		totp_enabled_at = :totp_enabled_at,
+		totp_last_step = :totp_last_step
+	WHERE user_id = :user_id AND totp_enabled_at IS NULL`
+
+	s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.EnableTOTP", userID)
+
+	var codes []string
+	err = database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, query, data)
+		if err != nil {
+			return errors.Wrapf(err, "enabling two-factor authentication of user %d", userID)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrTOTPEnabled
+		}
+
+		codes, err = s.replaceRecoveryCodes(ctx, tx, userID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off and drops the secret and
+// the recovery codes.
+func (s Store) DisableTOTP(ctx context.Context, userID int) error {
+	data := struct {
+		UserID int `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+	const codes = `
+	DELETE FROM recovery_code
+	WHERE user_id = :user_id`
+	const disable = `
+	UPDATE auth_user SET
+		totp_secret = '',
+		totp_enabled_at = NULL,
+		totp_last_step = 0
+	WHERE user_id = :user_id`
+
+	s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.DisableTOTP", userID)
+
+	return database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		for _, query := range []string{codes, disable} {
+			if _, err := tx.NamedExecContext(ctx, query, data); err != nil {
+				return errors.Wrapf(err, "disabling two-factor authentication of user %d", userID)
+			}
+		}
+		return nil
+	})
+}
+
+// CheckTOTP verifies the second factor of a user signing in. The code is
+// either one from the authenticator app, which can only be used once, or an
+// unused recovery code, which is then used up.
+func (s Store) CheckTOTP(ctx context.Context, userID int, code string, now time.Time) error {
+	t, err := s.queryTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if t.EnabledOn == nil {
+		return ErrTOTPNotEnabled
+	}
+
+	if step, ok := totp.Validate(t.Secret, code, now); ok {
+		data := struct {
+			UserID int   `db:"user_id"`
+			Step   int64 `db:"totp_last_step"`
+		}{
+			UserID: userID,
+			Step:   step,
+		}
+
+		// Moving the last step forward only succeeds once per step, so a
+		// code seen by someone else can't be replayed.
+		const query = `
+		UPDATE auth_user SET
+			totp_last_step = :totp_last_step
+		WHERE user_id = :user_id AND totp_last_step < :totp_last_step`
+
+		s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.CheckTOTP", userID)
+
+		res, err := s.db.NamedExecContext(ctx, query, data)
+		if err != nil {
+			return errors.Wrapf(err, "using code of user %d", userID)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err != nil {
+				return err
+			}
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	data := struct {
+		UserID   int       `db:"user_id"`
+		CodeHash string    `db:"code_hash"`
+		Now      time.Time `db:"now"`
+	}{
+		UserID:   userID,
+		CodeHash: hashToken(normalizeRecoveryCode(code)),
+		Now:      now.UTC(),
+	}
+	const query = `
+	UPDATE recovery_code SET
+		used = :now
+	WHERE user_id = :user_id AND code_hash = :code_hash AND used IS NULL`
+
+	s.log.Printf("%s: %s: user %d recovery code", reqid.Get(ctx), "user.CheckTOTP", userID)
+
+	res, err := s.db.NamedExecContext(ctx, query, data)
+	if err != nil {
+		return errors.Wrapf(err, "using recovery code of user %d", userID)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return err
+		}
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user with new
+// ones and returns them.
+func (s Store) RegenerateRecoveryCodes(ctx context.Context, userID int, now time.Time) ([]string, error) {
+	t, err := s.queryTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if t.EnabledOn == nil {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	var codes []string
+	err = database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		codes, err = s.replaceRecoveryCodes(ctx, tx, userID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes the user has.
+func (s Store) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	data := struct {
+		UserID int `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+	const query = `
+	SELECT
+		COUNT(*) AS n
+	FROM recovery_code
+	WHERE user_id = :user_id AND used IS NULL`
+
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.RecoveryCodesLeft", database.Log(query, data))
+
+	var row struct {
+		N int `db:"n"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &row); err != nil {
+		return 0, errors.Wrapf(err, "counting recovery codes of user %d", userID)
+	}
+
+	return row.N, nil
+}
+
+// totpState is the two-factor authentication setup of a user.
+type totpState struct {
+	Secret    string     `db:"totp_secret"`
+	EnabledOn *time.Time `db:"totp_enabled_at"`
+}
+
+// queryTOTP loads the two-factor authentication setup of a user.
+func (s Store) queryTOTP(ctx context.Context, userID int) (totpState, error) {
+	data := struct {
+		UserID int `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+	const query = `
+	SELECT
+		totp_secret, totp_enabled_at
+	FROM auth_user
+	WHERE user_id = :user_id`
+
+	s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.queryTOTP", userID)
+
+	var t totpState
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &t); err != nil {
+		if err == database.ErrNotFound {
+			return totpState{}, database.ErrNotFound
+		}
+		return totpState{}, errors.Wrapf(err, "selecting two-factor setup of user %d", userID)
+	}
+
+	return t, nil
+}
+
+// replaceRecoveryCodes drops the recovery codes of a user and stores hashes
+// of new ones, which are returned.
+func (s Store) replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID int, now time.Time) ([]string, error) {
+	data := struct {
+		UserID    int       `db:"user_id"`
+		CodeHash  string    `db:"code_hash"`
+		CreatedOn time.Time `db:"created"`
+	}{
+		UserID:    userID,
+		CreatedOn: now.UTC(),
+	}
+	const remove = `
+	DELETE FROM recovery_code
+	WHERE user_id = :user_id`
+	const insert = `
+	INSERT INTO recovery_code
+		(user_id, code_hash, created)
+	VALUES
+		(:user_id, :code_hash, :created)`
+
+	s.log.Printf("%s: %s: user %d", reqid.Get(ctx), "user.replaceRecoveryCodes", userID)
+
+	if _, err := tx.NamedExecContext(ctx, remove, data); err != nil {
+		return nil, errors.Wrapf(err, "removing recovery codes of user %d", userID)
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, errors.Wrap(err, "generating recovery code")
+		}
+		code := recoveryEncoding.EncodeToString(raw)
+		codes[i] = code[:4] + "-" + code[4:]
+
+		data.CodeHash = hashToken(code)
+		if _, err := tx.NamedExecContext(ctx, insert, data); err != nil {
+			return nil, errors.Wrapf(err, "inserting recovery code of user %d", userID)
+		}
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode undoes the formatting of a recovery code as typed by
+// the user.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
@@ -0,0 +1,125 @@
+package user_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"photo-contest/foundation/totp"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestTOTP(t *testing.T) {
+	tests.Run(t, testTOTP)
+}
+
+func testTOTP(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	store := user.NewStore(log, db)
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	usr, err := store.Create(ctx, user.NewAuthUser{
+		Name:        "Careful",
+		Email:       "careful@example.com",
+		Pass:        "gophers1",
+		PassConfirm: "gophers1",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	var secret string
+
+	t.Log("Given the need to sign in with two factors.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen enrolling an authenticator app.", testID)
+		{
+			secret, err = store.BeginTOTP(ctx, usr.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to begin enrollment : %s.", tests.Failed, testID, err)
+			}
+			if pending, err := store.PendingTOTP(ctx, usr.ID); err != nil || pending != secret {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the pending secret : %q, %v.", tests.Failed, testID, pending, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to begin enrollment.", tests.Success, testID)
+
+			if _, err := store.EnableTOTP(ctx, usr.ID, "000000", now); err != user.ErrInvalidCode {
+				t.Fatalf("\t%s\tTest %d:\tShould not enable with a wrong code : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not enable with a wrong code.", tests.Success, testID)
+
+			code, err := totp.Code(secret, totp.Step(now))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to compute a code : %s.", tests.Failed, testID, err)
+			}
+			recovery, err := store.EnableTOTP(ctx, usr.ID, code, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enable : %s.", tests.Failed, testID, err)
+			}
+			if len(recovery) != user.RecoveryCodeCount {
+				t.Fatalf("\t%s\tTest %d:\tShould get recovery codes : got %d.", tests.Failed, testID, len(recovery))
+			}
+			saved, err := store.QueryByID(ctx, usr.ID)
+			if err != nil || !saved.TOTPEnabled() {
+				t.Fatalf("\t%s\tTest %d:\tShould see two-factor authentication enabled : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to enable.", tests.Success, testID)
+
+			if _, err := store.BeginTOTP(ctx, usr.ID); err != user.ErrTOTPEnabled {
+				t.Fatalf("\t%s\tTest %d:\tShould not replace the secret once enabled : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not replace the secret once enabled.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen checking the second factor.", testID)
+		{
+			pending, _ := store.PendingTOTP(ctx, usr.ID)
+			if pending != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not show the secret once enabled.", tests.Failed, testID)
+			}
+
+			later := now.Add(time.Minute)
+			code, _ := totp.Code(secret, totp.Step(later))
+			if err := store.CheckTOTP(ctx, usr.ID, code, later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a current code : %s.", tests.Failed, testID, err)
+			}
+			if err := store.CheckTOTP(ctx, usr.ID, code, later); err != user.ErrInvalidCode {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a code twice : %v.", tests.Failed, testID, err)
+			}
+			old, _ := totp.Code(secret, totp.Step(now.Add(-time.Hour)))
+			if err := store.CheckTOTP(ctx, usr.ID, old, later); err != user.ErrInvalidCode {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept an old code : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept each current code once.", tests.Success, testID)
+
+			recovery, err := store.RegenerateRecoveryCodes(ctx, usr.ID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to regenerate recovery codes : %s.", tests.Failed, testID, err)
+			}
+			if err := store.CheckTOTP(ctx, usr.ID, " "+recovery[0]+" ", later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a recovery code : %s.", tests.Failed, testID, err)
+			}
+			if err := store.CheckTOTP(ctx, usr.ID, recovery[0], later); err != user.ErrInvalidCode {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a recovery code twice : %v.", tests.Failed, testID, err)
+			}
+			if n, err := store.RecoveryCodesLeft(ctx, usr.ID); err != nil || n != user.RecoveryCodeCount-1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the unused recovery codes : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept each recovery code once.", tests.Success, testID)
+
+			if err := store.DisableTOTP(ctx, usr.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to disable : %s.", tests.Failed, testID, err)
+			}
+			if err := store.CheckTOTP(ctx, usr.ID, recovery[1], later); err != user.ErrTOTPNotEnabled {
+				t.Fatalf("\t%s\tTest %d:\tShould not check codes once disabled : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to disable.", tests.Success, testID)
+		}
+	}
+}
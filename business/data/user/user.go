@@ -1,9 +1,11 @@
 package user
 
 import (
+	"context"
 	"log"
 	"photo-contest/business/sys/validate"
 	"photo-contest/foundation/database"
+	"photo-contest/foundation/reqid"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -26,7 +28,7 @@ func NewStore(log *log.Logger, db *sqlx.DB) Store {
 }
 
 // Create - add new user into db
-func (s Store) Create(nu NewAuthUser) (AuthUser, error) {
+func (s Store) Create(ctx context.Context, nu NewAuthUser) (AuthUser, error) {
 
 	if err := validate.Check(nu); err != nil {
 		return AuthUser{}, errors.Wrap(err, "validating data")
@@ -50,27 +52,22 @@ func (s Store) Create(nu NewAuthUser) (AuthUser, error) {
 	VALUES 
 		(:email, :name, :passw, :created)`
 
-	s.log.Printf("%s: %s", "user.Create", database.Log(query, usr))
+	// The hash stays out of the log.
+	logged := usr
+	logged.Pass = nil
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.Create", database.Log(query, logged))
 
-	res, err := s.db.NamedExec(query, usr)
+	id, err := database.NamedInsertID(ctx, s.db, query, usr, "user_id")
 	if err != nil {
 		return AuthUser{}, errors.Wrap(err, "inserting user")
 	}
-
-	rowNum, _ := res.RowsAffected()
-	s.log.Println(" -- added to auth_user: ", rowNum)
-
-	id, err := res.LastInsertId()
-	if err != nil {
-		return AuthUser{}, err
-	}
-	usr.ID = int(id)
+	usr.ID = id
 
 	return usr, nil
 }
 
 // QueryByEmail - retrieves user
-func (s Store) QueryByEmail(email string) (AuthUser, error) {
+func (s Store) QueryByEmail(ctx context.Context, email string) (AuthUser, error) {
 
 	// TODO validate email address
 
@@ -81,17 +78,15 @@ func (s Store) QueryByEmail(email string) (AuthUser, error) {
 	}
 	const query = `
         SELECT
-			user_id, name, email, passw, created
+			user_id, name, email, passw, created, email_verified_at, totp_enabled_at
 		FROM 
 			auth_user
 		WHERE email = :email`
 
-	s.log.Printf("%s: %s", "user.QueryByEmail",
-		database.Log(query, data),
-	)
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.QueryByEmail", database.Log(query, data))
 
 	var usr AuthUser
-	if err := database.NamedQueryStruct(s.db, query, data, &usr); err != nil {
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &usr); err != nil {
 		if err == database.ErrNotFound {
 			return AuthUser{}, database.ErrNotFound
 		}
@@ -102,7 +97,7 @@ func (s Store) QueryByEmail(email string) (AuthUser, error) {
 }
 
 // QueryByID - return given user
-func (s Store) QueryByID(user_id int) (AuthUser, error) {
+func (s Store) QueryByID(ctx context.Context, user_id int) (AuthUser, error) {
 
 	data := struct {
 		UserID int `db:"user_id"`
@@ -110,14 +105,14 @@ func (s Store) QueryByID(user_id int) (AuthUser, error) {
 		UserID: user_id,
 	}
 	const query = `
-        SELECT user_id, name, email, passw, created
+        SELECT user_id, name, email, passw, created, email_verified_at, totp_enabled_at
 		FROM auth_user
 		WHERE user_id = :user_id`
 
-	s.log.Printf("%s %s", "user.QueryByID", database.Log(query, data))
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.QueryByID", database.Log(query, data))
 
 	var usr AuthUser
-	if err := database.NamedQueryStruct(s.db, query, data, &usr); err != nil {
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &usr); err != nil {
 		if err == database.ErrNotFound {
 			return AuthUser{}, database.ErrNotFound
 		}
@@ -130,8 +125,8 @@ func (s Store) QueryByID(user_id int) (AuthUser, error) {
 
 // Authenticate finds a user by their email and verifies their password. On
 // success it returns the AuthUser instance
-func (s Store) Authenticate(email, password string) (*AuthUser, error) {
-	usr, err := s.QueryByEmail(email)
+func (s Store) Authenticate(ctx context.Context, email, password string) (*AuthUser, error) {
+	usr, err := s.QueryByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
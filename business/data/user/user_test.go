@@ -1,16 +1,22 @@
 package user_test
 
 import (
+	"context"
+	"log"
 	"photo-contest/business/data/tests"
 	"photo-contest/business/data/user"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
 )
 
 func TestUser(t *testing.T) {
-	log, db, teardown := tests.NewUnit(t)
-	t.Cleanup(teardown)
+	tests.Run(t, testUser)
+}
+
+func testUser(t *testing.T, log *log.Logger, db *sqlx.DB) {
+	ctx := context.Background()
 
 	store := user.NewStore(log, db)
 
@@ -25,13 +31,13 @@ func TestUser(t *testing.T) {
 				Pass:        "HopaHopaPenelopa",
 				PassConfirm: "HopaHopaPenelopa",
 			}
-			usr, err := store.Create(nu)
+			usr, err := store.Create(ctx, nu)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
 
-			saved, err := store.QueryByID(usr.ID)
+			saved, err := store.QueryByID(ctx, usr.ID)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve user by ID: %s.", tests.Failed, testID, err)
 			}
@@ -0,0 +1,116 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"photo-contest/foundation/database"
+	"photo-contest/foundation/reqid"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidVerification is returned for email verification links that are
+// forged, expired or meant for an address the user no longer has.
+var ErrInvalidVerification = errors.New("verification link is invalid or has expired")
+
+// VerifyTokenTTL is how long an email verification link stays valid.
+const VerifyTokenTTL = 48 * time.Hour
+
+// NewVerifyToken signs a token proving the user received mail at their
+// address. The token carries the user ID, the address and the expiry; nothing
+// is stored, the HMAC is what makes it trustworthy.
+func NewVerifyToken(key []byte, usr AuthUser, now time.Time) string {
+	payload := fmt.Sprintf("%d|%d|%s", usr.ID, now.Add(VerifyTokenTTL).Unix(), usr.Email)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sign(key, payload)
+}
+
+// ParseVerifyToken checks the signature and expiry of a verification token
+// and returns the user ID and email address it was issued for.
+func ParseVerifyToken(key []byte, token string, now time.Time) (int, string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return 0, "", ErrInvalidVerification
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, "", ErrInvalidVerification
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(sign(key, payload)), []byte(parts[1])) {
+		return 0, "", ErrInvalidVerification
+	}
+
+	fields := strings.SplitN(payload, "|", 3)
+	if len(fields) != 3 {
+		return 0, "", ErrInvalidVerification
+	}
+	userID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", ErrInvalidVerification
+	}
+	expires, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return 0, "", ErrInvalidVerification
+	}
+
+	return userID, fields[2], nil
+}
+
+// VerifyEmail marks the email address of the user as verified using a token
+// from NewVerifyToken. Verifying twice is not an error.
+func (s Store) VerifyEmail(ctx context.Context, key []byte, token string, now time.Time) (AuthUser, error) {
+	userID, email, err := ParseVerifyToken(key, token, now)
+	if err != nil {
+		return AuthUser{}, err
+	}
+
+	usr, err := s.QueryByID(ctx, userID)
+	if err != nil {
+		if err == database.ErrNotFound {
+			return AuthUser{}, ErrInvalidVerification
+		}
+		return AuthUser{}, errors.Wrap(err, "verifying email")
+	}
+	if usr.Email != email {
+		return AuthUser{}, ErrInvalidVerification
+	}
+	if usr.EmailVerified() {
+		return usr, nil
+	}
+
+	verified := now.UTC()
+	usr.EmailVerifiedOn = &verified
+
+	data := struct {
+		UserID          int        `db:"user_id"`
+		EmailVerifiedOn *time.Time `db:"email_verified_at"`
+	}{
+		UserID:          usr.ID,
+		EmailVerifiedOn: usr.EmailVerifiedOn,
+	}
+	const query = `
+	UPDATE auth_user SET
+		email_verified_at = :email_verified_at
+	WHERE user_id = :user_id`
+
+	s.log.Printf("%s: %s: %s", reqid.Get(ctx), "user.VerifyEmail", database.Log(query, data))
+
+	if _, err := s.db.NamedExecContext(ctx, query, data); err != nil {
+		return AuthUser{}, errors.Wrapf(err, "verifying email of user %d", usr.ID)
+	}
+
+	return usr, nil
+}
+
+// sign returns the HMAC of payload as base64.
+func sign(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
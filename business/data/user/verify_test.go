@@ -0,0 +1,73 @@
+package user_test
+
+import (
+	"context"
+	"log"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	tests.Run(t, testVerifyEmail)
+}
+
+func testVerifyEmail(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	store := user.NewStore(log, db)
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+	key := []byte("verification key")
+
+	if _, err := store.Create(ctx, user.NewAuthUser{Name: "Bogus", Email: "not an email", Pass: "gophers1", PassConfirm: "gophers1"}); err == nil {
+		t.Fatalf("creating a user with an invalid email should fail")
+	}
+
+	usr, err := store.Create(ctx, user.NewAuthUser{
+		Name:        "Newcomer",
+		Email:       "newcomer@example.com",
+		Pass:        "gophers1",
+		PassConfirm: "gophers1",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	t.Log("Given the need to verify email addresses.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen following a verification link.", testID)
+		{
+			if usr.EmailVerified() {
+				t.Fatalf("\t%s\tTest %d:\tShould start unverified.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould start unverified.", tests.Success, testID)
+
+			token := user.NewVerifyToken(key, usr, now)
+			if _, err := store.VerifyEmail(ctx, []byte("other key"), token, now); err != user.ErrInvalidVerification {
+				t.Fatalf("\t%s\tTest %d:\tShould reject tokens signed with another key : %v.", tests.Failed, testID, err)
+			}
+			if _, err := store.VerifyEmail(ctx, key, token, now.Add(user.VerifyTokenTTL)); err != user.ErrInvalidVerification {
+				t.Fatalf("\t%s\tTest %d:\tShould reject expired tokens : %v.", tests.Failed, testID, err)
+			}
+			forged := usr
+			forged.Email = "someone@example.com"
+			if _, err := store.VerifyEmail(ctx, key, user.NewVerifyToken(key, forged, now), now); err != user.ErrInvalidVerification {
+				t.Fatalf("\t%s\tTest %d:\tShould reject tokens for another address : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject invalid tokens.", tests.Success, testID)
+
+			if _, err := store.VerifyEmail(ctx, key, token, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify the email : %s.", tests.Failed, testID, err)
+			}
+			saved, err := store.QueryByID(ctx, usr.ID)
+			if err != nil || !saved.EmailVerified() {
+				t.Fatalf("\t%s\tTest %d:\tShould record the verification : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify the email.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package vote
+
+import (
+	"time"
+)
+
+// Vote - public vote cast by a user for a photo
+type Vote struct {
+	UserID    int       `db:"user_id" json:"user_id"`
+	PhotoID   int       `db:"photo_id" json:"photo_id"`
+	ContestID int       `db:"contest_id" json:"contest_id"`
+	CreatedOn time.Time `db:"created" json:"date_created"`
+}
+
+// Tally - number of votes a photo received
+type Tally struct {
+	PhotoID int `db:"photo_id" json:"photo_id"`
+	Votes   int `db:"votes" json:"votes"`
+}
@@ -0,0 +1,232 @@
+// Package vote provides support for public voting on contest photos.
+package vote
+
+import (
+	"context"
+	"log"
+	"photo-contest/foundation/database"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Set of error variables for voting.
+var (
+	ErrAlreadyVoted    = errors.New("you already voted for this photo")
+	ErrBudgetExhausted = errors.New("you have no votes left in this contest")
+)
+
+// Store manages the set of API's for vote access.
+type Store struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// NewStore constructs a vote store for api access.
+func NewStore(log *log.Logger, db *sqlx.DB) Store {
+	return Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Cast records a vote of a user for a photo. A user votes at most once per
+// photo and can't cast more than budget votes in a contest.
+func (s Store) Cast(ctx context.Context, v Vote, budget int, now time.Time) error {
+	v.CreatedOn = now.UTC()
+	data := struct {
+		Vote
+		Budget int `db:"budget"`
+	}{
+		Vote:   v,
+		Budget: budget,
+	}
+
+	// The budget is checked in the same statement as the insert so that
+	// concurrent votes can't overspend it.
+	query := `
+	INSERT INTO vote
+		(user_id, photo_id, contest_id, created)
+	SELECT
+		:user_id, :photo_id, :contest_id, :created
+	WHERE (
+		SELECT COUNT(*) FROM vote
+		WHERE user_id = :user_id AND contest_id = :contest_id
+	) < :budget`
+
+	// Postgres can't tell the types of parameters selected as values.
+	if s.db.DriverName() == database.DriverPostgres {
+		query = `
+		INSERT INTO vote
+			(user_id, photo_id, contest_id, created)
+		SELECT
+			CAST(:user_id AS INTEGER), CAST(:photo_id AS INTEGER),
+			CAST(:contest_id AS INTEGER), CAST(:created AS TIMESTAMPTZ)
+		WHERE (
+			SELECT COUNT(*) FROM vote
+			WHERE user_id = :user_id AND contest_id = :contest_id
+		) < :budget`
+	}
+
+	return database.WithTx(ctx, s.db, func(tx *sqlx.Tx) error {
+
+		// Concurrent transactions each count the votes committed before
+		// them, so the votes of a user in a contest are cast one at a time.
+		if err := database.LockKey(ctx, tx, int64(v.UserID)<<32|int64(v.ContestID)); err != nil {
+			return errors.Wrap(err, "locking votes")
+		}
+
+		if _, err := s.queryByUserPhoto(ctx, tx, v.UserID, v.PhotoID); err == nil {
+			return ErrAlreadyVoted
+		} else if err != database.ErrNotFound {
+			return errors.Wrap(err, "checking for an existing vote")
+		}
+
+		s.log.Printf("%s: %s", "vote.Cast", database.Log(query, data))
+
+		res, err := tx.NamedExecContext(ctx, query, data)
+		if err != nil {
+			return errors.Wrap(err, "inserting vote")
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrBudgetExhausted
+		}
+
+		return nil
+	})
+}
+
+// Remove takes back the vote of a user for a photo.
+func (s Store) Remove(ctx context.Context, userID, photoID int) error {
+	data := struct {
+		UserID  int `db:"user_id"`
+		PhotoID int `db:"photo_id"`
+	}{
+		UserID:  userID,
+		PhotoID: photoID,
+	}
+	const query = `
+	DELETE FROM vote
+	WHERE user_id = :user_id AND photo_id = :photo_id`
+
+	s.log.Printf("%s: %s", "vote.Remove", database.Log(query, data))
+
+	res, err := s.db.NamedExecContext(ctx, query, data)
+	if err != nil {
+		return errors.Wrapf(err, "deleting vote for photo %d", photoID)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return database.ErrNotFound
+	}
+
+	return nil
+}
+
+// QueryByUserPhoto returns the vote of a user for a photo.
+func (s Store) QueryByUserPhoto(ctx context.Context, userID, photoID int) (Vote, error) {
+	return s.queryByUserPhoto(ctx, s.db, userID, photoID)
+}
+
+// queryByUserPhoto looks the vote up using db, the database or a transaction.
+func (s Store) queryByUserPhoto(ctx context.Context, db sqlx.ExtContext, userID, photoID int) (Vote, error) {
+	data := struct {
+		UserID  int `db:"user_id"`
+		PhotoID int `db:"photo_id"`
+	}{
+		UserID:  userID,
+		PhotoID: photoID,
+	}
+	const query = `
+	SELECT user_id, photo_id, contest_id, created
+	FROM vote
+	WHERE user_id = :user_id AND photo_id = :photo_id`
+
+	s.log.Printf("%s: %s", "vote.QueryByUserPhoto", database.Log(query, data))
+
+	var v Vote
+	if err := database.NamedQueryStruct(ctx, db, query, data, &v); err != nil {
+		if err == database.ErrNotFound {
+			return Vote{}, database.ErrNotFound
+		}
+		return Vote{}, errors.Wrapf(err, "selecting vote for photo %d", data.PhotoID)
+	}
+
+	return v, nil
+}
+
+// QueryByUserContest returns the votes a user cast in a contest.
+func (s Store) QueryByUserContest(ctx context.Context, userID, contestID int) ([]Vote, error) {
+	data := struct {
+		UserID    int `db:"user_id"`
+		ContestID int `db:"contest_id"`
+	}{
+		UserID:    userID,
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT user_id, photo_id, contest_id, created
+	FROM vote
+	WHERE user_id = :user_id AND contest_id = :contest_id
+	ORDER BY created`
+
+	s.log.Printf("%s: %s", "vote.QueryByUserContest", database.Log(query, data))
+
+	var vs []Vote
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &vs); err != nil {
+		return nil, errors.Wrapf(err, "selecting votes for contest %d", contestID)
+	}
+
+	return vs, nil
+}
+
+// Count returns the number of votes a photo received.
+func (s Store) Count(ctx context.Context, photoID int) (int, error) {
+	data := struct {
+		PhotoID int `db:"photo_id"`
+	}{
+		PhotoID: photoID,
+	}
+	const query = `
+	SELECT photo_id, COUNT(*) AS votes
+	FROM vote
+	WHERE photo_id = :photo_id
+	GROUP BY photo_id`
+
+	s.log.Printf("%s: %s", "vote.Count", database.Log(query, data))
+
+	var t Tally
+	if err := database.NamedQueryStruct(ctx, s.db, query, data, &t); err != nil {
+		if err == database.ErrNotFound {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "counting votes for photo %d", photoID)
+	}
+
+	return t.Votes, nil
+}
+
+// Tallies returns the number of votes of every photo of a contest that
+// received at least one vote.
+func (s Store) Tallies(ctx context.Context, contestID int) ([]Tally, error) {
+	data := struct {
+		ContestID int `db:"contest_id"`
+	}{
+		ContestID: contestID,
+	}
+	const query = `
+	SELECT photo_id, COUNT(*) AS votes
+	FROM vote
+	WHERE contest_id = :contest_id
+	GROUP BY photo_id
+	ORDER BY votes DESC, photo_id`
+
+	s.log.Printf("%s: %s", "vote.Tallies", database.Log(query, data))
+
+	var ts []Tally
+	if err := database.NamedQuerySlice(ctx, s.db, query, data, &ts); err != nil {
+		return nil, errors.Wrapf(err, "counting votes for contest %d", contestID)
+	}
+
+	return ts, nil
+}
@@ -0,0 +1,116 @@
+package vote_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"photo-contest/business/data/contest"
+	"photo-contest/business/data/photo"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"photo-contest/business/data/vote"
+	"photo-contest/foundation/database"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestVote(t *testing.T) {
+	tests.Run(t, testVote)
+}
+
+func testVote(t *testing.T, log *log.Logger, db *sqlx.DB) {
+
+	ctx := context.Background()
+	now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	usr, err := user.NewStore(log, db).Create(ctx, user.NewAuthUser{
+		Name:        "Voter",
+		Email:       "voter@example.com",
+		Pass:        "gophers",
+		PassConfirm: "gophers",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+	c, err := contest.NewStore(log, db).Create(ctx, contest.NewContest{
+		UserID:      usr.ID,
+		Title:       "Urban Nature",
+		SubmitStart: now,
+		SubmitEnd:   now.Add(24 * time.Hour),
+		VoteBudget:  2,
+	}, now)
+	if err != nil {
+		t.Fatalf("creating contest: %s", err)
+	}
+
+	var photos []photo.Photo
+	for i := 0; i < 3; i++ {
+		orig := photo.Original{SHA256: fmt.Sprintf("%064d", i), MIME: "image/jpeg", Size: 1, Width: 640, Height: 640}
+		np := photo.NewPhoto{ContestID: c.ID, UserID: usr.ID, Title: fmt.Sprintf("Photo %d", i)}
+		p, err := photo.NewStore(log, db).Create(ctx, np, orig, now)
+		if err != nil {
+			t.Fatalf("creating photo: %s", err)
+		}
+		photos = append(photos, p)
+	}
+
+	store := vote.NewStore(log, db)
+	ballot := func(p photo.Photo) vote.Vote {
+		return vote.Vote{UserID: usr.ID, PhotoID: p.ID, ContestID: c.ID}
+	}
+
+	t.Log("Given the need to work with Vote records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user votes within a budget of %d.", testID, c.VoteBudget)
+		{
+			if err := store.Cast(ctx, ballot(photos[0]), c.VoteBudget, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to vote : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to vote.", tests.Success, testID)
+
+			if err := store.Cast(ctx, ballot(photos[0]), c.VoteBudget, now); err != vote.ErrAlreadyVoted {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to vote twice for a photo : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to vote twice for a photo.", tests.Success, testID)
+
+			if err := store.Cast(ctx, ballot(photos[1]), c.VoteBudget, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to vote for another photo : %s.", tests.Failed, testID, err)
+			}
+			if err := store.Cast(ctx, ballot(photos[2]), c.VoteBudget, now); err != vote.ErrBudgetExhausted {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to exceed the budget : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to exceed the budget.", tests.Success, testID)
+
+			n, err := store.Count(ctx, photos[0].ID)
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count a single vote : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count a single vote.", tests.Success, testID)
+
+			if err := store.Remove(ctx, usr.ID, photos[0].ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to take back a vote : %s.", tests.Failed, testID, err)
+			}
+			if err := store.Remove(ctx, usr.ID, photos[0].ID); err != database.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find a vote taken back : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to take back a vote.", tests.Success, testID)
+
+			if err := store.Cast(ctx, ballot(photos[2]), c.VoteBudget, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to spend a vote taken back : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to spend a vote taken back.", tests.Success, testID)
+
+			tallies, err := store.Tallies(ctx, c.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to count the votes of the contest : %s.", tests.Failed, testID, err)
+			}
+			if len(tallies) != 2 || tallies[0].PhotoID != photos[1].ID || tallies[1].PhotoID != photos[2].ID {
+				t.Fatalf("\t%s\tTest %d:\tShould count the votes of the contest : got %+v.", tests.Failed, testID, tallies)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the votes of the contest.", tests.Success, testID)
+		}
+	}
+}
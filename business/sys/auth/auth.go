@@ -0,0 +1,126 @@
+// Package auth issues and validates the JSON Web Tokens API clients use to
+// authenticate. The claims carry everything the API needs to know about the
+// user, so requests are served without looking up a session.
+package auth
+
+import (
+	"crypto/rsa"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/pkg/errors"
+)
+
+// Issuer is set in the tokens and expected back.
+const Issuer = "photo-contest"
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, or
+// not signed by one of our keys.
+var ErrInvalidToken = errors.New("token is invalid or has expired")
+
+// KeyLookup gives access to the keys, by key ID. Only the active key needs
+// a private part; keys being retired are kept to verify.
+type KeyLookup interface {
+	PrivateKey(kid string) (*rsa.PrivateKey, error)
+	PublicKey(kid string) (*rsa.PublicKey, error)
+}
+
+// Grant is a role held by the user, for a single contest or site wide when
+// ContestID is 0.
+type Grant struct {
+	Role      string `json:"role"`
+	ContestID int    `json:"contest_id,omitempty"`
+}
+
+// Claims are the contents of a token. The subject is the user ID.
+type Claims struct {
+	jwt.StandardClaims
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	EmailVerifiedOn *time.Time `json:"email_verified_at,omitempty"`
+	Grants          []Grant    `json:"grants,omitempty"`
+}
+
+// NewClaims returns the claims of a token for userID, valid for ttl.
+func NewClaims(userID int, now time.Time, ttl time.Duration) Claims {
+	return Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    Issuer,
+			IssuedAt:  jwt.At(now),
+			ExpiresAt: jwt.At(now.Add(ttl)),
+		},
+	}
+}
+
+// UserID returns the ID of the user the token was issued to.
+func (c Claims) UserID() (int, error) {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing subject %q", c.Subject)
+	}
+	return id, nil
+}
+
+// Auth signs tokens with the active key and validates tokens signed with
+// any key the lookup knows.
+type Auth struct {
+	activeKID string
+	keyLookup KeyLookup
+	method    jwt.SigningMethod
+	parser    *jwt.Parser
+}
+
+// New returns an Auth signing with the key activeKID, which must be known
+// to keyLookup along with its private part.
+func New(activeKID string, keyLookup KeyLookup) (*Auth, error) {
+	if _, err := keyLookup.PrivateKey(activeKID); err != nil {
+		return nil, errors.Wrapf(err, "looking up active key %q", activeKID)
+	}
+
+	method := jwt.SigningMethodRS256
+	a := Auth{
+		activeKID: activeKID,
+		keyLookup: keyLookup,
+		method:    method,
+		parser:    jwt.NewParser(jwt.WithValidMethods([]string{method.Alg()}), jwt.WithIssuer(Issuer)),
+	}
+	return &a, nil
+}
+
+// GenerateToken returns the signed token for claims. The key ID goes in the
+// header so the key can be found again after it was rotated out.
+func (a *Auth) GenerateToken(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(a.method, claims)
+	token.Header["kid"] = a.activeKID
+
+	key, err := a.keyLookup.PrivateKey(a.activeKID)
+	if err != nil {
+		return "", errors.Wrapf(err, "looking up active key %q", a.activeKID)
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", errors.Wrap(err, "signing token")
+	}
+	return signed, nil
+}
+
+// ValidateToken checks the signature and lifetime of a token and returns
+// its claims.
+func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("missing key ID in token header")
+		}
+		return a.keyLookup.PublicKey(kid)
+	}
+
+	var claims Claims
+	token, err := a.parser.ParseWithClaims(tokenStr, &claims, keyFunc)
+	if err != nil || !token.Valid {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,175 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/sys/auth"
+	"photo-contest/foundation/keystore"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+)
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+
+	key := newKey(t)
+	writePEM(t, filepath.Join(dir, "2021-06.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	ks, err := keystore.NewFS(dir)
+	if err != nil {
+		t.Fatalf("loading keys: %s", err)
+	}
+
+	a, err := auth.New("2021-06", ks)
+	if err != nil {
+		t.Fatalf("constructing auth: %s", err)
+	}
+
+	now := time.Now()
+	claims := auth.NewClaims(42, now, time.Hour)
+	claims.Name = "Gopher"
+	claims.Grants = []auth.Grant{{Role: "juror", ContestID: 7}}
+
+	t.Log("Given the need to authenticate API clients with tokens.")
+	{
+		var token string
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a token we issued.", testID)
+		{
+			token, err = a.GenerateToken(claims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to issue a token : %s.", tests.Failed, testID, err)
+			}
+			got, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate the token : %s.", tests.Failed, testID, err)
+			}
+			userID, err := got.UserID()
+			if err != nil || userID != 42 || got.Name != "Gopher" || len(got.Grants) != 1 || got.Grants[0] != claims.Grants[0] {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the claims : got %+v, %v.", tests.Failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the claims.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the token was signed with an unknown key.", testID)
+		{
+			other := newKey(t)
+			tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			tkn.Header["kid"] = "2021-05"
+			signed, err := tkn.SignedString(other)
+			if err != nil {
+				t.Fatalf("signing token: %s", err)
+			}
+			if _, err := a.ValidateToken(signed); err != auth.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the token : %v.", tests.Failed, testID, err)
+			}
+
+			// Our key ID, someone else's key.
+			tkn.Header["kid"] = "2021-06"
+			signed, err = tkn.SignedString(other)
+			if err != nil {
+				t.Fatalf("signing token: %s", err)
+			}
+			if _, err := a.ValidateToken(signed); err != auth.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the forged token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse the token.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the token names another algorithm.", testID)
+		{
+			none := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+			none.Header["kid"] = "2021-06"
+			signed, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			if err != nil {
+				t.Fatalf("signing token: %s", err)
+			}
+			if _, err := a.ValidateToken(signed); err != auth.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse an unsigned token : %v.", tests.Failed, testID, err)
+			}
+
+			// The public key is no secret; a token using it as an HMAC key
+			// must not pass for one signed with the private key.
+			der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			if err != nil {
+				t.Fatalf("encoding key: %s", err)
+			}
+			hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+			hmac.Header["kid"] = "2021-06"
+			signed, err = hmac.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			if err != nil {
+				t.Fatalf("signing token: %s", err)
+			}
+			if _, err := a.ValidateToken(signed); err != auth.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse an HMAC token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only accept RS256.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the token has expired.", testID)
+		{
+			expired, err := a.GenerateToken(auth.NewClaims(42, now.Add(-2*time.Hour), time.Hour))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to issue a token : %s.", tests.Failed, testID, err)
+			}
+			if _, err := a.ValidateToken(expired); err != auth.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse the token.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the signing key was rotated out.", testID)
+		{
+			next := newKey(t)
+			writePEM(t, filepath.Join(dir, "2021-07.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(next))
+			der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			if err != nil {
+				t.Fatalf("encoding key: %s", err)
+			}
+			writePEM(t, filepath.Join(dir, "2021-06.pem"), "PUBLIC KEY", der)
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("reloading keys: %s", err)
+			}
+
+			rotated, err := auth.New("2021-07", ks)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign with the new key : %s.", tests.Failed, testID, err)
+			}
+			if _, err := rotated.ValidateToken(token); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould still accept tokens of the old key : %s.", tests.Failed, testID, err)
+			}
+			if _, err := auth.New("2021-06", ks); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not sign with a key kept to verify.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still accept tokens of the old key.", tests.Success, testID)
+		}
+	}
+}
+
+// newKey generates an RSA key to sign test tokens with.
+func newKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+	return key
+}
+
+// writePEM writes a single PEM block to path.
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("writing key: %s", err)
+	}
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/database"
+	"photo-contest/foundation/reqid"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorPage renders the HTML page shown for a failed request.
+type ErrorPage func(w http.ResponseWriter, r *http.Request, status int, msg string)
+
+// Errors turns a Handler into an http.HandlerFunc responding to the errors
+// it returns: as JSON for the API, with page otherwise. Errors meant for the
+// client are shown as they are; anything else is logged and reported as an
+// internal error so no details leak.
+func Errors(log *log.Logger, page ErrorPage) func(Handler) http.HandlerFunc {
+	return func(h Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			err := h(w, r)
+			if err == nil {
+				return
+			}
+
+			resp, status := ErrorResponse(err)
+			if status == http.StatusInternalServerError {
+				log.Printf("%s: %s %s: %+v", reqid.Get(r.Context()), r.Method, r.URL.Path, err)
+			}
+
+			if IsAPI(r) {
+				Respond(w, resp, status)
+				return
+			}
+			page(w, r, status, resp.Error)
+		}
+	}
+}
+
+// ErrorResponse returns the response for err and its status code.
+func ErrorResponse(err error) (validate.ErrorResponse, int) {
+	var (
+		re *validate.RequestError
+		fe validate.FieldErrors
+	)
+	switch {
+	case errors.As(err, &re):
+		resp := validate.ErrorResponse{Error: re.Error()}
+		if fields, ok := re.Fields.(validate.FieldErrors); ok {
+			resp.Error = "data validation error"
+			resp.Fields = fields
+		}
+		return resp, re.Status
+
+	case errors.As(err, &fe):
+		return validate.ErrorResponse{Error: "data validation error", Fields: fe}, http.StatusBadRequest
+
+	case errors.Cause(err) == database.ErrNotFound:
+		return validate.ErrorResponse{Error: http.StatusText(http.StatusNotFound)}, http.StatusNotFound
+
+	case errors.Cause(err) == database.ErrForbidden:
+		return validate.ErrorResponse{Error: http.StatusText(http.StatusForbidden)}, http.StatusForbidden
+	}
+
+	return validate.ErrorResponse{Error: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError
+}
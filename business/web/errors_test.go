@@ -0,0 +1,86 @@
+package web_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"photo-contest/foundation/database"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestErrors(t *testing.T) {
+	fields := validate.FieldErrors{{Field: "email", Error: "email must be a valid email address"}}
+
+	tt := []struct {
+		name   string
+		err    error
+		status int
+		resp   validate.ErrorResponse
+		logged bool
+	}{
+		{"a request error", validate.NewRequestError(errors.New("title is required"), http.StatusConflict), http.StatusConflict, validate.ErrorResponse{Error: "title is required"}, false},
+		{"field errors", errors.Wrap(fields, "validating data"), http.StatusBadRequest, validate.ErrorResponse{Error: "data validation error", Fields: fields}, false},
+		{"a missing record", errors.Wrap(database.ErrNotFound, "selecting contest"), http.StatusNotFound, validate.ErrorResponse{Error: "Not Found"}, false},
+		{"a forbidden action", database.ErrForbidden, http.StatusForbidden, validate.ErrorResponse{Error: "Forbidden"}, false},
+		{"an unknown error", errors.New("pq: relation \"contest\" does not exist"), http.StatusInternalServerError, validate.ErrorResponse{Error: "Internal Server Error"}, true},
+	}
+
+	t.Log("Given the need to turn handler errors into responses.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen a handler returns %s.", testID, tc.name)
+			{
+				var buf bytes.Buffer
+				var page struct {
+					status int
+					msg    string
+				}
+				h := web.Errors(log.New(&buf, "", 0), func(w http.ResponseWriter, r *http.Request, status int, msg string) {
+					page.status, page.msg = status, msg
+					w.WriteHeader(status)
+				})(func(w http.ResponseWriter, r *http.Request) error {
+					return tc.err
+				})
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/contests/1", nil))
+
+				if w.Code != tc.status {
+					t.Fatalf("\t%s\tTest %d:\tShould respond with %d : got %d.", tests.Failed, testID, tc.status, w.Code)
+				}
+				var got validate.ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould respond with JSON : %s.", tests.Failed, testID, err)
+				}
+				if diff := cmp.Diff(tc.resp, got); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould respond with the expected body : %s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould respond with %d and the expected body.", tests.Success, testID, tc.status)
+
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/contests/1", nil))
+				if page.status != tc.status || page.msg != tc.resp.Error {
+					t.Fatalf("\t%s\tTest %d:\tShould render the error page : %d %q.", tests.Failed, testID, page.status, page.msg)
+				}
+				t.Logf("\t%s\tTest %d:\tShould render the error page.", tests.Success, testID)
+
+				logged := strings.Contains(buf.String(), tc.err.Error())
+				if logged != tc.logged {
+					t.Fatalf("\t%s\tTest %d:\tShould only log internal errors : %q.", tests.Failed, testID, buf.String())
+				}
+				if strings.Contains(got.Error, "pq:") || strings.Contains(page.msg, "pq:") {
+					t.Fatalf("\t%s\tTest %d:\tShould not leak the error : %q.", tests.Failed, testID, got.Error)
+				}
+				t.Logf("\t%s\tTest %d:\tShould only log internal errors.", tests.Success, testID)
+			}
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package web
+
+import "net/http"
+
+// MaxBodySize caps the bodies of the requests going to the handlers after it
+// at n bytes. It has to run before anything reading the form, csrf.Protect
+// among them, for the cap to hold; requests announcing a larger body are
+// turned away without reading it.
+func MaxBodySize(n int64) func(http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"photo-contest/foundation/reqid"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ctxKey is the type of the context key holding the request values.
+type ctxKey int
+
+const key ctxKey = 1
+
+// RequestIDHeader carries the request ID, from a proxy in front of us and
+// back to the client.
+const RequestIDHeader = "X-Request-ID"
+
+// Values describe a request while it is being served.
+type Values struct {
+	RequestID string
+	Now       time.Time
+	UserID    int
+}
+
+// GetValues returns the values of the request served with ctx, nil outside
+// of the Logger middleware.
+func GetValues(ctx context.Context) *Values {
+	v, _ := ctx.Value(key).(*Values)
+	return v
+}
+
+// SetUserID records the user making the request, for the request log.
+func SetUserID(ctx context.Context, userID int) {
+	if v := GetValues(ctx); v != nil {
+		v.UserID = userID
+	}
+}
+
+// Logger assigns every request an ID and logs a line once it is served:
+//
+//	request_id=3f2a... method=POST path=/login status=303 bytes=0 duration=12ms user_id=4 form=email,password
+//
+// The ID given by the client in X-Request-ID is kept when it looks sane.
+// Only the names of posted form fields are logged, and the tokens carried
+// in paths are redacted.
+func Logger(log *log.Logger) func(http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			v := Values{
+				RequestID: requestID(r.Header.Get(RequestIDHeader)),
+				Now:       time.Now(),
+			}
+			w.Header().Set(RequestIDHeader, v.RequestID)
+			ctx := reqid.NewContext(r.Context(), v.RequestID)
+			r = r.WithContext(context.WithValue(ctx, key, &v))
+
+			// Handlers work on copies of the request, so the form is parsed
+			// here for it to be around when logging. Uploads are left alone.
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+				r.ParseForm()
+			}
+
+			rec := statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(&rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			line := fmt.Sprintf("request_id=%s method=%s path=%s status=%d bytes=%d duration=%s user_id=%d remote=%s",
+				v.RequestID, r.Method, quote(redactPath(r.URL.Path)), rec.status, rec.bytes,
+				time.Since(v.Now).Round(time.Microsecond), v.UserID, r.RemoteAddr)
+			if fields := formFields(r.PostForm); fields != "" {
+				line += " form=" + quote(fields)
+			}
+			log.Print(line)
+		}
+	}
+}
+
+// statusRecorder remembers the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Flush lets streamed responses through the recorder.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// requestID returns the ID given by the client when it is short and plain
+// enough to log, or a new random one.
+func requestID(given string) string {
+	if given != "" && len(given) <= 64 && strings.Trim(given, "0123456789abcdefABCDEF-_.") == "" {
+		return given
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// formFields returns the names of the posted form fields. Their values are
+// left out: besides passwords and tokens, forms carry emails, names and
+// captions that don't belong in a log either.
+func formFields(form url.Values) string {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// redactPath hides the long path segments that carry the reset and email
+// verification tokens.
+func redactPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if len(seg) >= 32 {
+			segs[i] = "[redacted]"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// quote quotes s when it would break up the log line.
+func quote(s string) string {
+	if strings.ContainsAny(s, " \"=\t\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
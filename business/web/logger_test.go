@@ -0,0 +1,101 @@
+package web_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/data/user"
+	"photo-contest/business/web"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestLogger(t *testing.T) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatalf("generating token: %s", err)
+	}
+	resetToken := base64.RawURLEncoding.EncodeToString(raw)
+	verifyToken := user.NewVerifyToken([]byte("key"), user.AuthUser{ID: 4, Email: "a@example.com"}, time.Now())
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Log("Given the need to log requests without their secrets or personal data.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a form is posted.", testID)
+		{
+			var buf bytes.Buffer
+			h := web.Apply(ok, web.Logger(log.New(&buf, "", 0)))
+
+			form := url.Values{
+				"email":              {"a@example.com"},
+				"password":           {"hunter2-pass"},
+				"password_confirm":   {"hunter2-confirm"},
+				"code":               {"287082"},
+				"gorilla.csrf.Token": {"csrf-token-value"},
+			}
+			r := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			line := buf.String()
+			if !strings.Contains(line, "form=code,email,gorilla.csrf.Token,password,password_confirm") {
+				t.Fatalf("\t%s\tTest %d:\tShould log the form fields : %s", tests.Failed, testID, line)
+			}
+			for name := range form {
+				if strings.Contains(line, form.Get(name)) {
+					t.Fatalf("\t%s\tTest %d:\tShould not log the value of %s : %s", tests.Failed, testID, name, line)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould only log the names of the form fields.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the path carries a token.", testID)
+		{
+			for _, path := range []string{"/reset-password/" + resetToken, "/verify-email/" + verifyToken} {
+				var buf bytes.Buffer
+				h := web.Apply(ok, web.Logger(log.New(&buf, "", 0)))
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+
+				line := buf.String()
+				prefix := path[:strings.LastIndex(path, "/")+1]
+				if !strings.Contains(line, "path="+prefix+"[redacted]") || strings.Contains(line, path[len(prefix):]) {
+					t.Fatalf("\t%s\tTest %d:\tShould redact the token : %s", tests.Failed, testID, line)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould redact the token.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a handler fails.", testID)
+		{
+			var buf bytes.Buffer
+			log := log.New(&buf, "", 0)
+			fail := web.Errors(log, func(w http.ResponseWriter, r *http.Request, status int, msg string) {
+				w.WriteHeader(status)
+			})(func(w http.ResponseWriter, r *http.Request) error {
+				return errors.New("disk on fire")
+			})
+			h := web.Apply(fail, web.Logger(log))
+
+			r := httptest.NewRequest("GET", "/contests/1", nil)
+			r.Header.Set(web.RequestIDHeader, "abc-1234")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if !strings.Contains(buf.String(), "abc-1234: GET /contests/1: disk on fire") {
+				t.Fatalf("\t%s\tTest %d:\tShould log the error with the request ID : %s", tests.Failed, testID, buf.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould log the error with the request ID.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/http"
+	"photo-contest/foundation/metrics"
+	"strconv"
+	"time"
+)
+
+var (
+	requests = metrics.NewCounter("http_requests_total",
+		"Requests served, by route and status code.", "method", "route", "status")
+	requestDuration = metrics.NewHistogram("http_request_duration_seconds",
+		"Time taken to serve requests, by route.", metrics.DefBuckets, "method", "route")
+)
+
+// Metrics counts and times requests. They are grouped by the pattern of the
+// route they matched, as returned by route, so that each photo or contest
+// doesn't get a series of its own. It goes after Logger.
+func Metrics(route func(*http.Request) string) func(http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec, ok := w.(*statusRecorder)
+			if !ok {
+				rec = &statusRecorder{ResponseWriter: w}
+			}
+
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			name := route(r)
+			requests.Inc(r.Method, name, strconv.Itoa(status))
+			requestDuration.Observe(time.Since(start).Seconds(), r.Method, name)
+		}
+	}
+}
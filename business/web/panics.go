@@ -0,0 +1,51 @@
+package web
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"photo-contest/business/sys/validate"
+	"photo-contest/foundation/reqid"
+	"runtime/debug"
+)
+
+// panics counts the panics recovered since the process started, published
+// with the other expvars.
+var panics = expvar.NewInt("panics")
+
+// Panics recovers from a panic in the handlers after it: the stack is logged
+// with the request ID and the client gets an internal error instead of a
+// dropped connection. It goes after Logger, which then logs the 500.
+func Panics(log *log.Logger, page ErrorPage) func(http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+
+				// Raised on purpose to abort the response; net/http keeps
+				// quiet about it.
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				panics.Add(1)
+				log.Printf("%s: PANIC: %v\n%s", reqid.Get(r.Context()), rec, debug.Stack())
+
+				// Too late to change the response when part of it went out.
+				if sr, ok := w.(*statusRecorder); ok && sr.status != 0 {
+					return
+				}
+				if IsAPI(r) {
+					Respond(w, validate.ErrorResponse{Error: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+					return
+				}
+				page(w, r, http.StatusInternalServerError, "Something went wrong on our side. Please try again in a moment.")
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package web_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/sys/validate"
+	"photo-contest/business/web"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPanics(t *testing.T) {
+	boom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map in judge")
+	})
+	panics := func() int {
+		n, _ := strconv.Atoi(expvar.Get("panics").String())
+		return n
+	}
+
+	// serve runs h behind Logger and Panics as main does, with the request ID
+	// the client gave.
+	serve := func(h http.Handler, path string) (*httptest.ResponseRecorder, string) {
+		var buf bytes.Buffer
+		log := log.New(&buf, "", 0)
+		page := func(w http.ResponseWriter, r *http.Request, status int, msg string) {
+			w.WriteHeader(status)
+			w.Write([]byte("<p>" + msg + "</p>"))
+		}
+		h = web.Apply(h, web.Logger(log), web.Panics(log, page))
+
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set(web.RequestIDHeader, "abc-1234")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w, buf.String()
+	}
+
+	t.Log("Given the need to survive panicking handlers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a page handler panics.", testID)
+		{
+			before := panics()
+			w, logged := serve(boom, "/judge/1")
+
+			if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<p>Something went wrong") {
+				t.Fatalf("\t%s\tTest %d:\tShould render the error page : %d %q.", tests.Failed, testID, w.Code, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould render the error page.", tests.Success, testID)
+
+			if got := panics(); got != before+1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the panic : got %d, want %d.", tests.Failed, testID, got, before+1)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the panic.", tests.Success, testID)
+
+			if !strings.Contains(logged, "abc-1234: PANIC: nil map in judge") || !strings.Contains(logged, "panics_test.go") {
+				t.Fatalf("\t%s\tTest %d:\tShould log the stack with the request ID : %s", tests.Failed, testID, logged)
+			}
+			if !strings.Contains(logged, "request_id=abc-1234 method=GET path=/judge/1 status=500") {
+				t.Fatalf("\t%s\tTest %d:\tShould log the request as failed : %s", tests.Failed, testID, logged)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log the stack with the request ID.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen an API handler panics.", testID)
+		{
+			w, _ := serve(boom, "/api/v1/contests")
+
+			var resp validate.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusInternalServerError || resp.Error != "Internal Server Error" {
+				t.Fatalf("\t%s\tTest %d:\tShould respond with a JSON error : %d %+v, %v.", tests.Failed, testID, w.Code, resp, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould respond with a JSON error.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a handler aborts the response.", testID)
+		{
+			abort := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(http.ErrAbortHandler)
+			})
+
+			before := panics()
+			func() {
+				defer func() {
+					if rec := recover(); rec != http.ErrAbortHandler {
+						t.Fatalf("\t%s\tTest %d:\tShould panic again with ErrAbortHandler : got %v.", tests.Failed, testID, rec)
+					}
+				}()
+				serve(abort, "/photos/1/full")
+			}()
+			if got := panics(); got != before {
+				t.Fatalf("\t%s\tTest %d:\tShould not count aborted responses : got %d, want %d.", tests.Failed, testID, got, before)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave aborted responses to net/http.", tests.Success, testID)
+		}
+	}
+}
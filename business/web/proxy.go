@@ -0,0 +1,93 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseProxies reads the addresses of the trusted proxies, each a single IP
+// address or a CIDR range.
+func ParseProxies(addrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, errors.Errorf("%q is not an IP address", addr)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			addr += "/" + strconv.Itoa(bits)
+		}
+		_, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing proxy %q", addr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Proxies sets the address of requests relayed by a trusted proxy to the
+// client address the proxy put in X-Forwarded-For, so the handlers, the
+// sign in throttle and the logs after it see the client rather than the
+// proxy. The header is read from the right: the entries left of the last
+// one added by a trusted proxy were written by the client and could be
+// anything. Without trusted proxies the header is ignored.
+func Proxies(trusted []*net.IPNet) func(http.Handler) http.HandlerFunc {
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			peer, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				peer = r.RemoteAddr
+			}
+			if !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var hops []string
+			for _, h := range r.Header.Values("X-Forwarded-For") {
+				hops = append(hops, strings.Split(h, ",")...)
+			}
+			client := peer
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if net.ParseIP(hop) == nil {
+					break
+				}
+				client = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+			if client != peer {
+				r.RemoteAddr = net.JoinHostPort(client, "0")
+			}
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"photo-contest/business/data/tests"
+	"photo-contest/business/web"
+	"testing"
+)
+
+func TestProxies(t *testing.T) {
+	proxies, err := web.ParseProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("parsing proxies: %s", err)
+	}
+
+	tt := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "198.51.100.7:1234", "203.0.113.9", "198.51.100.7:1234"},
+		{"proxied", "192.0.2.1:1234", "203.0.113.9", "203.0.113.9:0"},
+		{"chained", "10.1.2.3:1234", "203.0.113.9, 10.4.5.6", "203.0.113.9:0"},
+		{"spoofed", "10.1.2.3:1234", "1.1.1.1, 203.0.113.9", "203.0.113.9:0"},
+		{"garbage", "10.1.2.3:1234", "not an address", "10.1.2.3:1234"},
+	}
+
+	t.Log("Given the need to know the client behind a reverse proxy.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen the request is %s.", testID, tc.name)
+			{
+				var got string
+				h := web.Apply(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					got = r.RemoteAddr
+				}), web.Proxies(proxies))
+
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = tc.remote
+				r.Header.Set("X-Forwarded-For", tc.xff)
+				h.ServeHTTP(httptest.NewRecorder(), r)
+
+				if got != tc.want {
+					t.Fatalf("\t%s\tTest %d:\tShould see the address %s : got %s.", tests.Failed, testID, tc.want, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould see the address %s.", tests.Success, testID, tc.want)
+			}
+		}
+	}
+}
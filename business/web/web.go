@@ -0,0 +1,24 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Handler handles a request like an http.HandlerFunc but reports failures by
+// returning them, leaving the response to the Errors middleware.
+type Handler func(w http.ResponseWriter, r *http.Request) error
+
+// IsAPI reports whether a request is served by the JSON API, or made by a
+// client that wants JSON back.
+func IsAPI(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// Respond writes data as JSON with the given status code.
+func Respond(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
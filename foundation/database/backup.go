@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupPages is the number of pages copied per step of a backup. The
+// database is only locked while a step runs, so writers get through
+// between steps.
+const backupPages = 1024
+
+// Backup copies the SQLite database at src to a new file at dest using the
+// online backup API. The database stays in use while it runs; the copy is
+// a consistent snapshot of it.
+func Backup(ctx context.Context, src, dest string) error {
+	// Opening a missing database would create an empty one.
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	var d sqlite3.SQLiteDriver
+	srcConn, err := d.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", src, err)
+	}
+	defer srcConn.Close()
+	destConn, err := d.Open(dest)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", dest, err)
+	}
+	defer destConn.Close()
+
+	b, err := destConn.(*sqlite3.SQLiteConn).Backup("main", srcConn.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		return fmt.Errorf("starting backup: %w", err)
+	}
+	for {
+		done, err := b.Step(backupPages)
+		if err != nil {
+			b.Close()
+			return fmt.Errorf("copying pages: %w", err)
+		}
+		if done {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			b.Close()
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := b.Close(); err != nil {
+		return fmt.Errorf("finishing backup: %w", err)
+	}
+
+	return nil
+}
+
+// IntegrityCheck returns nil when SQLite finds nothing wrong with the
+// database, and the problems found otherwise.
+func IntegrityCheck(ctx context.Context, db *sqlx.DB) error {
+	const query = `PRAGMA integrity_check`
+
+	var problems []string
+	if err := db.SelectContext(ctx, &problems, query); err != nil {
+		return err
+	}
+	if len(problems) == 1 && problems[0] == "ok" {
+		return nil
+	}
+	return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+}
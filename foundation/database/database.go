@@ -6,12 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"photo-contest/foundation/metrics"
 	"reflect"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/lib/pq"           // Register the postgres driver.
+	_ "github.com/mattn/go-sqlite3" // Register the sqlite3 driver.
+)
+
+// Drivers the database can be opened with.
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
 )
 
 // Set of error variables for CRUD operations.
@@ -22,16 +30,48 @@ var (
 	ErrForbidden             = errors.New("attempted action is not allowed")
 )
 
-// Config is the required properties to use the database.
+// queryDuration times the queries run through the helpers below.
+var queryDuration = metrics.NewHistogram("db_query_duration_seconds",
+	"Time taken by queries run through the database helpers.", metrics.DefBuckets, "helper")
+
+// observe records the time taken by a query started at start.
+func observe(helper string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), helper)
+}
+
+// Config is the required properties to use the database. SQLite, the
+// default, only needs a Path; Postgres is reached at Host.
 type Config struct {
+	Driver string
+
+	// SQLite
 	Path        string
 	Mode        string
 	JournalMode string
 	Cache       string
+
+	// Postgres
+	Host       string
+	User       string
+	Password   string
+	Name       string
+	DisableTLS bool
 }
 
 // Open knows how to open a database connection based on the configuration.
 func Open(cfg Config) (*sqlx.DB, error) {
+	switch cfg.Driver {
+	case "", DriverSQLite:
+		return openSQLite(cfg)
+	case DriverPostgres:
+		return openPostgres(cfg)
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+}
+
+// openSQLite opens the database file at cfg.Path, or an in-memory database
+// for ":memory:".
+func openSQLite(cfg Config) (*sqlx.DB, error) {
 	mode := "rw"
 	if cfg.Mode != "" {
 		mode = cfg.Mode
@@ -42,8 +82,8 @@ func Open(cfg Config) (*sqlx.DB, error) {
 		journalMode = cfg.JournalMode
 	}
 	cache := "shared"
-	if cfg.JournalMode != "" {
-		cache = cfg.JournalMode
+	if cfg.Cache != "" {
+		cache = cfg.Cache
 	}
 
 	q := make(url.Values)
@@ -52,7 +92,6 @@ func Open(cfg Config) (*sqlx.DB, error) {
 	q.Set("cache", cache)
 
 	u := url.URL{
-		//Scheme:   scheme,
 		Path:     cfg.Path,
 		RawQuery: q.Encode(),
 	}
@@ -61,16 +100,43 @@ func Open(cfg Config) (*sqlx.DB, error) {
 		conn_str = ":memory:"
 	}
 
-	fmt.Println(conn_str)
-
-	db, err := sqlx.Open("sqlite3", conn_str)
+	db, err := sqlx.Open(DriverSQLite, conn_str)
 	if err != nil {
 		return nil, err
 	}
 
+	// Every connection to :memory: gets its own empty database, so keep the
+	// pool down to a single connection.
+	if cfg.Path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
 	return db, nil
 }
 
+// openPostgres connects to the database cfg.Name on the server at cfg.Host.
+// Sessions use UTC, as SQLite does.
+func openPostgres(cfg Config) (*sqlx.DB, error) {
+	sslMode := "require"
+	if cfg.DisableTLS {
+		sslMode = "disable"
+	}
+
+	q := make(url.Values)
+	q.Set("sslmode", sslMode)
+	q.Set("timezone", "utc")
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     cfg.Host,
+		Path:     cfg.Name,
+		RawQuery: q.Encode(),
+	}
+
+	return sqlx.Open(DriverPostgres, u.String())
+}
+
 // StatusCheck returns nil if it can successfully talk to the database. It
 // returns a non-nil error otherwise.
 func StatusCheck(ctx context.Context, db *sqlx.DB) error {
@@ -78,7 +144,7 @@ func StatusCheck(ctx context.Context, db *sqlx.DB) error {
 	// First check we can ping the database.
 	var pingError error
 	for attempts := 1; ; attempts++ {
-		pingError = db.Ping()
+		pingError = db.PingContext(ctx)
 		if pingError == nil {
 			break
 		}
@@ -100,18 +166,102 @@ func StatusCheck(ctx context.Context, db *sqlx.DB) error {
 	return db.QueryRowContext(ctx, q).Scan(&tmp)
 }
 
+// WithTx runs fn in a transaction. The transaction is committed when fn
+// returns nil and rolled back otherwise, including when fn panics. The error
+// of fn is returned as is, for callers to compare against their own errors.
+func WithTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// LockKey takes a lock on key that is held until tx ends, so transactions
+// working on the same key run one after the other. The key space is shared
+// by the whole database. SQLite lets one writer in at a time anyway, so
+// there it does nothing; Postgres takes a transaction level advisory lock.
+func LockKey(ctx context.Context, tx *sqlx.Tx, key int64) error {
+	if tx.DriverName() != DriverPostgres {
+		return nil
+	}
+
+	defer observe("LockKey", time.Now())
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, key); err != nil {
+		return fmt.Errorf("locking key %d: %w", key, err)
+	}
+	return nil
+}
+
+// NamedInsertID runs an insert and returns the ID the database gave the new
+// row, held in column. SQLite reports it on its own; Postgres is asked to
+// return it.
+func NamedInsertID(ctx context.Context, db sqlx.ExtContext, query string, data interface{}, column string) (int, error) {
+	defer observe("NamedInsertID", time.Now())
+
+	if db.DriverName() != DriverPostgres {
+		res, err := sqlx.NamedExecContext(ctx, db, query, data)
+		if err != nil {
+			return 0, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		return int(id), nil
+	}
+
+	rows, err := sqlx.NamedQueryContext(ctx, db, query+" RETURNING "+column, data)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("no ID returned")
+	}
+	var id int
+	if err := rows.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, rows.Close()
+}
+
 // NamedQuerySlice is a helper function for executing queries that return a
-// collection of data to be unmarshaled into a slice.
-func NamedQuerySlice(ctx context.Context, db *sqlx.DB, query string, data interface{}, dest interface{}) error {
+// collection of data to be unmarshaled into a slice. db is either the
+// database or a transaction.
+func NamedQuerySlice(ctx context.Context, db sqlx.ExtContext, query string, data interface{}, dest interface{}) error {
 	val := reflect.ValueOf(dest)
 	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Slice {
 		return errors.New("must provide a pointer to a slice")
 	}
+	defer observe("NamedQuerySlice", time.Now())
 
-	rows, err := db.NamedQueryContext(ctx, query, data)
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
 	slice := val.Elem()
 	for rows.Next() {
@@ -122,17 +272,25 @@ func NamedQuerySlice(ctx context.Context, db *sqlx.DB, query string, data interf
 		slice.Set(reflect.Append(slice, v.Elem()))
 	}
 
-	return nil
+	return rows.Err()
 }
 
 // NamedQueryStruct is a helper function for executing queries that return a
-// single value to be unmarshalled into a struct type.
-func NamedQueryStruct(db *sqlx.DB, query string, data interface{}, dest interface{}) error {
-	rows, err := db.NamedQuery(query, data)
+// single value to be unmarshalled into a struct type. db is either the
+// database or a transaction.
+func NamedQueryStruct(ctx context.Context, db sqlx.ExtContext, query string, data interface{}, dest interface{}) error {
+	defer observe("NamedQueryStruct", time.Now())
+
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
 	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
 		return ErrNotFound
 	}
 
@@ -140,7 +298,7 @@ func NamedQueryStruct(db *sqlx.DB, query string, data interface{}, dest interfac
 		return err
 	}
 
-	return nil
+	return rows.Close()
 }
 
 // Log provides a pretty print version of the query and parameters.
@@ -169,15 +327,16 @@ func Log(query string, args ...interface{}) string {
 	return fmt.Sprintf("[%s]\n", strings.Trim(query, " "))
 }
 
-// GetSQLiteVersion -
-func GetSQLiteVersion(db *sqlx.DB) (string, error) {
-	const query = `SELECT sqlite_version()`
-
-	//var row *sql.Row
-	row := db.QueryRow(query)
+// GetVersion returns the version of the database server, or of the SQLite
+// library in use.
+func GetVersion(ctx context.Context, db *sqlx.DB) (string, error) {
+	query := `SELECT sqlite_version()`
+	if db.DriverName() == DriverPostgres {
+		query = `SHOW server_version`
+	}
 
 	var version string
-	err := row.Scan(&version)
+	err := db.QueryRowContext(ctx, query).Scan(&version)
 
 	return version, err
 }
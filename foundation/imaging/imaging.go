@@ -0,0 +1,102 @@
+// Package imaging provides support for decoding, resizing and encoding images.
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// Fit scales img down so that its longest edge is at most maxEdge pixels,
+// keeping the aspect ratio. Images that already fit are returned as-is;
+// images are never scaled up.
+func Fit(img image.Image, maxEdge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxEdge && h <= maxEdge {
+		return img
+	}
+
+	if w >= h {
+		h = h * maxEdge / w
+		w = maxEdge
+	} else {
+		w = w * maxEdge / h
+		h = maxEdge
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// Orient applies an EXIF orientation (1-8) to img so that it displays upright
+// once the metadata is gone. Unknown orientations return img as-is. Pixels
+// are moved as whole RGBA words, so it is cheap enough for renditions; scale
+// large images down before orienting them.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		b := img.Bounds()
+		src = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally.
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180.
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically.
+				dx, dy = x, h-1-y
+			case 5: // Transposed.
+				dx, dy = y, x
+			case 6: // Needs a 90 degree clockwise rotation.
+				dx, dy = h-1-y, x
+			case 7: // Transversed.
+				dx, dy = h-1-y, w-1-x
+			case 8: // Needs a 90 degree counter-clockwise rotation.
+				dx, dy = y, w-1-x
+			}
+			i := dst.PixOffset(dx, dy)
+			copy(dst.Pix[i:i+4], row[4*x:4*x+4])
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG writes img as a baseline JPEG. Transparent areas are flattened
+// onto a white background since JPEG has no alpha channel. The encoder
+// doesn't write any metadata, so the output carries no EXIF.
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	flat := image.NewRGBA(b)
+	draw.Draw(flat, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, b, img, b.Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: quality})
+}
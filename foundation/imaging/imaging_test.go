@@ -0,0 +1,55 @@
+package imaging_test
+
+import (
+	"image"
+	"image/color"
+	"photo-contest/foundation/imaging"
+	"testing"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestOrient(t *testing.T) {
+
+	// A 3x2 image, marked in its top left corner.
+	mark := color.RGBA{R: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(10, 10, 13, 12))
+	img.Set(10, 10, mark)
+
+	tt := []struct {
+		orientation int
+		w, h        int
+		x, y        int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	t.Log("Given the need to turn photos upright.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen the orientation is %d.", testID, tc.orientation)
+			{
+				got := imaging.Orient(img, tc.orientation)
+				b := got.Bounds()
+				if b.Dx() != tc.w || b.Dy() != tc.h {
+					t.Fatalf("\t%s\tTest %d:\tShould be %dx%d : got %dx%d.", failed, testID, tc.w, tc.h, b.Dx(), b.Dy())
+				}
+				if c := color.RGBAModel.Convert(got.At(b.Min.X+tc.x, b.Min.Y+tc.y)); c != mark {
+					t.Fatalf("\t%s\tTest %d:\tShould move the corner to %d,%d : got %v.", failed, testID, tc.x, tc.y, c)
+				}
+				t.Logf("\t%s\tTest %d:\tShould move the corner to %d,%d.", success, testID, tc.x, tc.y)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package keystore holds the RSA keys that sign and verify tokens. Keys are
+// read from a directory with one PEM file per key, named after its key ID:
+// var/keys/2021-06.pem holds the key with ID "2021-06".
+//
+// Rotating keys takes no downtime worth mentioning: add the new key, make it
+// the active one, and keep the old file around until the tokens it signed
+// have expired. A file holding only the public key is enough for that.
+package keystore
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrKeyNotFound is returned for key IDs the store doesn't hold.
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyStore holds the keys in memory. It is safe for concurrent use.
+type KeyStore struct {
+	dir string
+
+	mu      sync.RWMutex
+	private map[string]*rsa.PrivateKey
+	public  map[string]*rsa.PublicKey
+}
+
+// NewFS returns a key store loaded with the .pem files found in dir. A
+// missing directory gives an empty store.
+func NewFS(dir string) (*KeyStore, error) {
+	ks := KeyStore{dir: dir}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return &ks, nil
+}
+
+// Reload reads the key files again, so keys can be rotated while running.
+// The keys held so far are kept when any of the files can't be read.
+func (ks *KeyStore) Reload() error {
+	private := make(map[string]*rsa.PrivateKey)
+	public := make(map[string]*rsa.PublicKey)
+
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return errors.Wrapf(err, "listing keys in %s", ks.dir)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrapf(err, "reading key %s", file)
+		}
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		priv, pub, err := parseKey(data)
+		if err != nil {
+			return errors.Wrapf(err, "parsing key %s", file)
+		}
+		if priv != nil {
+			private[kid] = priv
+		}
+		public[kid] = pub
+	}
+
+	ks.mu.Lock()
+	ks.private = private
+	ks.public = public
+	ks.mu.Unlock()
+	return nil
+}
+
+// PrivateKey returns the key with the given ID, for signing. Keys kept only
+// to verify don't have one.
+func (ks *KeyStore) PrivateKey(kid string) (*rsa.PrivateKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.private[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// PublicKey returns the key with the given ID, for verifying.
+func (ks *KeyStore) PublicKey(kid string) (*rsa.PublicKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.public[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// parseKey decodes a PEM encoded RSA key, private in PKCS #1 or #8 form or
+// public in PKIX form. The private key is nil for public keys.
+func parseKey(data []byte) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("not an RSA key")
+		}
+		return key, &key.PublicKey, nil
+
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, nil, errors.New("not an RSA key")
+		}
+		return nil, key, nil
+	}
+
+	return nil, nil, errors.Errorf("unsupported PEM block %q", block.Type)
+}
@@ -0,0 +1,124 @@
+package keystore_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"photo-contest/foundation/keystore"
+	"testing"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestKeyStore(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+	writePEM(t, filepath.Join(dir, "2021-06.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+
+	t.Log("Given the need to hold the keys signing tokens.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen loading a private key.", testID)
+		{
+			ks, err := keystore.NewFS(dir)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the keys : %s.", failed, testID, err)
+			}
+			priv, err := ks.PrivateKey("2021-06")
+			if err != nil || !priv.Equal(key) {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the private key : %v.", failed, testID, err)
+			}
+			pub, err := ks.PublicKey("2021-06")
+			if err != nil || !pub.Equal(&key.PublicKey) {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the public key : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the key.", success, testID)
+
+			if _, err := ks.PublicKey("2021-05"); err != keystore.ErrKeyNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find an unknown key : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find an unknown key.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a key is rotated out.", testID)
+		{
+			ks, err := keystore.NewFS(dir)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the keys : %s.", failed, testID, err)
+			}
+
+			next, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatalf("generating key: %s", err)
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(next)
+			if err != nil {
+				t.Fatalf("encoding key: %s", err)
+			}
+			writePEM(t, filepath.Join(dir, "2021-07.pem"), "PRIVATE KEY", der)
+			der, err = x509.MarshalPKIXPublicKey(&key.PublicKey)
+			if err != nil {
+				t.Fatalf("encoding key: %s", err)
+			}
+			writePEM(t, filepath.Join(dir, "2021-06.pem"), "PUBLIC KEY", der)
+
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the keys : %s.", failed, testID, err)
+			}
+			if priv, err := ks.PrivateKey("2021-07"); err != nil || !priv.Equal(next) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the new key : %v.", failed, testID, err)
+			}
+			if _, err := ks.PrivateKey("2021-06"); err != keystore.ErrKeyNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould have no private part for the old key : %v.", failed, testID, err)
+			}
+			if pub, err := ks.PublicKey("2021-06"); err != nil || !pub.Equal(&key.PublicKey) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the old public key : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the old key to verify only.", success, testID)
+
+			if err := ioutil.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0600); err != nil {
+				t.Fatalf("writing key: %s", err)
+			}
+			if err := ks.Reload(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail to reload a broken key.", failed, testID)
+			}
+			if _, err := ks.PrivateKey("2021-07"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the keys held so far : %s.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the keys held so far when a file is broken.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen there is no key directory.", testID)
+		{
+			ks, err := keystore.NewFS(filepath.Join(dir, "missing"))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load no keys : %s.", failed, testID, err)
+			}
+			if _, err := ks.PublicKey("2021-06"); err != keystore.ErrKeyNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould hold no keys : %v.", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould hold no keys.", success, testID)
+		}
+	}
+}
+
+// writePEM writes a single PEM block to path.
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("writing key: %s", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Package mail provides support for sending email messages.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the interface for delivering email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// =============================================================================
+
+// LogMailer writes messages to a logger instead of sending them. It is meant
+// for development.
+type LogMailer struct {
+	log *log.Logger
+}
+
+// NewLogMailer constructs a mailer that logs the messages.
+func NewLogMailer(log *log.Logger) LogMailer {
+	return LogMailer{log: log}
+}
+
+// Send logs the message.
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	m.log.Printf("mail: to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// =============================================================================
+
+// FileMailer writes each message to its own file in a directory, so they can
+// be inspected by developers and tests.
+type FileMailer struct {
+	dir string
+}
+
+// NewFileMailer constructs a mailer that writes the messages under dir.
+func NewFileMailer(dir string) FileMailer {
+	return FileMailer{dir: dir}
+}
+
+// Send writes the message to a new file named after the time and recipient.
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return errors.Wrap(err, "creating mail directory")
+	}
+
+	now := time.Now().UTC()
+	to := strings.NewReplacer("/", "_", "\\", "_", "@", "_at_").Replace(msg.To)
+	name := filepath.Join(m.dir, fmt.Sprintf("%s_%d_%s.eml", now.Format("20060102T150405"), now.Nanosecond(), to))
+
+	data := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s", msg.To, msg.Subject, now.Format(time.RFC1123Z), msg.Body)
+	if err := os.WriteFile(name, []byte(data), 0o640); err != nil {
+		return errors.Wrapf(err, "writing message to %s", msg.To)
+	}
+
+	return nil
+}
@@ -0,0 +1,296 @@
+// Package metrics keeps counters, histograms and gauges and serves them in
+// the Prometheus text exposition format. Like expvar, metrics are created
+// once at package level and registered as they are made:
+//
+//	var votes = metrics.NewCounter("votes_cast_total", "Votes cast.")
+//
+//	votes.Inc()
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the upper bounds of the histogram buckets used for timings,
+// in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is anything that can write its samples out.
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	mu       sync.RWMutex
+	registry []metric
+)
+
+// register adds m to the metrics served, panicking on a name used twice as
+// expvar does.
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, r := range registry {
+		if r.name() == m.name() {
+			panic("metrics: reuse of metric name " + m.name())
+		}
+	}
+	registry = append(registry, m)
+}
+
+// WriteTo writes every metric out in the text exposition format.
+func WriteTo(w io.Writer) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range registry {
+		m.write(bw)
+	}
+	bw.Flush()
+}
+
+// Handler serves the metrics to a Prometheus scraper.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// desc describes a metric and the labels its samples are split by.
+type desc struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+func (d desc) name() string { return d.Name }
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.Name, helpEscaper.Replace(d.Help), d.Name, d.Type)
+}
+
+// key joins label values into a map key, checking there is one per label.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.Labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.Name, len(d.Labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labels formats label pairs, with extra ones such as le appended.
+func (d desc) labels(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, l := range d.Labels {
+		pairs = append(pairs, l+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a value that only goes up, kept per set of label values.
+type Counter struct {
+	desc
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounter registers a counter split by the given labels.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := Counter{
+		desc:   desc{Name: name, Help: help, Type: "counter", Labels: labels},
+		values: make(map[string]*counterValue),
+	}
+	register(&c)
+	return &c
+}
+
+// Inc adds one to the counter for the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter for the label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cv, ok := c.values[key]
+	if !ok {
+		cv = &counterValue{labels: append([]string(nil), labelValues...)}
+		c.values[key] = cv
+	}
+	cv.value += v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.Labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.Name)
+		return
+	}
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	for _, key := range sorted(keys) {
+		cv := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.Name, c.labels(cv.labels), formatFloat(cv.value))
+	}
+}
+
+// Histogram counts observations, such as timings, in buckets, kept per set
+// of label values.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds, in
+// increasing order, split by the given labels.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := Histogram{
+		desc:    desc{Name: name, Help: help, Type: "histogram", Labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+	register(&h)
+	return &h
+}
+
+// Observe records v for the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{
+			labels: append([]string(nil), labelValues...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	for _, key := range sorted(keys) {
+		hv := h.values[key]
+
+		// Buckets are cumulative: each counts everything up to its bound.
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labels(hv.labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labels(hv.labels, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.Name, h.labels(hv.labels), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.Name, h.labels(hv.labels), hv.count)
+	}
+}
+
+// GaugeFunc is a value that goes up and down, read when the metrics are
+// scraped.
+type GaugeFunc struct {
+	desc
+	f func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is returned by f. f is called
+// on every scrape, so it should be cheap; it may return NaN when the value
+// can't be had.
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	g := GaugeFunc{
+		desc: desc{Name: name, Help: help, Type: "gauge"},
+		f:    f,
+	}
+	register(&g)
+	return &g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.Name, formatFloat(g.f()))
+}
+
+// The exposition format only escapes backslashes, double quotes and line
+// feeds in label values, and backslashes and line feeds in help texts. Other
+// characters, unicode included, go out as they are.
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// sorted returns keys in order, so output is stable.
+func sorted(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+// formatFloat formats v as the exposition format expects.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,140 @@
+package metrics_test
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"photo-contest/foundation/metrics"
+	"strings"
+	"testing"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestMetrics(t *testing.T) {
+	requests := metrics.NewCounter("test_requests_total", "Requests served.", "route", "status")
+	metrics.NewCounter("test_idle_total", "Never touched.")
+	duration := metrics.NewHistogram("test_duration_seconds", "Time taken.", []float64{.1, .5, 1}, "route")
+	temp := 21.5
+	metrics.NewGaugeFunc("test_temperature", "Current temperature.\nIn degrees.", func() float64 { return temp })
+	metrics.NewGaugeFunc("test_unknown", "Can't be had.", func() float64 { return math.NaN() })
+
+	scrape := func() string {
+		var buf bytes.Buffer
+		metrics.WriteTo(&buf)
+		return buf.String()
+	}
+
+	t.Log("Given the need to expose metrics to Prometheus.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen counting.", testID)
+		{
+			requests.Inc("/contests/{id}", "200")
+			requests.Inc("/contests/{id}", "200")
+			requests.Add(3, "/login", "303")
+
+			out := scrape()
+			for _, line := range []string{
+				"# HELP test_requests_total Requests served.",
+				"# TYPE test_requests_total counter",
+				`test_requests_total{route="/contests/{id}",status="200"} 2`,
+				`test_requests_total{route="/login",status="303"} 3`,
+				"# TYPE test_idle_total counter",
+				"test_idle_total 0",
+			} {
+				if !strings.Contains(out, line+"\n") {
+					t.Fatalf("\t%s\tTest %d:\tShould write %q : got\n%s", failed, testID, line, out)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould write the counters per label values.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen observing timings.", testID)
+		{
+			for _, v := range []float64{.05, .1, .3, .7, 2} {
+				duration.Observe(v, "/photos/{id}")
+			}
+
+			out := scrape()
+			exp := strings.Join([]string{
+				"# HELP test_duration_seconds Time taken.",
+				"# TYPE test_duration_seconds histogram",
+				`test_duration_seconds_bucket{route="/photos/{id}",le="0.1"} 2`,
+				`test_duration_seconds_bucket{route="/photos/{id}",le="0.5"} 3`,
+				`test_duration_seconds_bucket{route="/photos/{id}",le="1"} 4`,
+				`test_duration_seconds_bucket{route="/photos/{id}",le="+Inf"} 5`,
+				`test_duration_seconds_sum{route="/photos/{id}"} 3.15`,
+				`test_duration_seconds_count{route="/photos/{id}"} 5`,
+			}, "\n") + "\n"
+			if !strings.Contains(out, exp) {
+				t.Fatalf("\t%s\tTest %d:\tShould write cumulative buckets, the sum and the count : got\n%s", failed, testID, out)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write cumulative buckets, the sum and the count.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen reading gauges.", testID)
+		{
+			temp = 19
+			out := scrape()
+			for _, line := range []string{
+				`# HELP test_temperature Current temperature.\nIn degrees.`,
+				"# TYPE test_temperature gauge",
+				"test_temperature 19",
+				"test_unknown NaN",
+			} {
+				if !strings.Contains(out, line+"\n") {
+					t.Fatalf("\t%s\tTest %d:\tShould write %q : got\n%s", failed, testID, line, out)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould read the gauges on every scrape.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen label values need escaping.", testID)
+		{
+			requests.Inc("C:\\photos\n\"best\" café", "500")
+
+			out := scrape()
+			line := `test_requests_total{route="C:\\photos\n\"best\" café",status="500"} 1`
+			if !strings.Contains(out, line+"\n") {
+				t.Fatalf("\t%s\tTest %d:\tShould only escape backslashes, quotes and line feeds : got\n%s", failed, testID, out)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only escape backslashes, quotes and line feeds.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen scraped over HTTP.", testID)
+		{
+			w := httptest.NewRecorder()
+			metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+				t.Fatalf("\t%s\tTest %d:\tShould serve the text format : got %q.", failed, testID, ct)
+			}
+			if !strings.Contains(w.Body.String(), "test_temperature 19\n") {
+				t.Fatalf("\t%s\tTest %d:\tShould serve the metrics : got\n%s", failed, testID, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould serve the metrics in the text format.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen a name is used twice.", testID)
+		{
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("\t%s\tTest %d:\tShould panic.", failed, testID)
+					}
+				}()
+				metrics.NewCounter("test_requests_total", "Again.")
+			}()
+			t.Logf("\t%s\tTest %d:\tShould panic.", success, testID)
+		}
+	}
+}
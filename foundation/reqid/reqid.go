@@ -0,0 +1,24 @@
+// Package reqid carries the ID of the request being served through its
+// context, so every layer can tag its log lines with it.
+package reqid
+
+import "context"
+
+// ctxKey is the type of the context key holding the request ID.
+type ctxKey int
+
+const key ctxKey = 1
+
+// NewContext returns a copy of ctx carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key, id)
+}
+
+// Get returns the ID of the request served with ctx, or "-" when there is
+// none, so it can always go in a log line.
+func Get(ctx context.Context) string {
+	if id, ok := ctx.Value(key).(string); ok {
+		return id
+	}
+	return "-"
+}
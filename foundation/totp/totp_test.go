@@ -0,0 +1,101 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"photo-contest/foundation/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded.
+var secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+
+	// RFC 6238 Appendix B, SHA-1. The RFC gives eight digits; six digit
+	// codes are the last six of them.
+	tt := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	t.Log("Given the need to generate RFC 6238 codes.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen the time is %d.", testID, tc.unix)
+			{
+				want := tc.code[len(tc.code)-totp.Digits:]
+				got, err := totp.Code(secret, totp.Step(time.Unix(tc.unix, 0)))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code : %s.", failed, testID, err)
+				}
+				if got != want {
+					t.Fatalf("\t%s\tTest %d:\tShould get %s : got %s.", failed, testID, want, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get %s.", success, testID, want)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totp.Step(now)
+
+	t.Log("Given the need to validate codes with some clock drift.")
+	{
+		for testID, offset := range []int64{-totp.Skew - 1, -totp.Skew, 0, totp.Skew, totp.Skew + 1} {
+			inWindow := offset >= -totp.Skew && offset <= totp.Skew
+			verdict := "refuse"
+			if inWindow {
+				verdict = "accept"
+			}
+			t.Logf("\tTest %d:\tWhen the code is %d steps off.", testID, offset)
+			{
+				code, err := totp.Code(secret, step+offset)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code : %s.", failed, testID, err)
+				}
+				got, ok := totp.Validate(secret, code, now)
+				if ok != inWindow {
+					t.Fatalf("\t%s\tTest %d:\tShould %s the code.", failed, testID, verdict)
+				}
+				if ok && got != step+offset {
+					t.Fatalf("\t%s\tTest %d:\tShould give back the step of the code : got %d, want %d.", failed, testID, got, step+offset)
+				}
+				t.Logf("\t%s\tTest %d:\tShould %s the code.", success, testID, verdict)
+			}
+		}
+
+		testID := 5
+		t.Logf("\tTest %d:\tWhen the code is typed with spaces.", testID)
+		{
+			code, err := totp.Code(secret, step)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code : %s.", failed, testID, err)
+			}
+			spaced := " " + code[:3] + " " + code[3:] + " "
+			if _, ok := totp.Validate(secret, spaced, now); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould accept %q.", failed, testID, spaced)
+			}
+			if _, ok := totp.Validate(secret, strings.Repeat("0", totp.Digits+1), now); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a code of the wrong length.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould ignore spaces.", success, testID)
+		}
+	}
+}